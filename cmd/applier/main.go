@@ -9,12 +9,15 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/ghodss/yaml"
 	"github.com/stolostron/library-go/pkg/applier"
 	libgoclient "github.com/stolostron/library-go/pkg/client"
+	"github.com/stolostron/library-go/pkg/policy"
 	"github.com/stolostron/library-go/pkg/templateprocessor"
+	"github.com/stolostron/library-go/pkg/validation"
+	"github.com/stolostron/library-go/pkg/values"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog"
 	crclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -25,7 +28,8 @@ type Values map[string]interface{}
 type Option struct {
 	outFile        string
 	directory      string
-	valuesPath     string
+	values         values.Options
+	printValues    bool
 	kubeconfigPath string
 	dryRun         bool
 	prefix         string
@@ -33,6 +37,26 @@ type Option struct {
 	timeout        int
 	force          bool
 	silent         bool
+	outputList     bool
+	labels         string
+	annotations    string
+	namespace      string
+	imageRewrite   string
+	imageDigests   string
+	policy         string
+	schema         bool
+	openAPI        string
+	crds           string
+	valuesSchema   string
+	valuesDefaults bool
+	chart          bool
+	release        string
+	lookup         bool
+	capabilities   string
+	discover       bool
+	missingValues  bool
+	concurrency    int
+	partials       string
 }
 
 func main() {
@@ -42,7 +66,8 @@ func main() {
 		"Output file. If set nothing will be applied but a file will be generate "+
 			"which you can apply later with 'kubectl <create|apply|delete> -f")
 	flag.StringVar(&o.directory, "d", "", "The directory or file containing the template(s)")
-	flag.StringVar(&o.valuesPath, "values", "", "The directory containing the templates")
+	o.values.AddFlags(flag.CommandLine)
+	flag.BoolVar(&o.printValues, "print-values", false, "If set, the merged values are printed on stderr")
 	flag.StringVar(&o.kubeconfigPath, "k", "", "The kubeconfig file")
 	flag.BoolVar(&o.dryRun, "dry-run", false, "if set only the rendered yaml will be shown, default false")
 	flag.StringVar(&o.prefix, "p", "", "The prefix to add to each value names, for example 'Values'")
@@ -51,6 +76,36 @@ func main() {
 	flag.IntVar(&o.timeout, "t", 5, "Timeout in second to apply one resource, default 5 sec")
 	flag.BoolVar(&o.force, "force", false, "If set, the finalizers will be removed before delete")
 	flag.BoolVar(&o.silent, "s", false, "If set the applier will run silently")
+	flag.BoolVar(&o.outputList, "list", false, "If set with -o, the resources are generated in a single v1/List")
+	flag.StringVar(&o.labels, "labels", "", "Labels to add to all resources, for example 'k1=v1,k2=v2'")
+	flag.StringVar(&o.annotations, "annotations", "", "Annotations to add to all resources, for example 'k1=v1,k2=v2'")
+	flag.StringVar(&o.namespace, "n", "", "The namespace to set on the namespaced resources which don't have one")
+	flag.StringVar(&o.imageRewrite, "image-rewrite", "", "The image rewrite configuration file (mirrors, digests, paths)")
+	flag.StringVar(&o.imageDigests, "image-digests", "", "The image manifest file mapping image references to digests")
+	flag.StringVar(&o.policy, "policy", "", "The CEL policy rules file the rendered resources are validated against")
+	flag.BoolVar(&o.schema, "schema-validation", false,
+		"If set, the rendered resources are validated against the schemas of their kind without a cluster")
+	flag.StringVar(&o.openAPI, "openapi", "",
+		"The OpenAPI v2 or v3 spec file used by -schema-validation, for example the output of 'kubectl get --raw /openapi/v2'")
+	flag.StringVar(&o.crds, "crds", "", "The directory or file containing the CRDs used by -schema-validation")
+	flag.StringVar(&o.valuesSchema, "values-schema", "",
+		"The JSON schema file the values are validated against, by default the values.schema.json of the templates directory")
+	flag.BoolVar(&o.valuesDefaults, "values-defaults", false, "If set, the defaults of the values schema are applied")
+	flag.BoolVar(&o.chart, "chart", false, "If set, the -d directory is rendered as a Helm chart")
+	flag.StringVar(&o.release, "release", templateprocessor.DefaultReleaseName, "The release name of the -chart")
+	flag.BoolVar(&o.lookup, "lookup", false,
+		"If set, the lookup template functions read the existing objects of the cluster, even with -o")
+	flag.StringVar(&o.capabilities, "capabilities", "",
+		"The capabilities file, yaml or json, exposed as .Capabilities to the templates, for example to render offline with -o")
+	flag.BoolVar(&o.missingValues, "missing-values", false,
+		"If set, nothing is applied but the values missing for the templates are listed, "+
+			"it fails if a value which is not guarded by an if, with, range or default is missing")
+	flag.BoolVar(&o.discover, "discover-capabilities", false,
+		"If set, the capabilities of the cluster are discovered and exposed as .Capabilities to the templates")
+	flag.IntVar(&o.concurrency, "concurrency", 0,
+		"The number of templates rendered concurrently, the templates are rendered one after the other if lower than 2")
+	flag.StringVar(&o.partials, "partials", "",
+		"The directory of the partials shared by all the templates, relative to the -d directory")
 	flag.Parse()
 
 	if !o.silent {
@@ -68,7 +123,11 @@ func main() {
 		fmt.Printf("Failed to apply due to error: %s\n", err)
 		os.Exit(1)
 	}
-	if o.dryRun {
+	if o.missingValues {
+		if !o.silent {
+			fmt.Println("No required value is missing")
+		}
+	} else if o.dryRun {
 		if !o.silent {
 			fmt.Println("Dryrun successfully executed")
 		}
@@ -94,64 +153,254 @@ func checkOptions(o *Option) error {
 		(o.dryRun || o.delete || o.force) {
 		return fmt.Errorf("-o is not compatible with -dry-run, delete or force")
 	}
+	if o.outputList && o.outFile == "" {
+		return fmt.Errorf("-list must be used with -o")
+	}
+	if o.chart && (o.outputList || o.prefix != "") {
+		return fmt.Errorf("-chart is not compatible with -list or -p")
+	}
+	if o.missingValues && (o.chart || o.outFile != "" || o.delete) {
+		return fmt.Errorf("-missing-values is not compatible with -chart, -o or -delete")
+	}
+	if o.capabilities != "" && o.discover {
+		return fmt.Errorf("-capabilities is not compatible with -discover-capabilities")
+	}
+	if _, err := parseKeyValues(o.labels); err != nil {
+		return fmt.Errorf("-labels %s", err)
+	}
+	if _, err := parseKeyValues(o.annotations); err != nil {
+		return fmt.Errorf("-annotations %s", err)
+	}
 	return nil
 }
 
-func apply(o Option) (err error) {
-	var b []byte
-	if o.valuesPath != "" {
-		b, err = ioutil.ReadFile(filepath.Clean(o.valuesPath))
-		if err != nil {
-			return err
+//parseKeyValues parses a 'k1=v1,k2=v2' string into a map
+func parseKeyValues(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%s is not a key=value pair", kv)
 		}
+		m[parts[0]] = parts[1]
 	}
+	return m, nil
+}
 
+func apply(o Option) (err error) {
 	fi, err := os.Stdin.Stat()
 	if err != nil {
 		return err
 	}
 	if fi.Mode()&os.ModeNamedPipe != 0 {
-		b = append(b, '\n')
-		pdata, err := ioutil.ReadAll(os.Stdin)
-		if err != nil {
-			return err
-		}
-		b = append(b, pdata...)
+		o.values.Files = append(o.values.Files, values.StdinFile)
 	}
-
-	valuesc := &Values{}
-	err = yaml.Unmarshal(b, valuesc)
+	valuesc, err := values.Load(&o.values)
 	if err != nil {
 		return err
 	}
+	if o.printValues {
+		fmt.Fprintf(os.Stderr, "%s", valuesc)
+	}
 
-	values := Values{}
+	vals := Values{}
 	if o.prefix != "" {
-		values[o.prefix] = *valuesc
+		vals[o.prefix] = map[string]interface{}(valuesc)
 	} else {
-		values = *valuesc
+		vals = Values(valuesc)
 	}
 
-	klog.V(5).Infof("values:\n%v", values)
+	klog.V(5).Infof("values:\n%v", vals)
 
 	templateReader := templateprocessor.NewYamlFileReader(o.directory)
+	templateProcessorOptions := &templateprocessor.Options{
+		Namespace:           o.namespace,
+		ApplyValuesDefaults: o.valuesDefaults,
+		Concurrency:         o.concurrency,
+		PartialsPath:        o.partials,
+	}
+	if o.valuesSchema != "" {
+		templateProcessorOptions.ValuesSchema, err = ioutil.ReadFile(filepath.Clean(o.valuesSchema))
+		if err != nil {
+			return err
+		}
+	}
+	templateProcessorOptions.CommonLabels, _ = parseKeyValues(o.labels)
+	templateProcessorOptions.CommonAnnotations, _ = parseKeyValues(o.annotations)
+	err = setImageRewrite(o, templateProcessorOptions)
+	if err != nil {
+		return err
+	}
+	err = setPolicy(o, templateProcessorOptions)
+	if err != nil {
+		return err
+	}
+	err = setSchemaValidation(o, templateProcessorOptions)
+	if err != nil {
+		return err
+	}
+	err = setCapabilities(o, templateProcessorOptions)
+	if err != nil {
+		return err
+	}
+	if o.lookup {
+		templateProcessorOptions.LookupClient, err = libgoclient.NewDefaultClient(o.kubeconfigPath, crclient.Options{})
+		if err != nil {
+			return err
+		}
+	}
+	if o.chart {
+		return applyChart(o, templateReader, templateProcessorOptions, valuesc)
+	}
+	if o.missingValues {
+		return listMissingValues(o, templateReader, templateProcessorOptions, vals)
+	}
 	if o.outFile != "" {
-		templateProcessor, err := templateprocessor.NewTemplateProcessor(templateReader, &templateprocessor.Options{})
+		templateProcessor, err := templateprocessor.NewTemplateProcessor(templateReader, templateProcessorOptions)
 		if err != nil {
 			return err
 		}
-		outV, err := templateProcessor.TemplateResourcesInPathYaml("", []string{}, true, values)
+		var out string
+		if o.outputList {
+			outL, err := templateProcessor.TemplateResourcesInPathYamlList("", []string{}, true, vals)
+			if err != nil {
+				return err
+			}
+			out = string(outL)
+		} else {
+			outV, err := templateProcessor.TemplateResourcesInPathYaml("", []string{}, true, vals)
+			if err != nil {
+				return err
+			}
+			out = templateprocessor.ConvertArrayOfBytesToString(outV)
+		}
+		klog.V(1).Infof("result:\n%s", out)
+		return ioutil.WriteFile(filepath.Clean(o.outFile), []byte(out), 0600)
+	}
+	a, err := newApplier(o, templateReader, templateProcessorOptions)
+	if err != nil {
+		return err
+	}
+	if o.delete {
+		err = a.DeleteInPath("", nil, true, vals)
+	} else {
+		err = a.CreateOrUpdateInPath("", nil, true, vals)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//applyChart renders the -d directory as a Helm chart then generates, applies or deletes the resources
+func applyChart(
+	o Option,
+	templateReader templateprocessor.TemplateReader,
+	templateProcessorOptions *templateprocessor.Options,
+	valuesc values.Values,
+) (err error) {
+	//The applier sets the scope resolver of the cluster used to render the chart
+	var a *applier.Applier
+	if o.outFile == "" {
+		a, err = newApplier(o, templateReader, templateProcessorOptions)
+		if err != nil {
+			return err
+		}
+	}
+	templateProcessor, err := templateprocessor.NewTemplateProcessor(templateReader, templateProcessorOptions)
+	if err != nil {
+		return err
+	}
+	if o.delete {
+		templateProcessor.SetDeleteOrder()
+	}
+	rendered, err := templateProcessor.TemplateChart("", &templateprocessor.ChartOptions{
+		Release: templateprocessor.Release{
+			Name:      o.release,
+			Namespace: o.namespace,
+			IsInstall: !o.delete,
+		},
+		Values: valuesc,
+	})
+	if err != nil {
+		return err
+	}
+	if o.outFile != "" {
+		outV, err := templateprocessor.ToYAMLsUnstructured(rendered.Resources)
 		if err != nil {
 			return err
 		}
 		out := templateprocessor.ConvertArrayOfBytesToString(outV)
 		klog.V(1).Infof("result:\n%s", out)
-		return ioutil.WriteFile(filepath.Clean(o.outFile), []byte(templateprocessor.ConvertArrayOfBytesToString(outV)), 0600)
+		err = ioutil.WriteFile(filepath.Clean(o.outFile), []byte(out), 0600)
+		if err != nil {
+			return err
+		}
+	} else {
+		if o.delete {
+			err = a.Deletes(rendered.Resources)
+		} else {
+			err = a.CreateOrUpdates(rendered.Resources)
+		}
+		if err != nil {
+			return err
+		}
 	}
-	client, err := libgoclient.NewDefaultClient(o.kubeconfigPath, crclient.Options{})
+	if rendered.Notes != "" && !o.delete && !o.silent {
+		fmt.Println(rendered.Notes)
+	}
+	return nil
+}
+
+//listMissingValues prints the values missing for the templates and
+//returns an error if a value which is not guarded is missing
+func listMissingValues(
+	o Option,
+	templateReader templateprocessor.TemplateReader,
+	templateProcessorOptions *templateprocessor.Options,
+	vals Values,
+) error {
+	templateProcessor, err := templateprocessor.NewTemplateProcessor(templateReader, templateProcessorOptions)
 	if err != nil {
 		return err
 	}
+	missing, err := templateProcessor.MissingValuesInPath("", []string{}, true, vals)
+	if err != nil {
+		return err
+	}
+	required := 0
+	for _, m := range missing {
+		fmt.Println(m)
+		if !m.Guarded {
+			required++
+		}
+	}
+	if required != 0 {
+		return fmt.Errorf("%d required values are missing", required)
+	}
+	return nil
+}
+
+//newApplier creates the applier of the kubeconfig cluster
+func newApplier(
+	o Option,
+	templateReader templateprocessor.TemplateReader,
+	templateProcessorOptions *templateprocessor.Options,
+) (*applier.Applier, error) {
+	client, err := libgoclient.NewDefaultClient(o.kubeconfigPath, crclient.Options{})
+	if err != nil {
+		return nil, err
+	}
+	if o.namespace != "" {
+		kubeClient, err := libgoclient.NewDefaultKubeClient(o.kubeconfigPath)
+		if err != nil {
+			return nil, err
+		}
+		templateProcessorOptions.ScopeResolver = templateprocessor.NewDiscoveryScopeResolver(kubeClient.Discovery())
+	}
 	applierOptions := &applier.Options{
 		Backoff: &wait.Backoff{
 			Steps:    4,
@@ -166,23 +415,101 @@ func apply(o Option) (err error) {
 	if o.dryRun {
 		client = crclient.NewDryRunClient(client)
 	}
-	a, err := applier.NewApplier(templateReader,
-		&templateprocessor.Options{},
+	return applier.NewApplier(templateReader,
+		templateProcessorOptions,
 		client,
 		nil,
 		nil,
 		applier.DefaultKubernetesMerger,
 		applierOptions)
+}
+
+func setCapabilities(o Option, templateProcessorOptions *templateprocessor.Options) (err error) {
+	if o.capabilities != "" {
+		templateProcessorOptions.Capabilities, err = templateprocessor.LoadCapabilities(o.capabilities)
+		return err
+	}
+	if !o.discover {
+		return nil
+	}
+	kubeClient, err := libgoclient.NewDefaultKubeClient(o.kubeconfigPath)
 	if err != nil {
 		return err
 	}
-	if o.delete {
-		err = a.DeleteInPath("", nil, true, values)
-	} else {
-		err = a.CreateOrUpdateInPath("", nil, true, values)
+	templateProcessorOptions.Capabilities, err = templateprocessor.NewCapabilities(kubeClient.Discovery())
+	return err
+}
+
+func setPolicy(o Option, templateProcessorOptions *templateprocessor.Options) error {
+	if o.policy == "" {
+		return nil
+	}
+	rules, err := policy.LoadRules(o.policy)
+	if err != nil {
+		return err
 	}
+	validator, err := policy.NewValidator(rules)
 	if err != nil {
 		return err
 	}
+	validator.OnWarning = func(v policy.Violation) {
+		if !o.silent {
+			fmt.Fprintf(os.Stderr, "%s\n", v)
+		}
+	}
+	templateProcessorOptions.Validators = append(templateProcessorOptions.Validators, validator)
+	return nil
+}
+
+func setSchemaValidation(o Option, templateProcessorOptions *templateprocessor.Options) error {
+	if !o.schema {
+		return nil
+	}
+	validator := validation.NewSchemaValidator()
+	if o.openAPI != "" {
+		err := validator.LoadOpenAPISpec(o.openAPI)
+		if err != nil {
+			return err
+		}
+	}
+	if o.crds != "" {
+		err := validator.LoadCRDs(o.crds)
+		if err != nil {
+			return err
+		}
+	}
+	templateProcessorOptions.Validators = append(templateProcessorOptions.Validators, validator)
+	return nil
+}
+
+func setImageRewrite(o Option, templateProcessorOptions *templateprocessor.Options) (err error) {
+	if o.imageRewrite == "" && o.imageDigests == "" {
+		return nil
+	}
+	imageRewrite := &templateprocessor.ImageRewriteConfig{}
+	if o.imageRewrite != "" {
+		imageRewrite, err = templateprocessor.LoadImageRewriteConfig(o.imageRewrite)
+		if err != nil {
+			return err
+		}
+	}
+	if o.imageDigests != "" {
+		digests, err := templateprocessor.LoadImageDigests(o.imageDigests)
+		if err != nil {
+			return err
+		}
+		if imageRewrite.Digests == nil {
+			imageRewrite.Digests = make(map[string]string)
+		}
+		for k, v := range digests {
+			imageRewrite.Digests[k] = v
+		}
+	}
+	templateProcessorOptions.ImageRewrite = imageRewrite
+	templateProcessorOptions.OnImageRewrite = func(rewrite templateprocessor.ImageRewrite) {
+		if !o.silent {
+			fmt.Fprintf(os.Stderr, "Image rewritten: %s\n", rewrite)
+		}
+	}
 	return nil
 }
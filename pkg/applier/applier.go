@@ -8,14 +8,17 @@ import (
 	goerr "errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/stolostron/library-go/pkg/templateprocessor"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/retry"
@@ -58,6 +61,48 @@ type Options struct {
 	DryRun bool
 	//If true, the finalizers will be removed after deletion.
 	ForceDelete bool
+	//Defines what to do when a resource already exists but is not managed by the applier,
+	//a resource is managed if it has an owner reference to the owner or the ManagedByLabel
+	//matching the ManagerName. The owner or the ManagerName must be set to use it.
+	AdoptionPolicy AdoptionPolicy
+	//If set, the ManagedByLabel is set with this value on the created and updated resources.
+	ManagerName string
+	//If true, the status subresource is updated after the create or update when the resource has a status
+	ApplyStatus bool
+	//The kinds on which the status is not applied
+	SkipStatusKinds []string
+	//A merger defining how the current and the new status must be merged, DefaultStatusMerger if not set.
+	StatusMerger Merger
+	//If true, the hash of the rendered resource is stored in the ContentHashAnnotation and the update
+	//is skipped, without calling the merger, when the hash and the generation of the resource are unchanged.
+	ContentHash bool
+	//If true, the update is done even if the ContentHash shows no change.
+	ForceUpdate bool
+	//If set, the resources are read through this reader, for example a controller-runtime cache,
+	//instead of the client. The writes are still done with the client and, on conflict,
+	//the resource is read again with the client.
+	CacheReader client.Reader
+	//If true, CreateOrUpdates and Updates list once each kind and namespace of the resources
+	//at the beginning of the batch and read the resources from these lists.
+	Prefetch bool
+	//If true, CreateOrUpdates reads the live state of the resources before applying them and,
+	//if a resource fails, restores the updated resources and deletes the created ones.
+	//The returned error is then a TransactionError.
+	Transactional bool
+	//If true, CreateOrUpdates, Creates, Updates and Deletes check with CheckPermissions that all the
+	//needed permissions are granted before writing any resource.
+	PreflightPermissions bool
+	//The mapper used to find the resource of a kind in the permission checks,
+	//if not set the resource is guessed from the kind.
+	RESTMapper meta.RESTMapper
+	//If set, the observer is notified of the progress of each resource.
+	ProgressObserver ProgressObserver
+	//If true, the applier waits after each create or update until the resource is ready,
+	//the workloads are ready when their replicas are ready and the other resources
+	//when their Ready, Available or Established condition is True if they have one.
+	WaitForReady bool
+	//The time to wait for a resource to be ready, DefaultReadyTimeout if not set.
+	ReadyTimeout time.Duration
 }
 
 //NewApplier creates a new client to access kubernetes through the applier.
@@ -88,6 +133,16 @@ func NewApplier(
 	if applierOptions.Backoff == nil {
 		applierOptions.Backoff = &retry.DefaultBackoff
 	}
+	if applierOptions.StatusMerger == nil {
+		applierOptions.StatusMerger = DefaultStatusMerger
+	}
+	//The adopted resources are marked as managed with an owner reference, which needs the scheme,
+	//or with the managed-by label
+	if applierOptions.AdoptionPolicy != AdoptionPolicyNone &&
+		(owner == nil || scheme == nil) &&
+		applierOptions.ManagerName == "" {
+		return nil, goerr.New("owner and scheme, or ManagerName, must be set to use an AdoptionPolicy")
+	}
 	return &Applier{
 		templateProcessor: templateProcessor,
 		client:            client,
@@ -148,7 +203,6 @@ var DefaultKubernetesMerger Merger = func(current,
 // recursive: If true all yamls in the path directory and sub-directories will be applied
 // it excludes the assets named in the excluded array
 // it sets the Controller reference if owner and scheme are not nil
-//
 func (a *Applier) CreateOrUpdateInPath(
 	path string,
 	excluded []string,
@@ -175,7 +229,6 @@ func (a *Applier) CreateOrUpdateInPath(
 // recursive: If true all yamls in the path directory and sub-directories will be applied
 // it excludes the assets named in the excluded array
 // it sets the Controller reference if owner and scheme are not nil
-//
 func (a *Applier) CreateInPath(
 	path string,
 	excluded []string,
@@ -202,7 +255,6 @@ func (a *Applier) CreateInPath(
 // recursive: If true all yamls in the path directory and sub-directories will be applied
 // it excludes the assets named in the excluded array
 // it sets the Controller reference if owner and scheme are not nil
-//
 func (a *Applier) UpdateInPath(
 	path string,
 	excluded []string,
@@ -229,7 +281,6 @@ func (a *Applier) UpdateInPath(
 // recursive: If true all yamls in the path directory and sub-directories will be applied
 // it excludes the assets named in the excluded array
 // it sets the Controller reference if owner and scheme are not nil
-//
 func (a *Applier) DeleteInPath(
 	path string,
 	excluded []string,
@@ -304,15 +355,7 @@ func (a *Applier) DeleteResources(
 func (a *Applier) toUnstructureds(assetNames []string,
 	values interface{},
 ) (us []*unstructured.Unstructured, err error) {
-	b, err := a.templateProcessor.TemplateResources(assetNames, values)
-	if err != nil {
-		return nil, err
-	}
-	us, err = a.templateProcessor.BytesArrayToUnstructured(b)
-	if err != nil {
-		return nil, err
-	}
-	return us, err
+	return a.templateProcessor.TemplateResourcesUnstructuredInOrder(assetNames, values)
 }
 
 //CreateorUpdateAsset create or updates an asset
@@ -366,24 +409,39 @@ func (a *Applier) DeleteResource(
 func (a *Applier) toUnstructured(assetName string,
 	values interface{},
 ) (u *unstructured.Unstructured, err error) {
-	b, err := a.templateProcessor.TemplateResource(assetName, values)
+	us, err := a.templateProcessor.TemplateResourcesUnstructuredInOrder([]string{assetName}, values)
 	if err != nil {
 		return nil, err
 	}
-	u, err = a.templateProcessor.BytesToUnstructured(b)
-	if err != nil {
-		return nil, err
+	if len(us) == 0 {
+		return nil, fmt.Errorf("the asset %s doesn't render any resource", assetName)
 	}
-	return u, err
+	return us[0], nil
 }
 
 //CreateOrUpdates an array of unstructured.Unstructured
 func (a *Applier) CreateOrUpdates(
 	us []*unstructured.Unstructured,
+) error {
+	err := a.preflight(us, OperationCreateOrUpdate)
+	if err != nil {
+		return err
+	}
+	a.observeBatch(us, OperationCreateOrUpdate)
+	reader := a.batchReader(us)
+	if a.applierOptions.Transactional && !a.applierOptions.DryRun {
+		return a.transactionalCreateOrUpdates(us, reader)
+	}
+	return a.createOrUpdates(us, reader)
+}
+
+func (a *Applier) createOrUpdates(
+	us []*unstructured.Unstructured,
+	reader lookupReader,
 ) error {
 	//Create the unstructured items if they don't exist yet
 	for _, u := range us {
-		err := a.CreateOrUpdate(u)
+		err := a.createOrUpdate(u, reader)
 		if err != nil {
 			return err
 		}
@@ -394,10 +452,21 @@ func (a *Applier) CreateOrUpdates(
 //Creates create resources from an array of unstructured.Unstructured
 func (a *Applier) Creates(
 	us []*unstructured.Unstructured,
+) error {
+	err := a.preflight(us, OperationCreate)
+	if err != nil {
+		return err
+	}
+	a.observeBatch(us, OperationCreate)
+	return a.creates(us)
+}
+
+func (a *Applier) creates(
+	us []*unstructured.Unstructured,
 ) error {
 	//Create the unstructured items if they don't exist yet
 	for _, u := range us {
-		err := a.Create(u)
+		err := a.create(u)
 		if err != nil {
 			return err
 		}
@@ -408,10 +477,22 @@ func (a *Applier) Creates(
 //Updates updates resources from an array of unstructured.Unstructured
 func (a *Applier) Updates(
 	us []*unstructured.Unstructured,
+) error {
+	err := a.preflight(us, OperationUpdate)
+	if err != nil {
+		return err
+	}
+	a.observeBatch(us, OperationUpdate)
+	return a.updates(us, a.batchReader(us))
+}
+
+func (a *Applier) updates(
+	us []*unstructured.Unstructured,
+	reader lookupReader,
 ) error {
 	//Update the unstructured items if they don't exist yet
 	for _, u := range us {
-		err := a.Update(u)
+		err := a.update(u, reader)
 		if err != nil {
 			return err
 		}
@@ -423,9 +504,20 @@ func (a *Applier) Updates(
 func (a *Applier) Deletes(
 	us []*unstructured.Unstructured,
 ) error {
-	//Update the unstructured items if they don't exist yet
+	err := a.preflight(us, OperationDelete)
+	if err != nil {
+		return err
+	}
+	a.observeBatch(us, OperationDelete)
+	return a.deletes(us)
+}
+
+func (a *Applier) deletes(
+	us []*unstructured.Unstructured,
+) error {
+	//Delete the unstructured items
 	for _, u := range us {
-		err := a.Delete(u)
+		err := a.delete(u)
 		if err != nil {
 			return err
 		}
@@ -439,26 +531,63 @@ func (a *Applier) Deletes(
 func (a *Applier) CreateOrUpdate(
 	u *unstructured.Unstructured,
 ) error {
+	return a.createOrUpdate(u, a.reader())
+}
+
+func (a *Applier) createOrUpdate(
+	u *unstructured.Unstructured,
+	reader lookupReader,
+) error {
+	//Expand the kubernetes lists into their items, the items are observed and not the list
+	if templateprocessor.IsList(u) {
+		items, err := templateprocessor.ExpandList(u)
+		if err != nil {
+			return err
+		}
+		return a.createOrUpdates(items, reader)
+	}
+	return a.observe(u, OperationCreateOrUpdate, func() (Action, error) {
+		return a.applyCreateOrUpdate(u, reader)
+	})
+}
+
+func (a *Applier) applyCreateOrUpdate(
+	u *unstructured.Unstructured,
+	reader lookupReader,
+) (Action, error) {
 
 	klog.V(2).Info("Create or update: ",
 		" Kind: ", u.GetKind(),
 		" Name: ", u.GetName(),
 		" Namespace: ", u.GetNamespace())
 	if u.GetKind() == "" {
-		return fmt.Errorf("Kind is missing for Name: %s, Namespace: %s", u.GetName(), u.GetNamespace())
+		return ActionFailed, fmt.Errorf("Kind is missing for Name: %s, Namespace: %s", u.GetName(), u.GetNamespace())
+	}
+	//Search the resource by its identity label if it is rendered with a generateName
+	err := a.resolveGenerateName(u)
+	if err != nil {
+		return ActionFailed, err
+	}
+	if isGenerateName(u) {
+		klog.V(2).Info("Create: ",
+			" Kind: ", u.GetKind(),
+			" GenerateName: ", u.GetGenerateName(),
+			" Namespace: ", u.GetNamespace())
+		return a.applyCreate(u)
 	}
 
 	//Check if already exists
 	current := &unstructured.Unstructured{}
 	current.SetGroupVersionKind(u.GroupVersionKind())
 	errGet := retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
-		if err != nil {
+		if err != nil && !errors.IsNotFound(err) {
 			klog.V(2).Infof("Retry Get %s", err)
+			a.observeRetry(u, err)
 			return true
 		}
 		return false
 	}, func() error {
-		err := a.client.Get(context.TODO(),
+		err := reader.Get(context.TODO(),
 			types.NamespacedName{Name: u.GetName(), Namespace: u.GetNamespace()},
 			current)
 		if err != nil {
@@ -472,16 +601,22 @@ func (a *Applier) CreateOrUpdate(
 				" Kind: ", u.GetKind(),
 				" Name: ", u.GetName(),
 				" Namespace: ", u.GetNamespace())
-			return a.Create(u)
+			action, err := a.applyCreate(u)
+			//The cached read can miss a resource created since
+			if errors.IsAlreadyExists(err) && reader.cached {
+				klog.V(2).Infof("Resource already exists, read it again with the client")
+				return a.applyUpdate(u, a.clientReader())
+			}
+			return action, err
 		} else {
-			return errGet
+			return ActionFailed, errGet
 		}
 	} else {
 		klog.V(2).Info("Update:",
 			" Kind: ", current.GetKind(),
 			" Name: ", current.GetName(),
 			" Namespace: ", current.GetNamespace())
-		return a.Update(u)
+		return a.applyUpdate(u, reader)
 	}
 }
 
@@ -489,19 +624,55 @@ func (a *Applier) CreateOrUpdate(
 func (a *Applier) Create(
 	u *unstructured.Unstructured,
 ) error {
+	return a.create(u)
+}
+
+func (a *Applier) create(
+	u *unstructured.Unstructured,
+) error {
+	//Expand the kubernetes lists into their items, the items are observed and not the list
+	if templateprocessor.IsList(u) {
+		items, err := templateprocessor.ExpandList(u)
+		if err != nil {
+			return err
+		}
+		return a.creates(items)
+	}
+	return a.observe(u, OperationCreate, func() (Action, error) {
+		return a.applyCreate(u)
+	})
+}
+
+func (a *Applier) applyCreate(
+	u *unstructured.Unstructured,
+) (Action, error) {
 
 	klog.V(2).Info("Create: ",
 		" Kind: ", u.GetKind(),
 		" Name: ", u.GetName(),
 		" Namespace: ", u.GetNamespace())
 	if u.GetKind() == "" {
-		return fmt.Errorf("Kind is missing for Name: %s, Namespace: %s", u.GetName(), u.GetNamespace())
+		return ActionFailed, fmt.Errorf("Kind is missing for Name: %s, Namespace: %s", u.GetName(), u.GetNamespace())
+	}
+	//Set the identity label if the resource is rendered with a generateName
+	if isGenerateName(u) {
+		setGenerateNameIdentity(u)
 	}
 	//Set controller ref
 	err := a.setControllerReference(u)
 	if err != nil {
-		return err
+		return ActionFailed, err
 	}
+	a.setManagedByLabel(u)
+	if a.applierOptions.ContentHash {
+		hash, err := contentHash(u)
+		if err != nil {
+			return ActionFailed, err
+		}
+		setContentHash(u, hash, expectedGeneration(nil, u))
+	}
+	//The status is dropped by the create
+	status := u.Object["status"]
 	var clientCreateOptions []client.CreateOption
 	if a.applierOptions != nil {
 		clientCreateOptions = a.applierOptions.ClientCreateOption
@@ -516,6 +687,7 @@ func (a *Applier) Create(
 	err = retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
 		if err != nil {
 			klog.V(2).Infof("Retry create %s", err)
+			a.observeRetry(u, err)
 			return true
 		}
 		return false
@@ -531,10 +703,15 @@ func (a *Applier) Create(
 			" Kind: ", u.GetKind(),
 			" Name: ", u.GetName(),
 			" Namespace: ", u.GetNamespace())
-		return err
+		return ActionFailed, err
+	}
+	//The resource is created even if the applied generation or the status fail
+	err = a.recordAppliedGeneration(u)
+	if err != nil {
+		return ActionCreated, err
 	}
 
-	return nil
+	return ActionCreated, a.applyStatus(u, status)
 }
 
 //Update updates an unstructured object.
@@ -543,18 +720,62 @@ func (a *Applier) Create(
 func (a *Applier) Update(
 	u *unstructured.Unstructured,
 ) error {
+	return a.update(u, a.reader())
+}
+
+func (a *Applier) update(
+	u *unstructured.Unstructured,
+	reader lookupReader,
+) error {
+	//Expand the kubernetes lists into their items, the items are observed and not the list
+	if templateprocessor.IsList(u) {
+		items, err := templateprocessor.ExpandList(u)
+		if err != nil {
+			return err
+		}
+		return a.updates(items, reader)
+	}
+	return a.observe(u, OperationUpdate, func() (Action, error) {
+		return a.applyUpdate(u, reader)
+	})
+}
+
+func (a *Applier) applyUpdate(
+	u *unstructured.Unstructured,
+	reader lookupReader,
+) (Action, error) {
 
 	klog.V(2).Info("Update: ",
 		" Kind: ", u.GetKind(),
 		" Name: ", u.GetName(),
 		" Namespace: ", u.GetNamespace())
 	if u.GetKind() == "" {
-		return fmt.Errorf("Kind is missing for Name: %s, Namespace: %s", u.GetName(), u.GetNamespace())
+		return ActionFailed, fmt.Errorf("Kind is missing for Name: %s, Namespace: %s", u.GetName(), u.GetNamespace())
+	}
+	//Search the resource by its identity label if it is rendered with a generateName
+	err := a.resolveGenerateName(u)
+	if err != nil {
+		return ActionFailed, err
+	}
+	if isGenerateName(u) {
+		return ActionFailed, errors.NewNotFound(schema.GroupResource{
+			Group:    u.GroupVersionKind().Group,
+			Resource: u.GetKind(),
+		}, u.GetGenerateName())
 	}
 	//Set controller ref
-	err := a.setControllerReference(u)
+	err = a.setControllerReference(u)
 	if err != nil {
-		return err
+		return ActionFailed, err
+	}
+	//The hash is computed on the same metadata as in applyCreate
+	a.setManagedByLabel(u)
+	var hash string
+	if a.applierOptions.ContentHash {
+		hash, err = contentHash(u)
+		if err != nil {
+			return ActionFailed, err
+		}
 	}
 
 	//Check if already exists
@@ -563,11 +784,12 @@ func (a *Applier) Update(
 	errGet := retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
 		if err != nil {
 			klog.V(2).Infof("Retry Get %s", err)
+			a.observeRetry(u, err)
 			return true
 		}
 		return false
 	}, func() error {
-		err := a.client.Get(context.TODO(),
+		err := reader.Get(context.TODO(),
 			types.NamespacedName{Name: u.GetName(), Namespace: u.GetNamespace()},
 			current)
 		if err != nil {
@@ -575,21 +797,58 @@ func (a *Applier) Update(
 		}
 		return err
 	})
+	if errors.IsNotFound(errGet) && reader.cached {
+		klog.V(2).Infof("Resource not found in cache, read it again with the client")
+		return a.applyUpdate(u, a.clientReader())
+	}
 	if errGet != nil {
 		klog.V(2).Info("Unable to update:", "Error", err,
 			" Kind: ", u.GetKind(),
 			" Name: ", u.GetName(),
 			" Namespace: ", u.GetNamespace())
-		return errGet
+		return ActionFailed, errGet
 	} else {
+		//The ownership is checked before the content hash, an unmanaged resource is never unchanged
+		skip, err := a.checkOwnership(current)
+		if err != nil {
+			return ActionFailed, err
+		}
+		if skip {
+			return ActionSkipped, nil
+		}
+		adopt := a.applierOptions.AdoptionPolicy == AdoptionPolicyAdopt && !a.isManaged(current)
+		if hash != "" && !a.applierOptions.ForceUpdate && !adopt && isUnchanged(current, hash) {
+			klog.V(2).Info("No update needed, content hash unchanged")
+			return ActionUnchanged, nil
+		}
 		if a.merger == nil {
-			return fmt.Errorf("Unable to update %s/%s of Kind %s the merger is nil",
+			return ActionFailed, fmt.Errorf("Unable to update %s/%s of Kind %s the merger is nil",
 				current.GetKind(),
 				current.GetNamespace(),
 				current.GetName())
 		}
+		//The merger can change the current resource
+		original := current.DeepCopy()
 		future, update := a.merger(current, u)
+		if adopt {
+			err = a.adopt(future)
+			if err != nil {
+				return ActionFailed, err
+			}
+			update = true
+		} else if a.setManagedByLabel(future) {
+			update = true
+		}
+		//The common labels and annotations injected by the template processor are not merged by the merger
+		if a.templateProcessor.MergeCommonMetadata(future, u) {
+			update = true
+		}
+		if hash != "" && setContentHash(future, hash, expectedGeneration(original, future)) {
+			update = true
+		}
+		action := ActionUnchanged
 		if update {
+			action = ActionUpdated
 			var clientUpdateOptions []client.UpdateOption
 			if a.applierOptions != nil {
 				clientUpdateOptions = a.applierOptions.ClientUpdateOption
@@ -602,8 +861,13 @@ func (a *Applier) Update(
 				c = client.NewDryRunClient(c)
 			}
 			err = retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
+				//A conflict on a cached read is solved by reading again with the client
+				if errors.IsConflict(err) && reader.cached {
+					return false
+				}
 				if err != nil {
 					klog.V(2).Infof("Retry update %s", err)
+					a.observeRetry(u, err)
 					return true
 				}
 				return false
@@ -614,18 +878,26 @@ func (a *Applier) Update(
 				}
 				return err
 			})
+			if errors.IsConflict(err) && reader.cached {
+				klog.V(2).Infof("Conflict on a cached read, read it again with the client")
+				return a.applyUpdate(u, a.clientReader())
+			}
 			if err != nil {
 				klog.V(2).Info("Unable to update:", "Error", err,
 					" Kind: ", u.GetKind(),
 					" Name: ", u.GetName(),
 					" Namespace: ", u.GetNamespace())
-				return err
+				return ActionFailed, err
+			}
+			err = a.recordAppliedGeneration(future)
+			if err != nil {
+				return ActionFailed, err
 			}
 		} else {
 			klog.V(2).Info("No update needed")
 		}
+		return action, a.applyStatus(future, u.Object["status"])
 	}
-	return nil
 
 }
 
@@ -633,13 +905,47 @@ func (a *Applier) Update(
 func (a *Applier) Delete(
 	u *unstructured.Unstructured,
 ) error {
+	return a.delete(u)
+}
+
+func (a *Applier) delete(
+	u *unstructured.Unstructured,
+) error {
+	//Expand the kubernetes lists into their items, the items are observed and not the list
+	if templateprocessor.IsList(u) {
+		items, err := templateprocessor.ExpandList(u)
+		if err != nil {
+			return err
+		}
+		return a.deletes(items)
+	}
+	return a.observe(u, OperationDelete, func() (Action, error) {
+		return a.applyDelete(u)
+	})
+}
+
+func (a *Applier) applyDelete(
+	u *unstructured.Unstructured,
+) (Action, error) {
 
 	klog.V(2).Info("Delete: ",
 		" Kind: ", u.GetKind(),
 		" Name: ", u.GetName(),
 		" Namespace: ", u.GetNamespace())
 	if u.GetKind() == "" {
-		return fmt.Errorf("Kind is missing for Name: %s, Namespace: %s", u.GetName(), u.GetNamespace())
+		return ActionFailed, fmt.Errorf("Kind is missing for Name: %s, Namespace: %s", u.GetName(), u.GetNamespace())
+	}
+	//Search the resource by its identity label if it is rendered with a generateName
+	err := a.resolveGenerateName(u)
+	if err != nil {
+		return ActionFailed, err
+	}
+	if isGenerateName(u) {
+		klog.V(2).Info("Nothing to delete: ",
+			" Kind: ", u.GetKind(),
+			" GenerateName: ", u.GetGenerateName(),
+			" Namespace: ", u.GetNamespace())
+		return ActionUnchanged, nil
 	}
 	var clientDeleteOptions []client.DeleteOption
 	if a.applierOptions != nil {
@@ -652,9 +958,10 @@ func (a *Applier) Delete(
 		printUnstructure(u)
 		c = client.NewDryRunClient(c)
 	}
-	err := retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
+	err = retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
 		if err != nil && !errors.IsNotFound(err) {
 			klog.V(2).Infof("Retry delete %s", err)
+			a.observeRetry(u, err)
 			return true
 		}
 		return false
@@ -665,12 +972,16 @@ func (a *Applier) Delete(
 		}
 		return err
 	})
+	action := ActionDeleted
+	if errors.IsNotFound(err) {
+		action = ActionUnchanged
+	}
 	if err != nil && !errors.IsNotFound(err) {
 		klog.V(2).Info("Unable to delete:", "Error", err,
 			" Kind: ", u.GetKind(),
 			" Name: ", u.GetName(),
 			" Namespace: ", u.GetNamespace())
-		return err
+		return ActionFailed, err
 	}
 	if a.applierOptions.ForceDelete &&
 		u.GetKind() != reflect.TypeOf(apiextensions.CustomResourceDefinition{}).Name() &&
@@ -685,6 +996,7 @@ func (a *Applier) Delete(
 		err := retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
 			if err != nil && !errors.IsNotFound(err) {
 				klog.V(2).Infof("Retry removing finalizers %s", err)
+				a.observeRetry(u, err)
 				return true
 			}
 			return false
@@ -700,10 +1012,10 @@ func (a *Applier) Delete(
 				" Kind: ", u.GetKind(),
 				" Name: ", u.GetName(),
 				" Namespace: ", u.GetNamespace())
-			return err
+			return ActionFailed, err
 		}
 	}
-	return nil
+	return action, nil
 }
 
 func printUnstructure(u *unstructured.Unstructured) {
@@ -722,6 +1034,9 @@ func (a *Applier) setControllerReference(
 			klog.Error(err, "Failed to SetControllerReference: ",
 				" Name: ", u.GetName(),
 				" Namespace: ", u.GetNamespace())
+			if _, ok := err.(*controllerutil.AlreadyOwnedError); ok {
+				return newOwnershipError(u)
+			}
 			return err
 		}
 	}
@@ -862,3 +862,91 @@ func TestApplier_CreateOrUpdateResource(t *testing.T) {
 		})
 	}
 }
+
+func TestApplier_CreateOrUpdateResource_CommonMetadata(t *testing.T) {
+	client := fake.NewFakeClient()
+	reader := templateprocessor.NewTestReader(assets)
+	apply := func(labels, annotations map[string]string) {
+		a, err := NewApplier(reader,
+			&templateprocessor.Options{CommonLabels: labels, CommonAnnotations: annotations},
+			client, nil, nil, DefaultKubernetesMerger, nil)
+		if err != nil {
+			t.Fatalf("Unable to create applier %s", err.Error())
+		}
+		err = a.CreateOrUpdateResource("test/serviceaccount", values)
+		if err != nil {
+			t.Fatalf("Unable to apply %s", err.Error())
+		}
+	}
+	apply(map[string]string{"team": "a"}, map[string]string{"note": "first"})
+	//The changed common labels and annotations reach the existing resource
+	apply(map[string]string{"team": "b", "tier": "backend"}, map[string]string{"note": "second"})
+	sa := &corev1.ServiceAccount{}
+	err := client.Get(context.TODO(), types.NamespacedName{
+		Name:      values.BootstrapServiceAccountName,
+		Namespace: values.ManagedClusterNamespace,
+	}, sa)
+	if err != nil {
+		t.Fatalf("Unable to get the service account %s", err.Error())
+	}
+	if sa.Labels["team"] != "b" || sa.Labels["tier"] != "backend" {
+		t.Errorf("Expected the common labels to be updated, got %v", sa.Labels)
+	}
+	if sa.Annotations["note"] != "second" {
+		t.Errorf("Expected the common annotations to be updated, got %v", sa.Annotations)
+	}
+}
+
+func TestApplier_CreateOrUpdateResources_DecodeError(t *testing.T) {
+	reader := templateprocessor.NewTestReader(map[string]string{
+		"decode/first": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  namespace: default`,
+		"decode/second": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  namespace: default
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+   namespace: default`,
+	})
+	a, err := NewApplier(reader, nil, fake.NewFakeClient(), nil, nil, DefaultKubernetesMerger, nil)
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	tests := []struct {
+		name  string
+		apply func() error
+	}{
+		{
+			name:  "resources",
+			apply: func() error { return a.CreateOrUpdateResources([]string{"decode/first", "decode/second"}, nil) },
+		},
+		{
+			name:  "resource",
+			apply: func() error { return a.CreateOrUpdateResource("decode/second", nil) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.apply()
+			if !templateprocessor.IsRenderError(err) {
+				t.Fatalf("Expected a RenderError, got %v", err)
+			}
+			got := err.(*templateprocessor.RenderError)
+			if got.Phase != templateprocessor.RenderPhaseDecode ||
+				got.Template != "decode/second" ||
+				got.Document != 1 ||
+				got.Line != 11 {
+				t.Errorf("Expected a decode error in decode/second document 1 line 11, got %s %s document %d line %d",
+					got.Phase, got.Template, got.Document, got.Line)
+			}
+		})
+	}
+}
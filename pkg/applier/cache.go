@@ -0,0 +1,171 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"strings"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//lookupReader is the reader of the lookups, cached is true if it can return stale objects
+type lookupReader struct {
+	client.Reader
+	cached bool
+}
+
+//reader returns the reader to use for the lookups, the Options.CacheReader if set or the client
+func (a *Applier) reader() lookupReader {
+	if a.applierOptions.CacheReader != nil {
+		return lookupReader{Reader: a.applierOptions.CacheReader, cached: true}
+	}
+	return a.clientReader()
+}
+
+//clientReader returns the client as lookup reader
+func (a *Applier) clientReader() lookupReader {
+	return lookupReader{Reader: a.client}
+}
+
+//batchReader returns the reader to use for a batch of resources,
+//the resources are prefetched if Options.Prefetch is true.
+func (a *Applier) batchReader(us []*unstructured.Unstructured) lookupReader {
+	if !a.applierOptions.Prefetch {
+		return a.reader()
+	}
+	return lookupReader{Reader: a.prefetch(us, a.reader()), cached: true}
+}
+
+//batchKey identifies a prefetched list
+type batchKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+}
+
+//batchReader serves the lookups from lists fetched once at the beginning of a batch,
+//the lookups of kinds and namespaces which are not prefetched are delegated.
+type batchReader struct {
+	lists    map[batchKey][]unstructured.Unstructured
+	delegate client.Reader
+}
+
+var _ client.Reader = &batchReader{}
+
+//prefetch lists once each kind and namespace of the resources and returns a reader serving them.
+//A kind which can not be listed is read through the delegate.
+func (a *Applier) prefetch(us []*unstructured.Unstructured, delegate client.Reader) client.Reader {
+	r := &batchReader{
+		lists:    make(map[batchKey][]unstructured.Unstructured),
+		delegate: delegate,
+	}
+	failed := make(map[batchKey]bool)
+	for _, u := range expandLists(us) {
+		key := batchKey{gvk: u.GroupVersionKind(), namespace: u.GetNamespace()}
+		if _, ok := r.lists[key]; ok || failed[key] || u.GetKind() == "" {
+			continue
+		}
+		//A namespaced kind listed without namespace would be listed in all namespaces
+		if key.namespace == "" && !a.isClusterScoped(key.gvk) {
+			klog.V(2).Infof("Unable to prefetch %s without namespace, lookups will not be cached", key.gvk.String())
+			failed[key] = true
+			continue
+		}
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(key.gvk.GroupVersion().WithKind(key.gvk.Kind + "List"))
+		err := delegate.List(context.TODO(), list, client.InNamespace(key.namespace))
+		if err != nil {
+			klog.V(2).Infof("Unable to prefetch %s in namespace %s, lookups will not be cached: %s",
+				key.gvk.String(), key.namespace, err)
+			failed[key] = true
+			continue
+		}
+		klog.V(5).Infof("Prefetched %d %s in namespace %s", len(list.Items), key.gvk.String(), key.namespace)
+		r.lists[key] = list.Items
+	}
+	return r
+}
+
+//isClusterScoped returns true if the kind is known to be cluster-scoped by the template processor
+func (a *Applier) isClusterScoped(gvk schema.GroupVersionKind) bool {
+	namespaced, err := a.templateProcessor.IsNamespaced(gvk)
+	return err == nil && !namespaced
+}
+
+//expandLists replaces the kubernetes lists by their items
+func expandLists(us []*unstructured.Unstructured) []*unstructured.Unstructured {
+	expanded := make([]*unstructured.Unstructured, 0, len(us))
+	for _, u := range us {
+		if !templateprocessor.IsList(u) {
+			expanded = append(expanded, u)
+			continue
+		}
+		items, err := templateprocessor.ExpandList(u)
+		if err != nil {
+			//The error is returned when the list is applied
+			continue
+		}
+		expanded = append(expanded, expandLists(items)...)
+	}
+	return expanded
+}
+
+//Get returns the prefetched object or a NotFound error if its kind and namespace were prefetched
+func (r *batchReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return r.delegate.Get(ctx, key, obj)
+	}
+	items, ok := r.lists[batchKey{gvk: u.GroupVersionKind(), namespace: key.Namespace}]
+	if !ok {
+		return r.delegate.Get(ctx, key, obj)
+	}
+	for i := range items {
+		if items[i].GetName() == key.Name {
+			items[i].DeepCopyInto(u)
+			return nil
+		}
+	}
+	return errors.NewNotFound(schema.GroupResource{
+		Group:    u.GroupVersionKind().Group,
+		Resource: u.GetKind(),
+	}, key.Name)
+}
+
+//List returns the prefetched objects matching the label selector if the kind and namespace were prefetched
+func (r *batchReader) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	ul, ok := list.(*unstructured.UnstructuredList)
+	if !ok {
+		return r.delegate.List(ctx, list, opts...)
+	}
+	listOptions := &client.ListOptions{}
+	listOptions.ApplyOptions(opts)
+	gvk := ul.GroupVersionKind()
+	if !strings.HasSuffix(gvk.Kind, "List") || listOptions.FieldSelector != nil {
+		return r.delegate.List(ctx, list, opts...)
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	items, ok := r.lists[batchKey{gvk: gvk, namespace: listOptions.Namespace}]
+	if !ok {
+		return r.delegate.List(ctx, list, opts...)
+	}
+	selector := listOptions.LabelSelector
+	if selector == nil {
+		selector = labels.Everything()
+	}
+	ul.Items = make([]unstructured.Unstructured, 0)
+	for i := range items {
+		if selector.Matches(labels.Set(items[i].GetLabels())) {
+			ul.Items = append(ul.Items, *items[i].DeepCopy())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+//countingClient counts the reads done through the client
+type countingClient struct {
+	crclient.Client
+	gets  int
+	lists int
+}
+
+func (c *countingClient) Get(ctx context.Context, key crclient.ObjectKey, obj runtime.Object) error {
+	c.gets++
+	return c.Client.Get(ctx, key, obj)
+}
+
+func (c *countingClient) List(ctx context.Context, list runtime.Object, opts ...crclient.ListOption) error {
+	c.lists++
+	return c.Client.List(ctx, list, opts...)
+}
+
+func newBootstrapJobScheme() *runtime.Scheme {
+	testscheme := runtime.NewScheme()
+	testscheme.AddKnownTypeWithName(bootstrapJobGVK, &unstructured.Unstructured{})
+	testscheme.AddKnownTypeWithName(bootstrapJobGVK.GroupVersion().WithKind("BootstrapJobList"),
+		&unstructured.UnstructuredList{})
+	return testscheme
+}
+
+func newNamedBootstrapJob(name, cluster string) *unstructured.Unstructured {
+	u := newBootstrapJob(nil)
+	u.SetName(name)
+	u.Object["spec"] = map[string]interface{}{"cluster": cluster}
+	return u
+}
+
+func getBootstrapJobCluster(t *testing.T, client crclient.Client, name string) string {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(bootstrapJobGVK)
+	err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: values.ManagedClusterNamespace}, u)
+	if err != nil {
+		t.Fatalf("Unable to get %s %s", name, err.Error())
+	}
+	cluster, _, _ := unstructured.NestedString(u.Object, "spec", "cluster")
+	return cluster
+}
+
+func TestApplier_CreateOrUpdates_Prefetch(t *testing.T) {
+	existing := []runtime.Object{}
+	for i := 0; i < 3; i++ {
+		existing = append(existing, newNamedBootstrapJob(fmt.Sprintf("job%d", i), "old"))
+	}
+	client := &countingClient{Client: fake.NewFakeClientWithScheme(newBootstrapJobScheme(), existing...)}
+	a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+		DefaultKubernetesMerger, &Options{Prefetch: true})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	us := []*unstructured.Unstructured{}
+	for i := 0; i < 5; i++ {
+		us = append(us, newNamedBootstrapJob(fmt.Sprintf("job%d", i), "new"))
+	}
+	err = a.CreateOrUpdates(us)
+	if err != nil {
+		t.Fatalf("Unable to create or update %s", err.Error())
+	}
+	if client.gets != 0 || client.lists != 1 {
+		t.Errorf("Expected 0 get and 1 list, got %d gets and %d lists", client.gets, client.lists)
+	}
+	for i := 0; i < 5; i++ {
+		if cluster := getBootstrapJobCluster(t, client, fmt.Sprintf("job%d", i)); cluster != "new" {
+			t.Errorf("Expected cluster new for job%d, got %s", i, cluster)
+		}
+	}
+}
+
+func TestApplier_CreateOrUpdate_CacheReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		cached []runtime.Object
+	}{
+		{
+			name:   "up to date cache",
+			cached: nil,
+		},
+		{
+			name: "stale cache conflict",
+			cached: []runtime.Object{
+				func() runtime.Object {
+					u := newNamedBootstrapJob("job0", "old")
+					u.SetResourceVersion("999")
+					return u
+				}(),
+			},
+		},
+		{
+			name:   "resource missing in cache",
+			cached: []runtime.Object{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewFakeClientWithScheme(newBootstrapJobScheme(), newNamedBootstrapJob("job0", "old"))
+			var cache crclient.Reader = client
+			if tt.cached != nil {
+				cache = fake.NewFakeClientWithScheme(newBootstrapJobScheme(), tt.cached...)
+			}
+			a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+				DefaultKubernetesMerger, &Options{CacheReader: cache})
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			err = a.CreateOrUpdate(newNamedBootstrapJob("job0", "new"))
+			if err != nil {
+				t.Fatalf("Unable to create or update %s", err.Error())
+			}
+			if cluster := getBootstrapJobCluster(t, client, "job0"); cluster != "new" {
+				t.Errorf("Expected cluster new, got %s", cluster)
+			}
+		})
+	}
+}
+
+//uncomparableClient is a client whose dynamic type can not be compared
+type uncomparableClient struct {
+	crclient.Client
+	_ []string
+}
+
+func TestApplier_CreateOrUpdate_UncomparableClient(t *testing.T) {
+	client := uncomparableClient{Client: fake.NewFakeClientWithScheme(newBootstrapJobScheme())}
+	cache := fake.NewFakeClientWithScheme(newBootstrapJobScheme())
+	a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+		DefaultKubernetesMerger, &Options{CacheReader: cache})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		err = a.CreateOrUpdate(newNamedBootstrapJob("job0", "new"))
+		if err != nil {
+			t.Fatalf("Unable to create or update %s", err.Error())
+		}
+	}
+	if cluster := getBootstrapJobCluster(t, client, "job0"); cluster != "new" {
+		t.Errorf("Expected cluster new, got %s", cluster)
+	}
+}
+
+func TestApplier_CreateOrUpdates_PrefetchWithoutNamespace(t *testing.T) {
+	newConfigMap := func(namespace, data string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind("ConfigMap")
+		u.SetName("config")
+		u.SetNamespace(namespace)
+		u.Object["data"] = map[string]interface{}{"value": data}
+		return u
+	}
+	newClusterRole := func() *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("rbac.authorization.k8s.io/v1")
+		u.SetKind("ClusterRole")
+		u.SetName("role")
+		return u
+	}
+	tests := []struct {
+		name      string
+		us        []*unstructured.Unstructured
+		wantLists int
+	}{
+		//The ConfigMap of the other namespace must not be taken for the applied one
+		{name: "namespaced", us: []*unstructured.Unstructured{newConfigMap("", "new")}, wantLists: 0},
+		{name: "cluster-scoped", us: []*unstructured.Unstructured{newClusterRole()}, wantLists: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &countingClient{Client: fake.NewFakeClient(newConfigMap("other", "old"))}
+			a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+				DefaultKubernetesMerger, &Options{Prefetch: true})
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			err = a.CreateOrUpdates(tt.us)
+			if err != nil {
+				t.Fatalf("Unable to create or update %s", err.Error())
+			}
+			if client.lists != tt.wantLists {
+				t.Errorf("Expected %d lists, got %d", tt.wantLists, client.lists)
+			}
+			other := &unstructured.Unstructured{}
+			other.SetAPIVersion("v1")
+			other.SetKind("ConfigMap")
+			err = client.Get(context.TODO(), types.NamespacedName{Name: "config", Namespace: "other"}, other)
+			if err != nil {
+				t.Fatalf("Unable to get the config map %s", err.Error())
+			}
+			if value, _, _ := unstructured.NestedString(other.Object, "data", "value"); value != "old" {
+				t.Errorf("Expected the config map of the other namespace to be unchanged, got %s", value)
+			}
+		})
+	}
+}
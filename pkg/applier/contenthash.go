@@ -0,0 +1,136 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//ContentHashAnnotation is the annotation in which the applier stores the hash of the rendered resource
+//when Options.ContentHash is true.
+const ContentHashAnnotation = "applier.open-cluster-management.io/content-hash"
+
+//AppliedGenerationAnnotation is the annotation in which the applier stores the generation
+//of the resource after its last create or update when Options.ContentHash is true.
+const AppliedGenerationAnnotation = "applier.open-cluster-management.io/applied-generation"
+
+//contentHash returns the hash of the rendered resource, the applier annotations are ignored
+//as well as the name generated by the server for a resource rendered with a generateName.
+//It must be called once the applier metadata, the controller reference and the labels, is set.
+func contentHash(u *unstructured.Unstructured) (string, error) {
+	c := u.DeepCopy()
+	if c.GetGenerateName() != "" {
+		c.SetName("")
+	}
+	annotations := c.GetAnnotations()
+	delete(annotations, ContentHashAnnotation)
+	delete(annotations, AppliedGenerationAnnotation)
+	c.SetAnnotations(annotations)
+	b, err := json.Marshal(c.Object)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+//isUnchanged returns true if the hash and the generation stored on the current resource
+//match the hash of the rendered resource and the current generation
+func isUnchanged(current *unstructured.Unstructured, hash string) bool {
+	annotations := current.GetAnnotations()
+	return annotations[ContentHashAnnotation] == hash &&
+		annotations[AppliedGenerationAnnotation] == strconv.FormatInt(current.GetGeneration(), 10)
+}
+
+//setContentHash sets the hash and the generation annotations,
+//it returns true if one of them changed
+func setContentHash(u *unstructured.Unstructured, hash string, generation int64) bool {
+	annotations := u.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	g := strconv.FormatInt(generation, 10)
+	if annotations[ContentHashAnnotation] == hash && annotations[AppliedGenerationAnnotation] == g {
+		return false
+	}
+	annotations[ContentHashAnnotation] = hash
+	annotations[AppliedGenerationAnnotation] = g
+	u.SetAnnotations(annotations)
+	return true
+}
+
+//expectedGeneration returns the generation the resource will have once written,
+//the generation is incremented by a change of the resource outside of its metadata and status.
+//current is the resource before the merge, nil for a create, the server sets the generation to 1 of the resources having a spec.
+func expectedGeneration(current, future *unstructured.Unstructured) int64 {
+	if current == nil {
+		if _, ok := future.Object["spec"]; ok {
+			return 1
+		}
+		return 0
+	}
+	if current.GetGeneration() == 0 || equality.Semantic.DeepEqual(content(current), content(future)) {
+		return current.GetGeneration()
+	}
+	return current.GetGeneration() + 1
+}
+
+//content returns the fields of the resource which change its generation
+func content(u *unstructured.Unstructured) map[string]interface{} {
+	c := make(map[string]interface{}, len(u.Object))
+	for k, v := range u.Object {
+		if k != "metadata" && k != "status" {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+//recordAppliedGeneration patches the AppliedGenerationAnnotation with the generation of the written resource
+//if it is not the expected one. As a metadata change doesn't change the generation, one patch is enough.
+func (a *Applier) recordAppliedGeneration(u *unstructured.Unstructured) error {
+	if !a.applierOptions.ContentHash || a.applierOptions.DryRun {
+		return nil
+	}
+	generation := strconv.FormatInt(u.GetGeneration(), 10)
+	if u.GetAnnotations()[AppliedGenerationAnnotation] == generation {
+		return nil
+	}
+	klog.V(2).Info("Record applied generation: ",
+		" Kind: ", u.GetKind(),
+		" Name: ", u.GetName(),
+		" Namespace: ", u.GetNamespace(),
+		" Generation: ", generation)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{AppliedGenerationAnnotation: generation},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
+		if err != nil {
+			klog.V(2).Infof("Retry patch %s", err)
+			a.observeRetry(u, err)
+			return true
+		}
+		return false
+	}, func() error {
+		err := a.client.Patch(context.TODO(), u, client.RawPatch(types.MergePatchType, patch))
+		if err != nil {
+			klog.V(2).Infof("Error while recording applied generation %s", err)
+		}
+		return err
+	})
+}
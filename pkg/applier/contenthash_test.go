@@ -0,0 +1,287 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var contentHashAssets = map[string]string{
+	"contenthash/serviceaccount": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: "{{ .BootstrapServiceAccountName }}"
+  namespace: "{{ .ManagedClusterNamespace }}"
+secrets:
+- name: {{ .ManagedClusterName }}`,
+}
+
+func TestApplier_CreateOrUpdateResource_ContentHash(t *testing.T) {
+	mergerCalls := 0
+	var countingMerger Merger = func(current, new *unstructured.Unstructured) (*unstructured.Unstructured, bool) {
+		mergerCalls++
+		return DefaultKubernetesMerger(current, new)
+	}
+	client := fake.NewFakeClient()
+	reader := templateprocessor.NewTestReader(contentHashAssets)
+	a, err := NewApplier(reader, nil, client, nil, nil, countingMerger, &Options{ContentHash: true})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	aForce, err := NewApplier(reader, nil, client, nil, nil, countingMerger,
+		&Options{ContentHash: true, ForceUpdate: true})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	getSA := func() *corev1.ServiceAccount {
+		sa := &corev1.ServiceAccount{}
+		err := client.Get(context.TODO(), types.NamespacedName{
+			Name:      values.BootstrapServiceAccountName,
+			Namespace: values.ManagedClusterNamespace,
+		}, sa)
+		if err != nil {
+			t.Fatalf("Unable to get the service account %s", err.Error())
+		}
+		return sa
+	}
+
+	err = a.CreateOrUpdateResource("contenthash/serviceaccount", values)
+	if err != nil {
+		t.Fatalf("Unable to create %s", err.Error())
+	}
+	hash := getSA().Annotations[ContentHashAnnotation]
+	if hash == "" {
+		t.Fatalf("Annotation %s is missing", ContentHashAnnotation)
+	}
+
+	steps := []struct {
+		name            string
+		applier         *Applier
+		values          interface{}
+		generation      int64
+		wantMergerCalls int
+		wantHashChanged bool
+	}{
+		{
+			name:            "unchanged",
+			applier:         a,
+			values:          values,
+			wantMergerCalls: 0,
+		},
+		{
+			name:            "generation moved",
+			applier:         a,
+			values:          values,
+			generation:      5,
+			wantMergerCalls: 1,
+		},
+		{
+			name:            "unchanged after generation recorded",
+			applier:         a,
+			values:          values,
+			wantMergerCalls: 0,
+		},
+		{
+			name:            "forced",
+			applier:         aForce,
+			values:          values,
+			wantMergerCalls: 1,
+		},
+		{
+			name:    "rendered resource changed",
+			applier: a,
+			values: map[string]string{
+				"ManagedClusterName":          "mynewcluster",
+				"ManagedClusterNamespace":     values.ManagedClusterNamespace,
+				"BootstrapServiceAccountName": values.BootstrapServiceAccountName,
+			},
+			wantMergerCalls: 1,
+			wantHashChanged: true,
+		},
+	}
+	for _, step := range steps {
+		if step.generation != 0 {
+			sa := getSA()
+			sa.Generation = step.generation
+			if err := client.Update(context.TODO(), sa); err != nil {
+				t.Fatalf("%s: unable to update generation %s", step.name, err.Error())
+			}
+		}
+		mergerCalls = 0
+		err = step.applier.CreateOrUpdateResource("contenthash/serviceaccount", step.values)
+		if err != nil {
+			t.Errorf("%s: unable to create or update %s", step.name, err.Error())
+		}
+		if mergerCalls != step.wantMergerCalls {
+			t.Errorf("%s: expected %d merger calls, got %d", step.name, step.wantMergerCalls, mergerCalls)
+		}
+		sa := getSA()
+		if (sa.Annotations[ContentHashAnnotation] != hash) != step.wantHashChanged {
+			t.Errorf("%s: expected hash changed %v", step.name, step.wantHashChanged)
+		}
+		if step.generation != 0 && sa.Annotations[AppliedGenerationAnnotation] != "5" {
+			t.Errorf("%s: expected applied generation 5, got %s", step.name, sa.Annotations[AppliedGenerationAnnotation])
+		}
+	}
+}
+
+func TestApplier_CreateOrUpdateResource_ContentHashManagerName(t *testing.T) {
+	mergerCalls := 0
+	var countingMerger Merger = func(current, new *unstructured.Unstructured) (*unstructured.Unstructured, bool) {
+		mergerCalls++
+		return DefaultKubernetesMerger(current, new)
+	}
+	client := fake.NewFakeClient()
+	reader := templateprocessor.NewTestReader(contentHashAssets)
+	a, err := NewApplier(reader, nil, client, nil, nil, countingMerger,
+		&Options{ContentHash: true, ManagerName: "myoperator"})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	err = a.CreateOrUpdateResource("contenthash/serviceaccount", values)
+	if err != nil {
+		t.Fatalf("Unable to create %s", err.Error())
+	}
+	err = a.CreateOrUpdateResource("contenthash/serviceaccount", values)
+	if err != nil {
+		t.Fatalf("Unable to update %s", err.Error())
+	}
+	if mergerCalls != 0 {
+		t.Errorf("Expected the hash of the create to match, got %d merger calls", mergerCalls)
+	}
+}
+
+func Test_contentHash_GeneratedName(t *testing.T) {
+	rendered := &unstructured.Unstructured{}
+	rendered.SetKind("ConfigMap")
+	rendered.SetGenerateName("config-")
+	generated := rendered.DeepCopy()
+	generated.SetName("config-x7k2p")
+	want, err := contentHash(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := contentHash(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Expected the generated name ignored, got %s, want %s", got, want)
+	}
+}
+
+//writeCountingClient counts the writes of the applier
+type writeCountingClient struct {
+	crclient.Client
+	updates int
+	patches int
+}
+
+func (c *writeCountingClient) Update(ctx context.Context, obj runtime.Object, opts ...crclient.UpdateOption) error {
+	c.updates++
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *writeCountingClient) Patch(
+	ctx context.Context,
+	obj runtime.Object,
+	patch crclient.Patch,
+	opts ...crclient.PatchOption,
+) error {
+	c.patches++
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestApplier_CreateOrUpdateResource_ContentHashWrites(t *testing.T) {
+	assets := map[string]string{
+		"contenthash/configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: "{{ .ManagedClusterNamespace }}"
+data:
+  cluster: {{ .ManagedClusterName }}`,
+		"contenthash/job": `
+apiVersion: example.open-cluster-management.io/v1
+kind: BootstrapJob
+metadata:
+  name: job
+  namespace: "{{ .ManagedClusterNamespace }}"
+spec:
+  cluster: {{ .ManagedClusterName }}`,
+	}
+	tests := []struct {
+		name        string
+		asset       string
+		wantPatches int
+	}{
+		{name: "generation as expected", asset: "contenthash/configmap", wantPatches: 0},
+		//The fake client doesn't set the generation of the resources with a spec
+		{name: "generation not as expected", asset: "contenthash/job", wantPatches: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &writeCountingClient{Client: fake.NewFakeClient()}
+			a, err := NewApplier(templateprocessor.NewTestReader(assets), nil, client, nil, nil,
+				DefaultKubernetesMerger, &Options{ContentHash: true})
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			err = a.CreateOrUpdateResource(tt.asset, values)
+			if err != nil {
+				t.Fatalf("Unable to create %s", err.Error())
+			}
+			if client.updates != 0 || client.patches != tt.wantPatches {
+				t.Errorf("Expected 0 update and %d patch, got %d and %d", tt.wantPatches, client.updates, client.patches)
+			}
+			err = a.CreateOrUpdateResource(tt.asset, values)
+			if err != nil {
+				t.Fatalf("Unable to update %s", err.Error())
+			}
+			if client.updates != 0 || client.patches != tt.wantPatches {
+				t.Errorf("Expected no write for an unchanged resource, got %d updates and %d patches",
+					client.updates, client.patches-tt.wantPatches)
+			}
+		})
+	}
+}
+
+func Test_expectedGeneration(t *testing.T) {
+	withSpec := func(generation int64, replicas int64) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"replicas": replicas},
+		}}
+		u.SetGeneration(generation)
+		return u
+	}
+	tests := []struct {
+		name    string
+		current *unstructured.Unstructured
+		future  *unstructured.Unstructured
+		want    int64
+	}{
+		{name: "create with spec", future: withSpec(0, 1), want: 1},
+		{name: "create without spec", future: &unstructured.Unstructured{Object: map[string]interface{}{}}, want: 0},
+		{name: "metadata update", current: withSpec(3, 1), future: withSpec(3, 1), want: 3},
+		{name: "spec update", current: withSpec(3, 1), future: withSpec(3, 2), want: 4},
+		{name: "no generation", current: withSpec(0, 1), future: withSpec(0, 2), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expectedGeneration(tt.current, tt.future); got != tt.want {
+				t.Errorf("expectedGeneration() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//GenerateNameIdentityLabel is the label set by the applier on resources which are rendered
+//with a metadata.generateName and no metadata.name.
+//It allows the applier to find back the generated resource on later calls.
+const GenerateNameIdentityLabel = "applier.open-cluster-management.io/generate-name-identity"
+
+//isGenerateName returns true if the resource must be identified by the GenerateNameIdentityLabel
+func isGenerateName(u *unstructured.Unstructured) bool {
+	return u.GetName() == "" && u.GetGenerateName() != ""
+}
+
+//generateNameIdentity computes a stable identity for a resource rendered with a generateName.
+//The identity is based on the kind, namespace and generateName and so two resources of the same kind
+//with the same generateName in the same namespace will share the same identity.
+func generateNameIdentity(u *unstructured.Unstructured) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s/%s",
+		u.GroupVersionKind().Group,
+		u.GetKind(),
+		u.GetNamespace(),
+		u.GetGenerateName())))
+	//A label value is limited to 63 characters
+	return fmt.Sprintf("%x", h)[:63]
+}
+
+//setGenerateNameIdentity sets the identity label on a resource rendered with a generateName
+//and returns the identity.
+func setGenerateNameIdentity(u *unstructured.Unstructured) string {
+	identity := generateNameIdentity(u)
+	labels := u.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[GenerateNameIdentityLabel] = identity
+	u.SetLabels(labels)
+	return identity
+}
+
+//resolveGenerateName sets the identity label on a resource rendered with a generateName
+//and, if the resource already exists in the cluster, sets its name to the generated one.
+//It returns an error if more than one resource matches the identity.
+//The resources are always listed with the client: as the create of a generated name never fails
+//with an AlreadyExists, a stale cached read would create the resource again.
+func (a *Applier) resolveGenerateName(u *unstructured.Unstructured) error {
+	if !isGenerateName(u) {
+		return nil
+	}
+	identity := setGenerateNameIdentity(u)
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(u.GroupVersionKind().GroupVersion().WithKind(u.GetKind() + "List"))
+	err := retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
+		if err != nil {
+			klog.V(2).Infof("Retry List %s", err)
+			a.observeRetry(u, err)
+			return true
+		}
+		return false
+	}, func() error {
+		err := a.client.List(context.TODO(),
+			list,
+			client.InNamespace(u.GetNamespace()),
+			client.MatchingLabels{GenerateNameIdentityLabel: identity})
+		if err != nil {
+			klog.V(2).Infof("Error while listing %s", err)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	switch len(list.Items) {
+	case 0:
+		klog.V(2).Info("No resource found for generateName: ",
+			" Kind: ", u.GetKind(),
+			" GenerateName: ", u.GetGenerateName(),
+			" Namespace: ", u.GetNamespace())
+	case 1:
+		klog.V(2).Info("Resource found for generateName: ",
+			" Kind: ", u.GetKind(),
+			" GenerateName: ", u.GetGenerateName(),
+			" Name: ", list.Items[0].GetName(),
+			" Namespace: ", u.GetNamespace())
+		u.SetName(list.Items[0].GetName())
+	default:
+		return fmt.Errorf("Found %d resources of Kind %s with generateName %s in namespace %s",
+			len(list.Items),
+			u.GetKind(),
+			u.GetGenerateName(),
+			u.GetNamespace())
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var generateNameAssets = map[string]string{
+	"generatename/job": `
+apiVersion: example.open-cluster-management.io/v1
+kind: BootstrapJob
+metadata:
+  generateName: "{{ .BootstrapServiceAccountName }}-"
+  namespace: "{{ .ManagedClusterNamespace }}"
+spec:
+  cluster: {{ .ManagedClusterName }}`,
+}
+
+var bootstrapJobGVK = schema.GroupVersionKind{
+	Group:   "example.open-cluster-management.io",
+	Version: "v1",
+	Kind:    "BootstrapJob",
+}
+
+func listBootstrapJobs(t *testing.T, client crclient.Client) []unstructured.Unstructured {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(bootstrapJobGVK.GroupVersion().WithKind("BootstrapJobList"))
+	err := client.List(context.TODO(), list, crclient.InNamespace(values.ManagedClusterNamespace))
+	if err != nil {
+		t.Errorf("Unable to list the bootstrap jobs %s", err.Error())
+	}
+	return list.Items
+}
+
+func TestApplier_CreateOrUpdateInPath_GenerateName(t *testing.T) {
+	reader := templateprocessor.NewTestReader(generateNameAssets)
+	testscheme := runtime.NewScheme()
+	testscheme.AddKnownTypeWithName(bootstrapJobGVK, &unstructured.Unstructured{})
+	testscheme.AddKnownTypeWithName(bootstrapJobGVK.GroupVersion().WithKind("BootstrapJobList"),
+		&unstructured.UnstructuredList{})
+	client := fake.NewFakeClientWithScheme(testscheme)
+	a, err := NewApplier(reader, nil, client, nil, nil, DefaultKubernetesMerger, nil)
+	if err != nil {
+		t.Errorf("Unable to create applier %s", err.Error())
+	}
+
+	err = a.CreateOrUpdateInPath("generatename", nil, false, values)
+	if err != nil {
+		t.Errorf("Unable to create or update %s", err.Error())
+	}
+	items := listBootstrapJobs(t, client)
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 bootstrap job after creation, got %d", len(items))
+	}
+	name := items[0].GetName()
+	if _, ok := items[0].GetLabels()[GenerateNameIdentityLabel]; !ok {
+		t.Errorf("Label %s is missing on %s", GenerateNameIdentityLabel, name)
+	}
+
+	newValues := values
+	newValues.ManagedClusterName = "mynewcluster"
+	err = a.CreateOrUpdateInPath("generatename", nil, false, newValues)
+	if err != nil {
+		t.Errorf("Unable to create or update %s", err.Error())
+	}
+	items = listBootstrapJobs(t, client)
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 bootstrap job after update, got %d", len(items))
+	}
+	if items[0].GetName() != name {
+		t.Errorf("Expected bootstrap job %s to be updated, got %s", name, items[0].GetName())
+	}
+	cluster, _, _ := unstructured.NestedString(items[0].Object, "spec", "cluster")
+	if cluster != newValues.ManagedClusterName {
+		t.Errorf("Expected spec.cluster to be updated to %s, got %s", newValues.ManagedClusterName, cluster)
+	}
+
+	err = a.DeleteInPath("generatename", nil, false, values)
+	if err != nil {
+		t.Errorf("Unable to delete %s", err.Error())
+	}
+	items = listBootstrapJobs(t, client)
+	if len(items) != 0 {
+		t.Errorf("Expected no bootstrap job after deletion, got %d", len(items))
+	}
+
+	err = a.DeleteInPath("generatename", nil, false, values)
+	if err != nil {
+		t.Errorf("Deleting an absent generateName resource must not fail %s", err.Error())
+	}
+
+	err = a.UpdateInPath("generatename", nil, false, values)
+	if !errors.IsNotFound(err) {
+		t.Errorf("Expected a not found error when updating an absent resource, got %v", err)
+	}
+}
+
+func TestApplier_CreateOrUpdateInPath_GenerateNameStaleCache(t *testing.T) {
+	reader := templateprocessor.NewTestReader(generateNameAssets)
+	client := fake.NewFakeClientWithScheme(newBootstrapJobScheme())
+	//The cache never sees the created resources
+	cache := fake.NewFakeClientWithScheme(newBootstrapJobScheme())
+	for _, options := range []*Options{{CacheReader: cache}, {CacheReader: cache, Prefetch: true}} {
+		a, err := NewApplier(reader, nil, client, nil, nil, DefaultKubernetesMerger, options)
+		if err != nil {
+			t.Fatalf("Unable to create applier %s", err.Error())
+		}
+		err = a.CreateOrUpdateInPath("generatename", nil, false, values)
+		if err != nil {
+			t.Errorf("Unable to create or update %s", err.Error())
+		}
+		if items := listBootstrapJobs(t, client); len(items) != 1 {
+			t.Errorf("Expected 1 bootstrap job with prefetch %v, got %d", options.Prefetch, len(items))
+		}
+	}
+}
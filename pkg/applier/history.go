@@ -0,0 +1,370 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	//ReleaseLabel is the label holding the release name on the revision secrets
+	ReleaseLabel = "applier.open-cluster-management.io/release"
+	//RevisionLabel is the label holding the revision number on the revision secrets
+	RevisionLabel = "applier.open-cluster-management.io/revision"
+	//RevisionSecretType is the type of the revision secrets
+	RevisionSecretType corev1.SecretType = "applier.open-cluster-management.io/revision"
+	//DefaultMaxRevisions is the number of revisions kept if not specified
+	DefaultMaxRevisions = 10
+
+	revisionManifestsKey    = "manifests"
+	revisionValuesDigestKey = "valuesDigest"
+	revisionTimestampKey    = "timestamp"
+)
+
+//Revision is a record of a successful apply of a release
+type Revision struct {
+	//The revision number, starting at 1
+	Revision int
+	//The applied resources as rendered
+	Manifests []*unstructured.Unstructured
+	//The sha256 of the values used to render the resources
+	ValuesDigest string
+	//When the revision was recorded
+	Timestamp metav1.Time
+}
+
+//ReleaseHistory applies a release and records each successful apply as a revision
+//in a secret of the history namespace, allowing to rollback to a previous revision.
+type ReleaseHistory struct {
+	applier      *Applier
+	name         string
+	namespace    string
+	maxRevisions int
+}
+
+//NewReleaseHistory creates a ReleaseHistory
+//applier: The applier used to render and apply the resources
+//name: The name of the release
+//namespace: The namespace where the revision secrets are stored
+//maxRevisions: The number of revisions kept, DefaultMaxRevisions if 0
+func NewReleaseHistory(
+	applier *Applier,
+	name string,
+	namespace string,
+	maxRevisions int,
+) (*ReleaseHistory, error) {
+	if applier == nil {
+		return nil, fmt.Errorf("applier is nil")
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+		return nil, fmt.Errorf("Invalid release name %s: %v", name, errs)
+	}
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace is empty")
+	}
+	if maxRevisions <= 0 {
+		maxRevisions = DefaultMaxRevisions
+	}
+	return &ReleaseHistory{
+		applier:      applier,
+		name:         name,
+		namespace:    namespace,
+		maxRevisions: maxRevisions,
+	}, nil
+}
+
+//CreateOrUpdateInPath renders the assets found in the path, creates or updates them,
+//and records a new revision. See Applier.CreateOrUpdateInPath
+func (h *ReleaseHistory) CreateOrUpdateInPath(
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) (*Revision, error) {
+	h.applier.templateProcessor.SetCreateUpdateOrder()
+	us, err := h.applier.templateProcessor.TemplateResourcesInPathUnstructured(
+		path,
+		excluded,
+		recursive,
+		values)
+	if err != nil {
+		return nil, err
+	}
+	return h.CreateOrUpdates(us, values)
+}
+
+//CreateOrUpdates creates or updates the resources and records a new revision.
+//The values are only used to compute the digest of the revision.
+func (h *ReleaseHistory) CreateOrUpdates(
+	us []*unstructured.Unstructured,
+	values interface{},
+) (*Revision, error) {
+	digest, err := valuesDigest(values)
+	if err != nil {
+		return nil, err
+	}
+	manifests := deepCopyUnstructureds(us)
+	err = h.applier.CreateOrUpdates(us)
+	if err != nil {
+		return nil, err
+	}
+	return h.record(manifests, digest)
+}
+
+//History returns the recorded revisions ordered by revision number
+func (h *ReleaseHistory) History() ([]*Revision, error) {
+	secrets, err := h.listSecrets()
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]*Revision, 0, len(secrets))
+	for i := range secrets {
+		r, err := secretToRevision(&secrets[i])
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, nil
+}
+
+//Get returns a revision, a NotFound error is returned if the revision is not in the history
+func (h *ReleaseHistory) Get(revision int) (*Revision, error) {
+	secret := &corev1.Secret{}
+	err := h.applier.client.Get(context.TODO(),
+		client.ObjectKey{Name: h.secretName(revision), Namespace: h.namespace},
+		secret)
+	if err != nil {
+		return nil, err
+	}
+	return secretToRevision(secret)
+}
+
+//Rollback re-applies the resources of a revision, deletes the resources of the latest revision
+//which are absent from it and records the result as a new revision.
+func (h *ReleaseHistory) Rollback(revision int) (*Revision, error) {
+	target, err := h.Get(revision)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := h.History()
+	if err != nil {
+		return nil, err
+	}
+	klog.V(2).Infof("Rollback release %s to revision %d", h.name, revision)
+	manifests := deepCopyUnstructureds(target.Manifests)
+	err = h.applier.CreateOrUpdates(target.Manifests)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) != 0 {
+		err = h.prune(revisions[len(revisions)-1].Manifests, manifests)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h.record(manifests, target.ValuesDigest)
+}
+
+//prune deletes, in reverse order, the resources of current which are not in want
+func (h *ReleaseHistory) prune(current, want []*unstructured.Unstructured) error {
+	keep := make(map[string]bool)
+	for _, u := range want {
+		keep[resourceKey(u)] = true
+	}
+	for i := len(current) - 1; i >= 0; i-- {
+		u := current[i]
+		if keep[resourceKey(u)] {
+			continue
+		}
+		klog.V(2).Info("Prune: ",
+			" Kind: ", u.GetKind(),
+			" Name: ", u.GetName(),
+			" Namespace: ", u.GetNamespace())
+		err := h.applier.Delete(u.DeepCopy())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//record stores a new revision and deletes the revisions exceeding maxRevisions
+func (h *ReleaseHistory) record(
+	manifests []*unstructured.Unstructured,
+	digest string,
+) (*Revision, error) {
+	secrets, err := h.listSecrets()
+	if err != nil {
+		return nil, err
+	}
+	r := &Revision{
+		Revision:     1,
+		Manifests:    manifests,
+		ValuesDigest: digest,
+		Timestamp:    metav1.Now(),
+	}
+	if len(secrets) != 0 {
+		last, err := strconv.Atoi(secrets[len(secrets)-1].Labels[RevisionLabel])
+		if err != nil {
+			return nil, err
+		}
+		r.Revision = last + 1
+	}
+	if h.applier.applierOptions.DryRun {
+		klog.V(2).Infof("Dry-run, revision %d of release %s not recorded", r.Revision, h.name)
+		return r, nil
+	}
+	secret, err := h.revisionToSecret(r)
+	if err != nil {
+		return nil, err
+	}
+	err = h.applier.client.Create(context.TODO(), secret)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(2).Infof("Recorded revision %d of release %s", r.Revision, h.name)
+	secrets = append(secrets, *secret)
+	for i := 0; i < len(secrets)-h.maxRevisions; i++ {
+		klog.V(2).Infof("Delete revision %s of release %s", secrets[i].Labels[RevisionLabel], h.name)
+		err = h.applier.client.Delete(context.TODO(), &secrets[i])
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+//listSecrets returns the revision secrets of the release ordered by revision number
+func (h *ReleaseHistory) listSecrets() ([]corev1.Secret, error) {
+	list := &corev1.SecretList{}
+	err := h.applier.client.List(context.TODO(), list,
+		client.InNamespace(h.namespace),
+		client.MatchingLabels{ReleaseLabel: h.name})
+	if err != nil {
+		return nil, err
+	}
+	revision := func(s corev1.Secret) int {
+		r, _ := strconv.Atoi(s.Labels[RevisionLabel])
+		return r
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return revision(list.Items[i]) < revision(list.Items[j])
+	})
+	return list.Items, nil
+}
+
+func (h *ReleaseHistory) secretName(revision int) string {
+	return fmt.Sprintf("%s.v%d", h.name, revision)
+}
+
+func (h *ReleaseHistory) revisionToSecret(r *Revision) (*corev1.Secret, error) {
+	b, err := json.Marshal(templateprocessor.ToListUnstructured(r.Manifests).Object)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err = w.Write(b)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      h.secretName(r.Revision),
+			Namespace: h.namespace,
+			Labels: map[string]string{
+				ReleaseLabel:  h.name,
+				RevisionLabel: strconv.Itoa(r.Revision),
+			},
+		},
+		Type: RevisionSecretType,
+		Data: map[string][]byte{
+			revisionManifestsKey:    buf.Bytes(),
+			revisionValuesDigestKey: []byte(r.ValuesDigest),
+			revisionTimestampKey:    []byte(r.Timestamp.UTC().Format(time.RFC3339)),
+		},
+	}, nil
+}
+
+func secretToRevision(secret *corev1.Secret) (*Revision, error) {
+	revision, err := strconv.Atoi(secret.Labels[RevisionLabel])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid revision secret %s/%s: %s", secret.Namespace, secret.Name, err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(secret.Data[revisionManifestsKey]))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid revision secret %s/%s: %s", secret.Namespace, secret.Name, err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	list := &unstructured.Unstructured{}
+	err = list.UnmarshalJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := templateprocessor.ExpandList(list)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := time.Parse(time.RFC3339, string(secret.Data[revisionTimestampKey]))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid revision secret %s/%s: %s", secret.Namespace, secret.Name, err)
+	}
+	return &Revision{
+		Revision:     revision,
+		Manifests:    manifests,
+		ValuesDigest: string(secret.Data[revisionValuesDigestKey]),
+		Timestamp:    metav1.NewTime(timestamp),
+	}, nil
+}
+
+//valuesDigest returns the sha256 of the json of the values
+func valuesDigest(values interface{}) (string, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+//resourceKey identifies a resource by its group, kind, namespace and name or generateName
+func resourceKey(u *unstructured.Unstructured) string {
+	name := u.GetName()
+	if name == "" {
+		name = u.GetGenerateName()
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", u.GroupVersionKind().Group, u.GetKind(), u.GetNamespace(), name)
+}
+
+func deepCopyUnstructureds(us []*unstructured.Unstructured) []*unstructured.Unstructured {
+	copies := make([]*unstructured.Unstructured, len(us))
+	for i, u := range us {
+		copies[i] = u.DeepCopy()
+	}
+	return copies
+}
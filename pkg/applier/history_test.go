@@ -0,0 +1,102 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newConfigMap(name, value string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "default",
+		},
+		"data": map[string]interface{}{"value": value},
+	}}
+	return u
+}
+
+func TestReleaseHistory_Rollback(t *testing.T) {
+	client := fake.NewFakeClient()
+	a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+		DefaultKubernetesMerger, nil)
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	h, err := NewReleaseHistory(a, "myrelease", "history", 2)
+	if err != nil {
+		t.Fatalf("Unable to create history %s", err.Error())
+	}
+	getValue := func(name string) (string, bool) {
+		cm := &corev1.ConfigMap{}
+		err := client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: "default"}, cm)
+		if errors.IsNotFound(err) {
+			return "", false
+		}
+		if err != nil {
+			t.Fatalf("Unable to get %s %s", name, err.Error())
+		}
+		return cm.Data["value"], true
+	}
+
+	r1, err := h.CreateOrUpdates([]*unstructured.Unstructured{
+		newConfigMap("a", "v1"),
+		newConfigMap("b", "v1"),
+	}, map[string]string{"version": "v1"})
+	if err != nil {
+		t.Fatalf("Unable to apply revision 1 %s", err.Error())
+	}
+	r2, err := h.CreateOrUpdates([]*unstructured.Unstructured{
+		newConfigMap("a", "v2"),
+		newConfigMap("c", "v2"),
+	}, map[string]string{"version": "v2"})
+	if err != nil {
+		t.Fatalf("Unable to apply revision 2 %s", err.Error())
+	}
+	if r1.Revision != 1 || r2.Revision != 2 || r1.ValuesDigest == r2.ValuesDigest {
+		t.Errorf("Unexpected revisions %d %s, %d %s", r1.Revision, r1.ValuesDigest, r2.Revision, r2.ValuesDigest)
+	}
+
+	r3, err := h.Rollback(1)
+	if err != nil {
+		t.Fatalf("Unable to rollback %s", err.Error())
+	}
+	if r3.Revision != 3 || r3.ValuesDigest != r1.ValuesDigest {
+		t.Errorf("Unexpected rollback revision %d %s", r3.Revision, r3.ValuesDigest)
+	}
+	if v, ok := getValue("a"); !ok || v != "v1" {
+		t.Errorf("Expected a to be rolled back to v1, got %s", v)
+	}
+	if _, ok := getValue("b"); !ok {
+		t.Errorf("Expected b to be created")
+	}
+	if _, ok := getValue("c"); ok {
+		t.Errorf("Expected c to be pruned")
+	}
+
+	revisions, err := h.History()
+	if err != nil {
+		t.Fatalf("Unable to get the history %s", err.Error())
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 2 || revisions[1].Revision != 3 {
+		t.Errorf("Expected revisions 2 and 3, got %d revisions", len(revisions))
+	}
+	if len(revisions[1].Manifests) != 2 || revisions[1].Manifests[0].GetName() != "a" {
+		t.Errorf("Unexpected manifests in revision 3 %v", revisions[1].Manifests)
+	}
+	_, err = h.Get(1)
+	if !errors.IsNotFound(err) {
+		t.Errorf("Expected revision 1 to be removed from the history, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+//ManagedByLabel is the label set by the applier on the resources it manages
+//when Options.ManagerName is set.
+const ManagedByLabel = "applier.open-cluster-management.io/managed-by"
+
+//AdoptionPolicy defines what to do when a resource already exists but is not managed by the applier.
+type AdoptionPolicy string
+
+const (
+	//AdoptionPolicyNone the existing resource is updated whoever manages it, this is the default.
+	AdoptionPolicyNone AdoptionPolicy = ""
+	//AdoptionPolicyAdopt the existing resource is adopted, the owner reference and the managed-by label
+	//are set and any other controller reference is removed.
+	AdoptionPolicyAdopt AdoptionPolicy = "adopt"
+	//AdoptionPolicyFail an OwnershipError is returned.
+	AdoptionPolicyFail AdoptionPolicy = "fail"
+	//AdoptionPolicySkip the existing resource is left untouched.
+	AdoptionPolicySkip AdoptionPolicy = "skip"
+)
+
+//OwnershipError is returned when a resource is not managed by the applier
+//and the AdoptionPolicy is AdoptionPolicyFail or when it is owned by another controller.
+type OwnershipError struct {
+	//Kind of the resource
+	Kind string
+	//Name of the resource
+	Name string
+	//Namespace of the resource
+	Namespace string
+	//Owner the current controller of the resource if any
+	Owner *metav1.OwnerReference
+}
+
+func (e *OwnershipError) Error() string {
+	if e.Owner != nil {
+		return fmt.Sprintf("%s %s/%s is already owned by %s %s",
+			e.Kind, e.Namespace, e.Name, e.Owner.Kind, e.Owner.Name)
+	}
+	return fmt.Sprintf("%s %s/%s already exists and is not managed by the applier",
+		e.Kind, e.Namespace, e.Name)
+}
+
+//IsOwnershipError returns true if the error is an OwnershipError
+func IsOwnershipError(err error) bool {
+	_, ok := err.(*OwnershipError)
+	return ok
+}
+
+func newOwnershipError(u *unstructured.Unstructured) *OwnershipError {
+	return &OwnershipError{
+		Kind:      u.GetKind(),
+		Name:      u.GetName(),
+		Namespace: u.GetNamespace(),
+		Owner:     metav1.GetControllerOf(u),
+	}
+}
+
+//isManaged returns true if the resource has an owner reference to the applier owner
+//or the managed-by label matching the Options.ManagerName
+func (a *Applier) isManaged(u *unstructured.Unstructured) bool {
+	if a.owner != nil {
+		for _, ref := range u.GetOwnerReferences() {
+			if ref.UID == a.owner.GetUID() {
+				return true
+			}
+		}
+	}
+	if a.applierOptions.ManagerName != "" &&
+		u.GetLabels()[ManagedByLabel] == a.applierOptions.ManagerName {
+		return true
+	}
+	return false
+}
+
+//setManagedByLabel sets the managed-by label if Options.ManagerName is set
+//and returns true if the label was changed
+func (a *Applier) setManagedByLabel(u *unstructured.Unstructured) bool {
+	if a.applierOptions.ManagerName == "" {
+		return false
+	}
+	labels := u.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	if labels[ManagedByLabel] == a.applierOptions.ManagerName {
+		return false
+	}
+	labels[ManagedByLabel] = a.applierOptions.ManagerName
+	u.SetLabels(labels)
+	return true
+}
+
+//checkOwnership applies the Options.AdoptionPolicy on the current resource.
+//It returns true if the resource must be skipped.
+func (a *Applier) checkOwnership(current *unstructured.Unstructured) (skip bool, err error) {
+	if a.applierOptions.AdoptionPolicy == AdoptionPolicyNone || a.isManaged(current) {
+		return false, nil
+	}
+	switch a.applierOptions.AdoptionPolicy {
+	case AdoptionPolicySkip:
+		klog.Info("Skip resource not managed by the applier:",
+			" Kind: ", current.GetKind(),
+			" Name: ", current.GetName(),
+			" Namespace: ", current.GetNamespace())
+		return true, nil
+	case AdoptionPolicyFail:
+		return false, newOwnershipError(current)
+	case AdoptionPolicyAdopt:
+		return false, nil
+	}
+	return false, fmt.Errorf("Unknown adoption policy %s", a.applierOptions.AdoptionPolicy)
+}
+
+//adopt sets the owner reference and the managed-by label on the current resource,
+//any other controller reference is removed.
+func (a *Applier) adopt(current *unstructured.Unstructured) error {
+	if ref := metav1.GetControllerOf(current); ref != nil {
+		klog.Info("Adopting resource owned by another controller:",
+			" Kind: ", current.GetKind(),
+			" Name: ", current.GetName(),
+			" Namespace: ", current.GetNamespace(),
+			" Owner: ", ref.Kind, "/", ref.Name)
+	} else {
+		klog.Info("Adopting resource:",
+			" Kind: ", current.GetKind(),
+			" Name: ", current.GetName(),
+			" Namespace: ", current.GetNamespace())
+	}
+	if a.owner != nil && a.scheme != nil {
+		refs := make([]metav1.OwnerReference, 0)
+		for _, ref := range current.GetOwnerReferences() {
+			if ref.Controller == nil || !*ref.Controller {
+				refs = append(refs, ref)
+			}
+		}
+		current.SetOwnerReferences(refs)
+		if err := controllerutil.SetControllerReference(a.owner, current, a.scheme); err != nil {
+			return err
+		}
+	}
+	a.setManagedByLabel(current)
+	return nil
+}
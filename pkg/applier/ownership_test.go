@@ -0,0 +1,245 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNewApplier_AdoptionPolicy(t *testing.T) {
+	reader := templateprocessor.NewTestReader(assets)
+	client := fake.NewFakeClient()
+	_, err := NewApplier(reader, nil, client, nil, nil, DefaultKubernetesMerger,
+		&Options{AdoptionPolicy: AdoptionPolicyFail})
+	if err == nil {
+		t.Errorf("Expected an error as neither owner nor ManagerName is set")
+	}
+	_, err = NewApplier(reader, nil, client, nil, nil, DefaultKubernetesMerger,
+		&Options{AdoptionPolicy: AdoptionPolicyFail, ManagerName: "myoperator"})
+	if err != nil {
+		t.Errorf("Unable to create applier %s", err.Error())
+	}
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "default"}}
+	_, err = NewApplier(reader, nil, client, owner, nil, DefaultKubernetesMerger,
+		&Options{AdoptionPolicy: AdoptionPolicyAdopt})
+	if err == nil {
+		t.Errorf("Expected an error as the owner reference can not be set without scheme")
+	}
+	_, err = NewApplier(reader, nil, client, owner, scheme.Scheme, DefaultKubernetesMerger,
+		&Options{AdoptionPolicy: AdoptionPolicyAdopt})
+	if err != nil {
+		t.Errorf("Unable to create applier %s", err.Error())
+	}
+}
+
+func TestApplier_CreateOrUpdate_AdoptionPolicyWithContentHash(t *testing.T) {
+	tests := []struct {
+		name             string
+		policy           AdoptionPolicy
+		wantOwnershipErr bool
+		wantLabel        bool
+	}{
+		{
+			name:             "fail",
+			policy:           AdoptionPolicyFail,
+			wantOwnershipErr: true,
+		},
+		{
+			name:      "adopt",
+			policy:    AdoptionPolicyAdopt,
+			wantLabel: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewFakeClient()
+			reader := templateprocessor.NewTestReader(assets)
+			a, err := NewApplier(reader, nil, client, nil, nil, DefaultKubernetesMerger,
+				&Options{ContentHash: true, ManagerName: "myoperator"})
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			err = a.CreateOrUpdateResource("test/serviceaccount", values)
+			if err != nil {
+				t.Fatalf("Unable to create the service account %s", err.Error())
+			}
+			//The resource is no longer managed by the applier but its content hash still matches
+			key := types.NamespacedName{
+				Name:      values.BootstrapServiceAccountName,
+				Namespace: values.ManagedClusterNamespace,
+			}
+			sa := &corev1.ServiceAccount{}
+			err = client.Get(context.TODO(), key, sa)
+			if err != nil {
+				t.Fatalf("Unable to get the service account %s", err.Error())
+			}
+			delete(sa.Labels, ManagedByLabel)
+			err = client.Update(context.TODO(), sa)
+			if err != nil {
+				t.Fatalf("Unable to update the service account %s", err.Error())
+			}
+			a, err = NewApplier(reader, nil, client, nil, nil, DefaultKubernetesMerger,
+				&Options{ContentHash: true, ManagerName: "myoperator", AdoptionPolicy: tt.policy})
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			err = a.CreateOrUpdateResource("test/serviceaccount", values)
+			if IsOwnershipError(err) != tt.wantOwnershipErr {
+				t.Errorf("IsOwnershipError() = %v, want %v, error %v", IsOwnershipError(err), tt.wantOwnershipErr, err)
+			}
+			err = client.Get(context.TODO(), key, sa)
+			if err != nil {
+				t.Fatalf("Unable to get the service account %s", err.Error())
+			}
+			if _, ok := sa.Labels[ManagedByLabel]; ok != tt.wantLabel {
+				t.Errorf("Expected label %s to be set %v, got %v", ManagedByLabel, tt.wantLabel, sa.Labels)
+			}
+		})
+	}
+}
+
+func TestApplier_CreateOrUpdateInPath_AdoptionPolicy(t *testing.T) {
+	isController := true
+	owner := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "owner",
+			Namespace: values.ManagedClusterNamespace,
+			UID:       types.UID("owner-uid"),
+		},
+	}
+	unmanagedSA := func() *corev1.ServiceAccount {
+		return &corev1.ServiceAccount{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: corev1.SchemeGroupVersion.String(),
+				Kind:       "ServiceAccount",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      values.BootstrapServiceAccountName,
+				Namespace: values.ManagedClusterNamespace,
+			},
+		}
+	}
+	managedSA := unmanagedSA()
+	managedSA.Labels = map[string]string{ManagedByLabel: "myoperator"}
+	ownedSA := unmanagedSA()
+	ownedSA.OwnerReferences = []metav1.OwnerReference{
+		{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       "other",
+			UID:        types.UID("other-uid"),
+			Controller: &isController,
+		},
+	}
+	tests := []struct {
+		name             string
+		existing         *corev1.ServiceAccount
+		options          *Options
+		withOwner        bool
+		wantErr          bool
+		wantOwnershipErr bool
+		wantSecrets      int
+		wantLabel        bool
+		wantController   types.UID
+	}{
+		{
+			name:        "none updates unmanaged",
+			existing:    unmanagedSA(),
+			options:     &Options{},
+			wantSecrets: 1,
+		},
+		{
+			name:             "fail on unmanaged",
+			existing:         unmanagedSA(),
+			options:          &Options{AdoptionPolicy: AdoptionPolicyFail, ManagerName: "myoperator"},
+			wantErr:          true,
+			wantOwnershipErr: true,
+		},
+		{
+			name:        "fail updates managed",
+			existing:    managedSA,
+			options:     &Options{AdoptionPolicy: AdoptionPolicyFail, ManagerName: "myoperator"},
+			wantSecrets: 1,
+			wantLabel:   true,
+		},
+		{
+			name:        "skip unmanaged",
+			existing:    unmanagedSA(),
+			options:     &Options{AdoptionPolicy: AdoptionPolicySkip, ManagerName: "myoperator"},
+			wantSecrets: 0,
+		},
+		{
+			name:        "adopt unmanaged",
+			existing:    unmanagedSA(),
+			options:     &Options{AdoptionPolicy: AdoptionPolicyAdopt, ManagerName: "myoperator"},
+			wantSecrets: 1,
+			wantLabel:   true,
+		},
+		{
+			name:           "adopt owned by another controller",
+			existing:       ownedSA,
+			options:        &Options{AdoptionPolicy: AdoptionPolicyAdopt},
+			withOwner:      true,
+			wantSecrets:    1,
+			wantController: owner.UID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewFakeClient(tt.existing.DeepCopy())
+			reader := templateprocessor.NewTestReader(assets)
+			a, err := NewApplier(reader, nil, client, nil, nil, DefaultKubernetesMerger, tt.options)
+			if tt.withOwner {
+				a, err = NewApplier(reader, nil, client, owner, scheme.Scheme, DefaultKubernetesMerger, tt.options)
+			}
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			err = a.CreateOrUpdateResource("test/serviceaccount", values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateOrUpdateResource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if IsOwnershipError(err) != tt.wantOwnershipErr {
+				t.Errorf("IsOwnershipError() = %v, want %v", IsOwnershipError(err), tt.wantOwnershipErr)
+			}
+			sa := &corev1.ServiceAccount{}
+			err = client.Get(context.TODO(), types.NamespacedName{
+				Name:      values.BootstrapServiceAccountName,
+				Namespace: values.ManagedClusterNamespace,
+			}, sa)
+			if err != nil {
+				t.Fatalf("Unable to get the service account %s", err.Error())
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(sa.Secrets) != tt.wantSecrets {
+				t.Errorf("Expected %d secrets, got %d", tt.wantSecrets, len(sa.Secrets))
+			}
+			if _, ok := sa.Labels[ManagedByLabel]; ok != tt.wantLabel {
+				t.Errorf("Expected label %s to be set %v, got %v", ManagedByLabel, tt.wantLabel, sa.Labels)
+			}
+			if tt.wantController != "" {
+				ref := metav1.GetControllerOf(sa)
+				if ref == nil || ref.UID != tt.wantController {
+					t.Errorf("Expected controller %s, got %v", tt.wantController, ref)
+				}
+				if len(sa.OwnerReferences) != 1 {
+					t.Errorf("Expected a single owner reference, got %v", sa.OwnerReferences)
+				}
+			}
+		})
+	}
+}
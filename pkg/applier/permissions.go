@@ -0,0 +1,200 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog"
+)
+
+//Operation is an operation of the applier on a batch of resources
+type Operation string
+
+const (
+	OperationCreateOrUpdate Operation = "CreateOrUpdate"
+	OperationCreate         Operation = "Create"
+	OperationUpdate         Operation = "Update"
+	OperationDelete         Operation = "Delete"
+)
+
+//Permission is a permission needed by the applier
+type Permission struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	Namespace   string
+}
+
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Group != "" {
+		resource = resource + "." + p.Group
+	}
+	if p.Subresource != "" {
+		resource = resource + "/" + p.Subresource
+	}
+	if p.Namespace == "" {
+		return fmt.Sprintf("%s %s", p.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %s", p.Verb, resource, p.Namespace)
+}
+
+//MissingPermissionsError is returned by CheckPermissions when some permissions are not granted
+type MissingPermissionsError struct {
+	Permissions []Permission
+}
+
+func (e *MissingPermissionsError) Error() string {
+	permissions := make([]string, len(e.Permissions))
+	for i, p := range e.Permissions {
+		permissions[i] = p.String()
+	}
+	return fmt.Sprintf("missing permissions: %s", strings.Join(permissions, ", "))
+}
+
+//IsMissingPermissionsError returns true if the error is a MissingPermissionsError
+func IsMissingPermissionsError(err error) bool {
+	_, ok := err.(*MissingPermissionsError)
+	return ok
+}
+
+//CheckPermissions checks with SelfSubjectAccessReviews that the applier is allowed to run
+//the operation on the resources, it returns a MissingPermissionsError listing all the
+//missing permissions. It doesn't write any resource.
+func (a *Applier) CheckPermissions(
+	us []*unstructured.Unstructured,
+	operation Operation,
+) error {
+	missing, err := a.MissingPermissions(us, operation)
+	if err != nil {
+		return err
+	}
+	if len(missing) != 0 {
+		return &MissingPermissionsError{Permissions: missing}
+	}
+	return nil
+}
+
+//MissingPermissions returns the permissions needed to run the operation on the resources
+//which are not granted.
+func (a *Applier) MissingPermissions(
+	us []*unstructured.Unstructured,
+	operation Operation,
+) ([]Permission, error) {
+	permissions, err := a.requiredPermissions(us, operation)
+	if err != nil {
+		return nil, err
+	}
+	missing := make([]Permission, 0)
+	for _, p := range permissions {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   p.Namespace,
+					Verb:        p.Verb,
+					Group:       p.Group,
+					Resource:    p.Resource,
+					Subresource: p.Subresource,
+				},
+			},
+		}
+		err := a.client.Create(context.TODO(), review)
+		if err != nil {
+			return nil, err
+		}
+		if !review.Status.Allowed {
+			klog.V(2).Infof("Missing permission: %s", p)
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+//requiredPermissions returns the sorted permissions needed to run the operation on the resources
+func (a *Applier) requiredPermissions(
+	us []*unstructured.Unstructured,
+	operation Operation,
+) ([]Permission, error) {
+	var verbs []string
+	switch operation {
+	case OperationCreateOrUpdate:
+		verbs = []string{"get", "create", "update"}
+	case OperationCreate:
+		verbs = []string{"create"}
+	case OperationUpdate:
+		verbs = []string{"get", "update"}
+	case OperationDelete:
+		verbs = []string{"delete"}
+		if a.applierOptions.ForceDelete {
+			verbs = append(verbs, "update")
+		}
+	default:
+		return nil, fmt.Errorf("Unknown operation %s", operation)
+	}
+	prefetch := a.applierOptions.Prefetch && operation != OperationCreate && operation != OperationDelete
+	//The applied generation of the ContentHash is recorded with a patch
+	if a.applierOptions.ContentHash && !a.applierOptions.DryRun && operation != OperationDelete {
+		verbs = append(verbs, "patch")
+	}
+	//The Transactional rollback deletes the created resources
+	if a.applierOptions.Transactional && !a.applierOptions.DryRun && operation == OperationCreateOrUpdate {
+		verbs = append(verbs, "delete")
+	}
+	permissions := make(map[Permission]bool)
+	for _, u := range expandLists(us) {
+		gvk := u.GroupVersionKind()
+		var resource string
+		if a.applierOptions.RESTMapper != nil {
+			mapping, err := a.applierOptions.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err != nil {
+				return nil, err
+			}
+			resource = mapping.Resource.Resource
+		} else {
+			plural, _ := meta.UnsafeGuessKindToResource(gvk)
+			resource = plural.Resource
+		}
+		p := Permission{Group: gvk.Group, Resource: resource, Namespace: u.GetNamespace()}
+		for _, verb := range verbs {
+			p.Verb = verb
+			permissions[p] = true
+		}
+		//The namespaced kinds without namespace are not prefetched
+		if isGenerateName(u) || (prefetch && (u.GetNamespace() != "" || a.isClusterScoped(gvk))) {
+			p.Verb = "list"
+			permissions[p] = true
+		}
+		if operation != OperationDelete && u.Object["status"] != nil && !a.skipStatus(u) {
+			p.Verb = "update"
+			p.Subresource = "status"
+			permissions[p] = true
+		}
+	}
+	sorted := make([]Permission, 0, len(permissions))
+	for p := range permissions {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].String() < sorted[j].String()
+	})
+	return sorted, nil
+}
+
+//preflight checks the permissions if Options.PreflightPermissions is true
+func (a *Applier) preflight(
+	us []*unstructured.Unstructured,
+	operation Operation,
+) error {
+	if !a.applierOptions.PreflightPermissions {
+		return nil
+	}
+	return a.CheckPermissions(us, operation)
+}
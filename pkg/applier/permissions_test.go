@@ -0,0 +1,211 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+//accessReviewClient answers the SelfSubjectAccessReviews with the allowed permissions
+type accessReviewClient struct {
+	crclient.Client
+	allowed map[Permission]bool
+	reviews int
+}
+
+func (c *accessReviewClient) Create(ctx context.Context, obj runtime.Object, opts ...crclient.CreateOption) error {
+	review, ok := obj.(*authorizationv1.SelfSubjectAccessReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	c.reviews++
+	attributes := review.Spec.ResourceAttributes
+	review.Status.Allowed = c.allowed[Permission{
+		Verb:        attributes.Verb,
+		Group:       attributes.Group,
+		Resource:    attributes.Resource,
+		Subresource: attributes.Subresource,
+		Namespace:   attributes.Namespace,
+	}]
+	return nil
+}
+
+func TestApplier_CheckPermissions(t *testing.T) {
+	us := []*unstructured.Unstructured{
+		newConfigMap("a", "v1"),
+		newConfigMap("b", "v1"),
+		newBootstrapJob(map[string]interface{}{"phase": "Pending"}),
+	}
+	configMaps := func(verbs ...string) map[Permission]bool {
+		allowed := make(map[Permission]bool)
+		for _, verb := range verbs {
+			allowed[Permission{Verb: verb, Resource: "configmaps", Namespace: "default"}] = true
+		}
+		return allowed
+	}
+	bootstrapJob := func(verb, subresource string) Permission {
+		return Permission{
+			Verb:        verb,
+			Group:       bootstrapJobGVK.Group,
+			Resource:    "bootstrapjobs",
+			Subresource: subresource,
+			Namespace:   values.ManagedClusterNamespace,
+		}
+	}
+	tests := []struct {
+		name        string
+		operation   Operation
+		options     *Options
+		allowed     map[Permission]bool
+		wantMissing []Permission
+	}{
+		{
+			name:      "create or update",
+			operation: OperationCreateOrUpdate,
+			options:   &Options{},
+			allowed:   configMaps("get", "create", "update"),
+			wantMissing: []Permission{
+				bootstrapJob("create", ""),
+				bootstrapJob("get", ""),
+				bootstrapJob("update", ""),
+			},
+		},
+		{
+			name:      "create or update with status",
+			operation: OperationCreateOrUpdate,
+			options:   &Options{ApplyStatus: true},
+			allowed:   configMaps("get", "create"),
+			wantMissing: []Permission{
+				bootstrapJob("create", ""),
+				bootstrapJob("get", ""),
+				bootstrapJob("update", ""),
+				bootstrapJob("update", "status"),
+				{Verb: "update", Resource: "configmaps", Namespace: "default"},
+			},
+		},
+		{
+			name:      "create or update with content hash",
+			operation: OperationCreateOrUpdate,
+			options:   &Options{ContentHash: true},
+			allowed:   configMaps("get", "create", "update"),
+			wantMissing: []Permission{
+				bootstrapJob("create", ""),
+				bootstrapJob("get", ""),
+				bootstrapJob("patch", ""),
+				{Verb: "patch", Resource: "configmaps", Namespace: "default"},
+				bootstrapJob("update", ""),
+			},
+		},
+		{
+			name:      "create or update transactional",
+			operation: OperationCreateOrUpdate,
+			options:   &Options{Transactional: true},
+			allowed:   configMaps("get", "create", "update"),
+			wantMissing: []Permission{
+				bootstrapJob("create", ""),
+				bootstrapJob("delete", ""),
+				{Verb: "delete", Resource: "configmaps", Namespace: "default"},
+				bootstrapJob("get", ""),
+				bootstrapJob("update", ""),
+			},
+		},
+		{
+			name:      "delete",
+			operation: OperationDelete,
+			options:   &Options{},
+			allowed: map[Permission]bool{
+				{Verb: "delete", Resource: "configmaps", Namespace: "default"}: true,
+				bootstrapJob("delete", ""):                                     true,
+			},
+			wantMissing: []Permission{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &accessReviewClient{Client: fake.NewFakeClient(), allowed: tt.allowed}
+			a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+				DefaultKubernetesMerger, tt.options)
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			missing, err := a.MissingPermissions(us, tt.operation)
+			if err != nil {
+				t.Fatalf("Unable to check the permissions %s", err.Error())
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("Expected missing %v, got %v", tt.wantMissing, missing)
+			}
+		})
+	}
+}
+
+func TestApplier_CreateOrUpdates_PreflightPermissions(t *testing.T) {
+	client := &accessReviewClient{Client: fake.NewFakeClient(), allowed: map[Permission]bool{
+		{Verb: "get", Resource: "configmaps", Namespace: "default"}:    true,
+		{Verb: "create", Resource: "configmaps", Namespace: "default"}: true,
+	}}
+	a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+		DefaultKubernetesMerger, &Options{PreflightPermissions: true})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	err = a.CreateOrUpdates([]*unstructured.Unstructured{newConfigMap("a", "v1")})
+	if !IsMissingPermissionsError(err) {
+		t.Fatalf("Expected a MissingPermissionsError, got %v", err)
+	}
+	if err.Error() != "missing permissions: update configmaps in namespace default" {
+		t.Errorf("Unexpected error %s", err)
+	}
+	if client.reviews != 3 {
+		t.Errorf("Expected 3 reviews, got %d", client.reviews)
+	}
+	cms := &unstructured.UnstructuredList{}
+	cms.SetAPIVersion("v1")
+	cms.SetKind("ConfigMapList")
+	err = client.List(context.TODO(), cms)
+	if err != nil {
+		t.Fatalf("Unable to list %s", err.Error())
+	}
+	if len(cms.Items) != 0 {
+		t.Errorf("Expected no resource created, got %d", len(cms.Items))
+	}
+}
+
+func TestApplier_MissingPermissions_Prefetch(t *testing.T) {
+	cm := newConfigMap("a", "v1")
+	cm.SetNamespace("")
+	role := &unstructured.Unstructured{}
+	role.SetAPIVersion("rbac.authorization.k8s.io/v1")
+	role.SetKind("ClusterRole")
+	role.SetName("role")
+	client := &accessReviewClient{Client: fake.NewFakeClient()}
+	a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+		DefaultKubernetesMerger, &Options{Prefetch: true})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	missing, err := a.MissingPermissions([]*unstructured.Unstructured{cm, role}, OperationUpdate)
+	if err != nil {
+		t.Fatalf("Unable to check the permissions %s", err.Error())
+	}
+	//The namespaced kinds without namespace are not prefetched
+	wantMissing := []Permission{
+		{Verb: "get", Group: "rbac.authorization.k8s.io", Resource: "clusterroles"},
+		{Verb: "get", Resource: "configmaps"},
+		{Verb: "list", Group: "rbac.authorization.k8s.io", Resource: "clusterroles"},
+		{Verb: "update", Group: "rbac.authorization.k8s.io", Resource: "clusterroles"},
+		{Verb: "update", Resource: "configmaps"},
+	}
+	if !reflect.DeepEqual(missing, wantMissing) {
+		t.Errorf("Expected missing %v, got %v", wantMissing, missing)
+	}
+}
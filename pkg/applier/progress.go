@@ -0,0 +1,231 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+//Action is what the applier did on a resource
+type Action string
+
+const (
+	//ActionCreated the resource was created
+	ActionCreated Action = "Created"
+	//ActionUpdated the resource was updated
+	ActionUpdated Action = "Updated"
+	//ActionUnchanged the resource was already up to date, or already deleted
+	ActionUnchanged Action = "Unchanged"
+	//ActionSkipped the resource is not managed by the applier and was left unchanged
+	ActionSkipped Action = "Skipped"
+	//ActionDeleted the resource was deleted
+	ActionDeleted Action = "Deleted"
+	//ActionFailed the resource failed
+	ActionFailed Action = "Failed"
+)
+
+//DefaultReadyTimeout is the time the applier waits for a resource to be ready if Options.ReadyTimeout is not set
+const DefaultReadyTimeout = 5 * time.Minute
+
+//ProgressObserver is notified of the progress of the applier, resource by resource.
+//The applier calls the observer from the goroutine applying the resources, an observer shared by
+//applies running concurrently is called concurrently and must be safe for concurrent use.
+//The observer must not modify the resources.
+type ProgressObserver interface {
+	//OnBatch is called when a batch of resources starts, total is the number of resources of the batch
+	OnBatch(op Operation, total int)
+	//OnStart is called when a resource starts to be applied or deleted
+	OnStart(u *unstructured.Unstructured, op Operation)
+	//OnRetry is called each time a call to the API server fails with a retriable err,
+	//including the last attempt of the Backoff
+	OnRetry(u *unstructured.Unstructured, err error)
+	//OnWait is called each time the resource is found not ready while waiting for it, see Options.WaitForReady
+	OnWait(u *unstructured.Unstructured, reason string)
+	//OnFinish is called when a resource is done, the action is ActionFailed if err is not nil
+	OnFinish(u *unstructured.Unstructured, action Action, err error)
+}
+
+//ProgressObserverFuncs is a ProgressObserver calling its functions, the nil functions are ignored
+type ProgressObserverFuncs struct {
+	BatchFunc  func(op Operation, total int)
+	StartFunc  func(u *unstructured.Unstructured, op Operation)
+	RetryFunc  func(u *unstructured.Unstructured, err error)
+	WaitFunc   func(u *unstructured.Unstructured, reason string)
+	FinishFunc func(u *unstructured.Unstructured, action Action, err error)
+}
+
+var _ ProgressObserver = ProgressObserverFuncs{}
+
+//OnBatch calls BatchFunc
+func (f ProgressObserverFuncs) OnBatch(op Operation, total int) {
+	if f.BatchFunc != nil {
+		f.BatchFunc(op, total)
+	}
+}
+
+//OnStart calls StartFunc
+func (f ProgressObserverFuncs) OnStart(u *unstructured.Unstructured, op Operation) {
+	if f.StartFunc != nil {
+		f.StartFunc(u, op)
+	}
+}
+
+//OnRetry calls RetryFunc
+func (f ProgressObserverFuncs) OnRetry(u *unstructured.Unstructured, err error) {
+	if f.RetryFunc != nil {
+		f.RetryFunc(u, err)
+	}
+}
+
+//OnWait calls WaitFunc
+func (f ProgressObserverFuncs) OnWait(u *unstructured.Unstructured, reason string) {
+	if f.WaitFunc != nil {
+		f.WaitFunc(u, reason)
+	}
+}
+
+//OnFinish calls FinishFunc
+func (f ProgressObserverFuncs) OnFinish(u *unstructured.Unstructured, action Action, err error) {
+	if f.FinishFunc != nil {
+		f.FinishFunc(u, action, err)
+	}
+}
+
+//observeBatch notifies the observer of a new batch, the lists are counted by their items
+func (a *Applier) observeBatch(us []*unstructured.Unstructured, op Operation) {
+	if a.applierOptions.ProgressObserver == nil {
+		return
+	}
+	total := 0
+	for _, u := range expandLists(us) {
+		if u.GetKind() != "" {
+			total++
+		}
+	}
+	a.applierOptions.ProgressObserver.OnBatch(op, total)
+}
+
+//observe runs apply on the resource, waits for it to be ready and notifies the observer
+func (a *Applier) observe(
+	u *unstructured.Unstructured,
+	op Operation,
+	apply func() (Action, error),
+) error {
+	observer := a.applierOptions.ProgressObserver
+	if observer != nil {
+		observer.OnStart(u, op)
+	}
+	action, err := apply()
+	if err == nil && (action == ActionCreated || action == ActionUpdated || action == ActionUnchanged) &&
+		op != OperationDelete {
+		err = a.waitForReady(u)
+	}
+	if err != nil {
+		action = ActionFailed
+	}
+	if observer != nil {
+		observer.OnFinish(u, action, err)
+	}
+	return err
+}
+
+//observeRetry notifies the observer of a retry
+func (a *Applier) observeRetry(u *unstructured.Unstructured, err error) {
+	if a.applierOptions.ProgressObserver != nil {
+		a.applierOptions.ProgressObserver.OnRetry(u, err)
+	}
+}
+
+//waitForReady waits, if Options.WaitForReady is set, until the resource is ready
+func (a *Applier) waitForReady(u *unstructured.Unstructured) error {
+	if !a.applierOptions.WaitForReady || a.applierOptions.DryRun {
+		return nil
+	}
+	timeout := a.applierOptions.ReadyTimeout
+	if timeout == 0 {
+		timeout = DefaultReadyTimeout
+	}
+	interval := a.applierOptions.Backoff.Duration
+	if interval <= 0 {
+		interval = time.Second
+	}
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(u.GroupVersionKind())
+	reason := ""
+	err := wait.PollImmediate(interval, timeout, func() (bool, error) {
+		err := a.client.Get(context.TODO(),
+			types.NamespacedName{Name: u.GetName(), Namespace: u.GetNamespace()},
+			current)
+		if err != nil {
+			klog.V(2).Infof("Error while waiting for the resource to be ready %s", err)
+			a.observeRetry(u, err)
+			return false, nil
+		}
+		var ready bool
+		ready, reason = isReady(current)
+		if !ready {
+			klog.V(2).Info("Waiting: ", reason,
+				" Kind: ", u.GetKind(),
+				" Name: ", u.GetName(),
+				" Namespace: ", u.GetNamespace())
+			if a.applierOptions.ProgressObserver != nil {
+				a.applierOptions.ProgressObserver.OnWait(u, reason)
+			}
+		}
+		return ready, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("%s %s/%s not ready after %s: %s", u.GetKind(), u.GetNamespace(), u.GetName(), timeout, reason)
+	}
+	return err
+}
+
+//isReady returns true if the resource is ready or false and the reason.
+//The workloads are ready when their replicas are ready,
+//the other resources when their Ready, Available or Established condition is True if they have one.
+func isReady(u *unstructured.Unstructured) (bool, string) {
+	observed, found, _ := unstructured.NestedInt64(u.Object, "status", "observedGeneration")
+	if found && observed < u.GetGeneration() {
+		return false, fmt.Sprintf("generation %d not observed yet", u.GetGeneration())
+	}
+	switch u.GetKind() {
+	case "Deployment", "StatefulSet", "ReplicaSet":
+		replicas, found, _ := unstructured.NestedInt64(u.Object, "spec", "replicas")
+		if !found {
+			replicas = 1
+		}
+		ready, _, _ := unstructured.NestedInt64(u.Object, "status", "readyReplicas")
+		if ready < replicas {
+			return false, fmt.Sprintf("%d/%d replicas ready", ready, replicas)
+		}
+		return true, ""
+	case "DaemonSet":
+		desired, _, _ := unstructured.NestedInt64(u.Object, "status", "desiredNumberScheduled")
+		ready, _, _ := unstructured.NestedInt64(u.Object, "status", "numberReady")
+		if ready < desired {
+			return false, fmt.Sprintf("%d/%d pods ready", ready, desired)
+		}
+		return true, ""
+	}
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch condition["type"] {
+		case "Ready", "Available", "Established":
+			if condition["status"] != "True" {
+				return false, fmt.Sprintf("condition %s is %v", condition["type"], condition["status"])
+			}
+		}
+	}
+	return true, ""
+}
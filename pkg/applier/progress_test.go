@@ -0,0 +1,388 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+//progressRecorder records the events as strings
+type progressRecorder struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (r *progressRecorder) record(format string, a ...interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, a...))
+}
+
+func (r *progressRecorder) observer() ProgressObserver {
+	return ProgressObserverFuncs{
+		BatchFunc: func(op Operation, total int) {
+			r.record("batch %s %d", op, total)
+		},
+		StartFunc: func(u *unstructured.Unstructured, op Operation) {
+			r.record("start %s %s", op, u.GetName())
+		},
+		RetryFunc: func(u *unstructured.Unstructured, err error) {
+			r.record("retry %s %s", u.GetName(), err)
+		},
+		WaitFunc: func(u *unstructured.Unstructured, reason string) {
+			r.record("wait %s %s", u.GetName(), reason)
+		},
+		FinishFunc: func(u *unstructured.Unstructured, action Action, err error) {
+			r.record("finish %s %s", u.GetName(), action)
+		},
+	}
+}
+
+//dataMerger replaces the data of the current resource
+func dataMerger(current, new *unstructured.Unstructured) (*unstructured.Unstructured, bool) {
+	if reflect.DeepEqual(current.Object["data"], new.Object["data"]) {
+		return current, false
+	}
+	current.Object["data"] = new.Object["data"]
+	return current, true
+}
+
+func TestApplier_ProgressObserver(t *testing.T) {
+	existing := &corev1.ConfigMap{}
+	existing.Name = "a"
+	existing.Namespace = "default"
+	existing.Data = map[string]string{"value": "v0"}
+	client := &failingClient{
+		Client:     fake.NewFakeClient(existing),
+		failCreate: "c",
+	}
+	recorder := &progressRecorder{}
+	a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+		dataMerger,
+		&Options{
+			Backoff:          &wait.Backoff{Steps: 2, Duration: time.Millisecond},
+			ProgressObserver: recorder.observer(),
+		})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	list := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items": []interface{}{
+			newConfigMap("b", "v1").Object,
+		},
+	}}
+	err = a.CreateOrUpdates([]*unstructured.Unstructured{
+		newConfigMap("a", "v1"),
+		newConfigMap("a", "v1"),
+		list,
+		newConfigMap("c", "v1"),
+	})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	err = a.Deletes([]*unstructured.Unstructured{newConfigMap("b", "v1"), newConfigMap("d", "v1")})
+	if err != nil {
+		t.Fatalf("Unable to delete %s", err.Error())
+	}
+	want := []string{
+		"batch CreateOrUpdate 4",
+		"start CreateOrUpdate a",
+		"finish a Updated",
+		"start CreateOrUpdate a",
+		"finish a Unchanged",
+		"start CreateOrUpdate b",
+		"finish b Created",
+		"start CreateOrUpdate c",
+		"retry c create c failed",
+		"retry c create c failed",
+		"finish c Failed",
+		"batch Delete 2",
+		"start Delete b",
+		"finish b Deleted",
+		"start Delete d",
+		"finish d Unchanged",
+	}
+	if !reflect.DeepEqual(recorder.events, want) {
+		t.Errorf("Expected events:\n%v\ngot:\n%v", want, recorder.events)
+	}
+}
+
+func TestApplier_ProgressObserver_Lists(t *testing.T) {
+	client := &accessReviewClient{Client: fake.NewFakeClient(), allowed: map[Permission]bool{
+		{Verb: "create", Resource: "configmaps", Namespace: "default"}: true,
+		{Verb: "delete", Resource: "configmaps", Namespace: "default"}: true,
+	}}
+	recorder := &progressRecorder{}
+	a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+		DefaultKubernetesMerger,
+		&Options{
+			Backoff:              &wait.Backoff{Steps: 1},
+			ProgressObserver:     recorder.observer(),
+			PreflightPermissions: true,
+		})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	resources := func() []*unstructured.Unstructured {
+		return []*unstructured.Unstructured{
+			{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "List",
+				"items": []interface{}{
+					newConfigMap("a", "v1").Object,
+					newConfigMap("b", "v1").Object,
+				},
+			}},
+			newConfigMap("c", "v1"),
+		}
+	}
+	err = a.Creates(resources())
+	if err != nil {
+		t.Fatalf("Unable to create %s", err.Error())
+	}
+	err = a.Deletes(resources())
+	if err != nil {
+		t.Fatalf("Unable to delete %s", err.Error())
+	}
+	//The items of the lists are applied in the batch, without a new batch or preflight check
+	want := []string{
+		"batch Create 3",
+		"start Create a",
+		"finish a Created",
+		"start Create b",
+		"finish b Created",
+		"start Create c",
+		"finish c Created",
+		"batch Delete 3",
+		"start Delete a",
+		"finish a Deleted",
+		"start Delete b",
+		"finish b Deleted",
+		"start Delete c",
+		"finish c Deleted",
+	}
+	if !reflect.DeepEqual(recorder.events, want) {
+		t.Errorf("Expected events:\n%v\ngot:\n%v", want, recorder.events)
+	}
+	if client.reviews != 2 {
+		t.Errorf("Expected 2 reviews, got %d", client.reviews)
+	}
+}
+
+func TestApplier_ProgressObserver_Concurrent(t *testing.T) {
+	recorder := &progressRecorder{}
+	a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, fake.NewFakeClient(), nil, nil,
+		DefaultKubernetesMerger,
+		&Options{
+			Backoff:          &wait.Backoff{Steps: 1},
+			ProgressObserver: recorder.observer(),
+		})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := a.CreateOrUpdates([]*unstructured.Unstructured{newConfigMap(fmt.Sprintf("cm%d", i), "v1")})
+			if err != nil {
+				t.Errorf("Unable to create %s", err.Error())
+			}
+		}(i)
+	}
+	wg.Wait()
+	sort.Strings(recorder.events)
+	want := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		want = append(want,
+			"batch CreateOrUpdate 1",
+			fmt.Sprintf("finish cm%d Created", i),
+			fmt.Sprintf("start CreateOrUpdate cm%d", i))
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(recorder.events, want) {
+		t.Errorf("Expected events:\n%v\ngot:\n%v", want, recorder.events)
+	}
+}
+
+//readyAfterClient sets the readyReplicas of the resources read after the given number of gets
+type readyAfterClient struct {
+	crclient.Client
+	gets       int
+	readyAfter int
+}
+
+func (c *readyAfterClient) Get(ctx context.Context, key types.NamespacedName, obj runtime.Object) error {
+	err := c.Client.Get(ctx, key, obj)
+	if err != nil {
+		return err
+	}
+	c.gets++
+	if u, ok := obj.(*unstructured.Unstructured); ok && c.gets >= c.readyAfter {
+		return unstructured.SetNestedField(u.Object, int64(1), "status", "readyReplicas")
+	}
+	return nil
+}
+
+func TestApplier_WaitForReady(t *testing.T) {
+	resources := func() []*unstructured.Unstructured {
+		return []*unstructured.Unstructured{
+			{Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata": map[string]interface{}{
+					"name":      "app",
+					"namespace": "default",
+				},
+			}},
+			{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]interface{}{
+					"name":      "cm",
+					"namespace": "default",
+				},
+			}},
+		}
+	}
+	tests := []struct {
+		name       string
+		readyAfter int
+		wantEvents []string
+		wantErr    bool
+	}{
+		{
+			name:       "ready",
+			readyAfter: 2,
+			wantEvents: []string{
+				"batch CreateOrUpdate 2",
+				"start CreateOrUpdate app",
+				"wait app 0/1 replicas ready",
+				"finish app Created",
+				"start CreateOrUpdate cm",
+				"finish cm Created",
+			},
+		},
+		{
+			name:       "timeout",
+			readyAfter: 1000,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &progressRecorder{}
+			a, err := NewApplier(templateprocessor.NewTestReader(nil), nil,
+				&readyAfterClient{Client: fake.NewFakeClient(), readyAfter: tt.readyAfter},
+				nil, nil,
+				DefaultKubernetesMerger,
+				&Options{
+					Backoff:          &wait.Backoff{Steps: 1, Duration: time.Millisecond},
+					ProgressObserver: recorder.observer(),
+					WaitForReady:     true,
+					ReadyTimeout:     50 * time.Millisecond,
+				})
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			err = a.CreateOrUpdates(resources())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateOrUpdates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantEvents != nil && !reflect.DeepEqual(recorder.events, tt.wantEvents) {
+				t.Errorf("Expected events:\n%v\ngot:\n%v", tt.wantEvents, recorder.events)
+			}
+			if tt.wantErr && recorder.events[len(recorder.events)-1] != "finish app Failed" {
+				t.Errorf("Expected a failure, got %v", recorder.events)
+			}
+		})
+	}
+}
+
+func Test_isReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		object     map[string]interface{}
+		wantReady  bool
+		wantReason string
+	}{
+		{
+			name: "configmap",
+			object: map[string]interface{}{
+				"kind": "ConfigMap",
+			},
+			wantReady: true,
+		},
+		{
+			name: "generation not observed",
+			object: map[string]interface{}{
+				"kind":     "Deployment",
+				"metadata": map[string]interface{}{"generation": int64(2)},
+				"spec":     map[string]interface{}{"replicas": int64(1)},
+				"status": map[string]interface{}{
+					"observedGeneration": int64(1),
+					"readyReplicas":      int64(1),
+				},
+			},
+			wantReason: "generation 2 not observed yet",
+		},
+		{
+			name: "statefulset ready",
+			object: map[string]interface{}{
+				"kind":   "StatefulSet",
+				"spec":   map[string]interface{}{"replicas": int64(2)},
+				"status": map[string]interface{}{"readyReplicas": int64(2)},
+			},
+			wantReady: true,
+		},
+		{
+			name: "daemonset not ready",
+			object: map[string]interface{}{
+				"kind": "DaemonSet",
+				"status": map[string]interface{}{
+					"desiredNumberScheduled": int64(3),
+					"numberReady":            int64(1),
+				},
+			},
+			wantReason: "1/3 pods ready",
+		},
+		{
+			name: "condition not ready",
+			object: map[string]interface{}{
+				"kind": "Widget",
+				"status": map[string]interface{}{
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Ready", "status": "False"},
+					},
+				},
+			},
+			wantReason: "condition Ready is False",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, reason := isReady(&unstructured.Unstructured{Object: tt.object})
+			if ready != tt.wantReady || reason != tt.wantReason {
+				t.Errorf("isReady() = %v, %q, want %v, %q", ready, reason, tt.wantReady, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//DefaultStatusMerger initializes the status of the current resource with the new status.
+//Only the status fields missing in the current status are set and the conditions
+//are merged by type, a condition already present in the current status is kept.
+//It allows to seed a status without overwriting the updates made by the controller of the resource.
+var DefaultStatusMerger Merger = func(current,
+	new *unstructured.Unstructured,
+) (
+	future *unstructured.Unstructured,
+	update bool,
+) {
+	newStatus, ok := new.Object["status"].(map[string]interface{})
+	if !ok {
+		return current, false
+	}
+	currentStatus, ok := current.Object["status"].(map[string]interface{})
+	if !ok {
+		currentStatus = make(map[string]interface{})
+	}
+	for k, newValue := range newStatus {
+		currentValue, ok := currentStatus[k]
+		if !ok {
+			currentStatus[k] = newValue
+			update = true
+			continue
+		}
+		if k != "conditions" {
+			continue
+		}
+		conditions, changed := mergeConditions(currentValue, newValue)
+		if changed {
+			currentStatus[k] = conditions
+			update = true
+		}
+	}
+	current.Object["status"] = currentStatus
+	return current, update
+}
+
+//mergeConditions adds the new conditions which type is not yet in the current conditions
+func mergeConditions(current, new interface{}) (interface{}, bool) {
+	currentConditions, ok := current.([]interface{})
+	if !ok {
+		return current, false
+	}
+	newConditions, ok := new.([]interface{})
+	if !ok {
+		return current, false
+	}
+	types := make(map[interface{}]bool)
+	for _, c := range currentConditions {
+		if m, ok := c.(map[string]interface{}); ok {
+			types[m["type"]] = true
+		}
+	}
+	changed := false
+	for _, c := range newConditions {
+		m, ok := c.(map[string]interface{})
+		if !ok || types[m["type"]] {
+			continue
+		}
+		currentConditions = append(currentConditions, c)
+		changed = true
+	}
+	return currentConditions, changed
+}
+
+//skipStatus returns true if the status must not be applied on the kind
+func (a *Applier) skipStatus(u *unstructured.Unstructured) bool {
+	if !a.applierOptions.ApplyStatus {
+		return true
+	}
+	for _, kind := range a.applierOptions.SkipStatusKinds {
+		if kind == u.GetKind() {
+			return true
+		}
+	}
+	return false
+}
+
+//applyStatus updates the status subresource of the current resource with the wanted status
+//using the Options.StatusMerger. On conflict the resource is read again and the status merged again.
+func (a *Applier) applyStatus(
+	current *unstructured.Unstructured,
+	status interface{},
+) error {
+	if status == nil || a.skipStatus(current) {
+		return nil
+	}
+	if a.applierOptions.DryRun {
+		klog.V(2).Info("Dry-run, status not applied:",
+			" Kind: ", current.GetKind(),
+			" Name: ", current.GetName(),
+			" Namespace: ", current.GetNamespace())
+		return nil
+	}
+	want := &unstructured.Unstructured{Object: map[string]interface{}{"status": status}}
+	var clientUpdateOptions []client.UpdateOption
+	if a.applierOptions != nil {
+		clientUpdateOptions = a.applierOptions.ClientUpdateOption
+	}
+	updatedOptions := &client.UpdateOptions{}
+	clientUpdateOption := updatedOptions.ApplyOptions(clientUpdateOptions)
+	latest := current.DeepCopy()
+	err := retry.OnError(*a.applierOptions.Backoff, func(err error) bool {
+		if err != nil {
+			klog.V(2).Infof("Retry status update %s", err)
+			a.observeRetry(current, err)
+			return true
+		}
+		return false
+	}, func() error {
+		future, update := a.applierOptions.StatusMerger(latest.DeepCopy(), want)
+		if !update || reflect.DeepEqual(future.Object["status"], latest.Object["status"]) {
+			klog.V(2).Info("No status update needed")
+			return nil
+		}
+		err := a.client.Status().Update(context.TODO(), future, clientUpdateOption)
+		if err != nil {
+			klog.V(2).Infof("Error while updating status %s", err)
+			if errors.IsConflict(err) {
+				errGet := a.client.Get(context.TODO(),
+					types.NamespacedName{Name: current.GetName(), Namespace: current.GetNamespace()},
+					latest)
+				if errGet != nil {
+					klog.V(2).Infof("Error while reading the resource %s", errGet)
+				}
+			}
+		}
+		return err
+	})
+	if err != nil {
+		klog.V(2).Info("Unable to update status:", "Error", err,
+			" Kind: ", current.GetKind(),
+			" Name: ", current.GetName(),
+			" Namespace: ", current.GetNamespace())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var statusAssets = map[string]string{
+	"status/job": `
+apiVersion: example.open-cluster-management.io/v1
+kind: BootstrapJob
+metadata:
+  name: {{ .ManagedClusterName }}
+  namespace: {{ .ManagedClusterNamespace }}
+spec:
+  cluster: {{ .ManagedClusterName }}
+status:
+  phase: Pending
+  conditions:
+  - type: Available
+    status: "False"
+  - type: Degraded
+    status: "False"`,
+}
+
+func newBootstrapJob(status map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"cluster": values.ManagedClusterName},
+	}}
+	u.SetGroupVersionKind(bootstrapJobGVK)
+	u.SetName(values.ManagedClusterName)
+	u.SetNamespace(values.ManagedClusterNamespace)
+	if status != nil {
+		u.Object["status"] = status
+	}
+	return u
+}
+
+func TestApplier_CreateOrUpdateResource_Status(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   *unstructured.Unstructured
+		options    *Options
+		wantStatus interface{}
+	}{
+		{
+			name:     "status initialized",
+			existing: newBootstrapJob(nil),
+			options:  &Options{ApplyStatus: true},
+			wantStatus: map[string]interface{}{
+				"phase": "Pending",
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Available", "status": "False"},
+					map[string]interface{}{"type": "Degraded", "status": "False"},
+				},
+			},
+		},
+		{
+			name: "status merged",
+			existing: newBootstrapJob(map[string]interface{}{
+				"phase": "Running",
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Available", "status": "True"},
+				},
+			}),
+			options: &Options{ApplyStatus: true},
+			wantStatus: map[string]interface{}{
+				"phase": "Running",
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Available", "status": "True"},
+					map[string]interface{}{"type": "Degraded", "status": "False"},
+				},
+			},
+		},
+		{
+			name:     "status not applied",
+			existing: newBootstrapJob(nil),
+			options:  &Options{},
+		},
+		{
+			name:     "status skipped for kind",
+			existing: newBootstrapJob(nil),
+			options:  &Options{ApplyStatus: true, SkipStatusKinds: []string{"BootstrapJob"}},
+		},
+		{
+			name:     "status dry-run",
+			existing: newBootstrapJob(nil),
+			options:  &Options{ApplyStatus: true, DryRun: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testscheme := runtime.NewScheme()
+			testscheme.AddKnownTypeWithName(bootstrapJobGVK, &unstructured.Unstructured{})
+			client := fake.NewFakeClientWithScheme(testscheme, tt.existing)
+			a, err := NewApplier(templateprocessor.NewTestReader(statusAssets),
+				nil, client, nil, nil, DefaultKubernetesMerger, tt.options)
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			err = a.CreateOrUpdateResource("status/job", values)
+			if err != nil {
+				t.Fatalf("Unable to create or update %s", err.Error())
+			}
+			u := &unstructured.Unstructured{}
+			u.SetGroupVersionKind(bootstrapJobGVK)
+			err = client.Get(context.TODO(), types.NamespacedName{
+				Name:      values.ManagedClusterName,
+				Namespace: values.ManagedClusterNamespace,
+			}, u)
+			if err != nil {
+				t.Fatalf("Unable to get the resource %s", err.Error())
+			}
+			if !reflect.DeepEqual(u.Object["status"], tt.wantStatus) {
+				t.Errorf("Expected status %v, got %v", tt.wantStatus, u.Object["status"])
+			}
+		})
+	}
+}
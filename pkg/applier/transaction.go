@@ -0,0 +1,176 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+)
+
+//TransactionError is returned by a transactional CreateOrUpdates when a resource failed to be applied.
+//It holds the original error and the errors which occurred while rolling back the batch.
+type TransactionError struct {
+	//The error which made the batch fail
+	Err error
+	//The errors which occurred while rolling back, empty if the rollback succeeded
+	RollbackErrs []error
+}
+
+func (e *TransactionError) Error() string {
+	if len(e.RollbackErrs) == 0 {
+		return fmt.Sprintf("%s, rollback succeeded", e.Err)
+	}
+	errs := make([]string, len(e.RollbackErrs))
+	for i, err := range e.RollbackErrs {
+		errs[i] = err.Error()
+	}
+	return fmt.Sprintf("%s, rollback failed: %s", e.Err, strings.Join(errs, ", "))
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.Err
+}
+
+//snapshot is the live state of a resource before the batch, nil if the resource didn't exist,
+//and the action of the batch on the resource
+type snapshot struct {
+	u      *unstructured.Unstructured
+	live   *unstructured.Unstructured
+	action Action
+}
+
+//transactionalCreateOrUpdates reads the live state of the resources, then creates or updates them.
+//If a resource fails, the resources already applied, and the failed one, are restored
+//in reverse order, the updated ones to their live state and the ones created by the batch are deleted.
+//A resource created by another client after its snapshot is not deleted.
+func (a *Applier) transactionalCreateOrUpdates(
+	us []*unstructured.Unstructured,
+	reader lookupReader,
+) error {
+	us = expandLists(us)
+	snapshots := make([]snapshot, len(us))
+	for i, u := range us {
+		live, err := a.snapshot(u)
+		if err != nil {
+			return err
+		}
+		snapshots[i] = snapshot{u: u, live: live}
+	}
+	for i, u := range us {
+		err := a.observe(u, OperationCreateOrUpdate, func() (Action, error) {
+			action, err := a.applyCreateOrUpdate(u, reader)
+			snapshots[i].action = action
+			return action, err
+		})
+		if err != nil {
+			klog.V(2).Infof("Rollback %d resources: %s", i+1, err)
+			return &TransactionError{
+				Err:          err,
+				RollbackErrs: a.rollback(snapshots[:i+1]),
+			}
+		}
+	}
+	return nil
+}
+
+//snapshot returns the live state of a resource, nil if it doesn't exist
+func (a *Applier) snapshot(u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if u.GetKind() == "" {
+		return nil, fmt.Errorf("Kind is missing for Name: %s, Namespace: %s", u.GetName(), u.GetNamespace())
+	}
+	err := a.resolveGenerateName(u)
+	if err != nil {
+		return nil, err
+	}
+	if isGenerateName(u) {
+		return nil, nil
+	}
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(u.GroupVersionKind())
+	err = a.client.Get(context.TODO(),
+		types.NamespacedName{Name: u.GetName(), Namespace: u.GetNamespace()},
+		live)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+//rollback restores the snapshots in reverse order and returns the errors
+func (a *Applier) rollback(snapshots []snapshot) []error {
+	errs := make([]error, 0)
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		s := snapshots[i]
+		var err error
+		switch {
+		case s.action == ActionCreated:
+			err = a.rollbackCreate(s.u)
+		case s.live != nil:
+			err = a.rollbackUpdate(s.live)
+		case s.action == ActionUpdated:
+			err = fmt.Errorf("created by another client during the batch, the update is not rolled back")
+		default:
+			//Not created by the batch, for example the create failed as another client created it
+			continue
+		}
+		if err != nil {
+			klog.V(2).Info("Unable to rollback:", "Error", err,
+				" Kind: ", s.u.GetKind(),
+				" Name: ", s.u.GetName(),
+				" Namespace: ", s.u.GetNamespace())
+			errs = append(errs, fmt.Errorf("%s %s/%s: %s", s.u.GetKind(), s.u.GetNamespace(), s.u.GetName(), err))
+		}
+	}
+	return errs
+}
+
+//rollbackCreate deletes a resource created by the batch
+func (a *Applier) rollbackCreate(u *unstructured.Unstructured) error {
+	if u.GetName() == "" {
+		//The create failed before a name was generated
+		return nil
+	}
+	klog.V(2).Info("Rollback create: ",
+		" Kind: ", u.GetKind(),
+		" Name: ", u.GetName(),
+		" Namespace: ", u.GetNamespace())
+	err := a.client.Delete(context.TODO(), u.DeepCopy())
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+//rollbackUpdate restores a resource updated by the batch to its live state before the batch
+func (a *Applier) rollbackUpdate(live *unstructured.Unstructured) error {
+	klog.V(2).Info("Rollback update: ",
+		" Kind: ", live.GetKind(),
+		" Name: ", live.GetName(),
+		" Namespace: ", live.GetNamespace())
+	return retry.RetryOnConflict(*a.applierOptions.Backoff, func() error {
+		current := &unstructured.Unstructured{}
+		current.SetGroupVersionKind(live.GroupVersionKind())
+		err := a.client.Get(context.TODO(),
+			types.NamespacedName{Name: live.GetName(), Namespace: live.GetNamespace()},
+			current)
+		if err != nil {
+			return err
+		}
+		if current.GetResourceVersion() == live.GetResourceVersion() {
+			return nil
+		}
+		restored := live.DeepCopy()
+		restored.SetResourceVersion(current.GetResourceVersion())
+		return a.client.Update(context.TODO(), restored)
+	})
+}
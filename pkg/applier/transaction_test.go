@@ -0,0 +1,163 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package applier
+
+import (
+	"context"
+	goerr "errors"
+	"fmt"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+//failingClient fails the create and the delete of the resources with the given names
+type failingClient struct {
+	crclient.Client
+	failCreate string
+	failDelete string
+}
+
+func (c *failingClient) Create(ctx context.Context, obj runtime.Object, opts ...crclient.CreateOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok && u.GetName() == c.failCreate {
+		return fmt.Errorf("create %s failed", c.failCreate)
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *failingClient) Delete(ctx context.Context, obj runtime.Object, opts ...crclient.DeleteOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok && u.GetName() == c.failDelete {
+		return fmt.Errorf("delete %s failed", c.failDelete)
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func TestApplier_CreateOrUpdates_Transactional(t *testing.T) {
+	tests := []struct {
+		name             string
+		failDelete       string
+		wantRollbackErrs int
+		wantB            bool
+	}{
+		{
+			name: "rollback succeeded",
+		},
+		{
+			name:             "rollback failed",
+			failDelete:       "b",
+			wantRollbackErrs: 1,
+			wantB:            true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := &corev1.ConfigMap{}
+			existing.Name = "a"
+			existing.Namespace = "default"
+			existing.Data = map[string]string{"value": "v0"}
+			client := &failingClient{
+				Client:     fake.NewFakeClient(existing),
+				failCreate: "c",
+				failDelete: tt.failDelete,
+			}
+			a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+				DefaultKubernetesMerger,
+				&Options{Transactional: true, Backoff: &wait.Backoff{Steps: 1}})
+			if err != nil {
+				t.Fatalf("Unable to create applier %s", err.Error())
+			}
+			err = a.CreateOrUpdates([]*unstructured.Unstructured{
+				newConfigMap("a", "v1"),
+				newConfigMap("b", "v1"),
+				newConfigMap("c", "v1"),
+			})
+			transactionErr := &TransactionError{}
+			if !goerr.As(err, &transactionErr) {
+				t.Fatalf("Expected a TransactionError, got %v", err)
+			}
+			if transactionErr.Err.Error() != "create c failed" {
+				t.Errorf("Expected the create error, got %s", transactionErr.Err)
+			}
+			if len(transactionErr.RollbackErrs) != tt.wantRollbackErrs {
+				t.Errorf("Expected %d rollback errors, got %v", tt.wantRollbackErrs, transactionErr.RollbackErrs)
+			}
+			cm := &corev1.ConfigMap{}
+			err = client.Get(context.TODO(), types.NamespacedName{Name: "a", Namespace: "default"}, cm)
+			if err != nil {
+				t.Fatalf("Unable to get a %s", err.Error())
+			}
+			if cm.Data["value"] != "v0" {
+				t.Errorf("Expected a to be restored to v0, got %s", cm.Data["value"])
+			}
+			err = client.Get(context.TODO(), types.NamespacedName{Name: "b", Namespace: "default"}, cm)
+			if (err == nil) != tt.wantB || (err != nil && !errors.IsNotFound(err)) {
+				t.Errorf("Expected b exists %v, got %v", tt.wantB, err)
+			}
+		})
+	}
+}
+
+//racingClient creates the resource with the given name, as another client would, just before creating it
+type racingClient struct {
+	crclient.Client
+	race string
+}
+
+func (c *racingClient) Create(ctx context.Context, obj runtime.Object, opts ...crclient.CreateOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok && u.GetName() == c.race {
+		other := &corev1.ConfigMap{}
+		other.Name = c.race
+		other.Namespace = u.GetNamespace()
+		other.Data = map[string]string{"value": "other"}
+		err := c.Client.Create(ctx, other)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestApplier_CreateOrUpdates_Transactional_CreatedByAnotherClient(t *testing.T) {
+	client := &racingClient{Client: fake.NewFakeClient(), race: "b"}
+	a, err := NewApplier(templateprocessor.NewTestReader(nil), nil, client, nil, nil,
+		DefaultKubernetesMerger,
+		&Options{Transactional: true, Backoff: &wait.Backoff{Steps: 1}})
+	if err != nil {
+		t.Fatalf("Unable to create applier %s", err.Error())
+	}
+	err = a.CreateOrUpdates([]*unstructured.Unstructured{
+		newConfigMap("a", "v1"),
+		newConfigMap("b", "v1"),
+	})
+	transactionErr := &TransactionError{}
+	if !goerr.As(err, &transactionErr) {
+		t.Fatalf("Expected a TransactionError, got %v", err)
+	}
+	if !errors.IsAlreadyExists(transactionErr.Err) {
+		t.Errorf("Expected an AlreadyExists error, got %s", transactionErr.Err)
+	}
+	if len(transactionErr.RollbackErrs) != 0 {
+		t.Errorf("Expected no rollback error, got %v", transactionErr.RollbackErrs)
+	}
+	cm := &corev1.ConfigMap{}
+	err = client.Get(context.TODO(), types.NamespacedName{Name: "a", Namespace: "default"}, cm)
+	if !errors.IsNotFound(err) {
+		t.Errorf("Expected a created by the batch to be deleted, got %v", err)
+	}
+	//b is created by the other client and is not deleted
+	err = client.Get(context.TODO(), types.NamespacedName{Name: "b", Namespace: "default"}, cm)
+	if err != nil {
+		t.Fatalf("Expected b to be kept, got %v", err)
+	}
+	if cm.Data["value"] != "other" {
+		t.Errorf("Expected b of the other client, got %v", cm.Data)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	libgocrdv1 "github.com/stolostron/library-go/pkg/apis/meta/v1/crd"
 	libgodeploymentv1 "github.com/stolostron/library-go/pkg/apis/meta/v1/deployment"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
@@ -119,7 +120,13 @@ func NewKubeClientAPIExtension(url, kubeconfig, context string) (clientset.Inter
 //client: the client to use
 //expectedAPIGroups: The list of expected APIGroups
 func HaveServerResources(client clientset.Interface, expectedAPIGroups []string) error {
-	clientDiscovery := client.Discovery()
+	return HaveServerResourcesWithDiscovery(client.Discovery(), expectedAPIGroups)
+}
+
+//HaveServerResourcesWithDiscovery returns an error if all provided APIGroups are not installed
+//clientDiscovery: the discovery client to use, for example kubernetes.Interface.Discovery()
+//expectedAPIGroups: The list of expected APIGroups
+func HaveServerResourcesWithDiscovery(clientDiscovery discovery.DiscoveryInterface, expectedAPIGroups []string) error {
 	for _, apiGroup := range expectedAPIGroups {
 		klog.V(1).Infof("Check if %s exists", apiGroup)
 		_, err := clientDiscovery.ServerResourcesForGroupVersion(apiGroup)
@@ -10,6 +10,8 @@ import (
 	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	fakeclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -502,3 +504,49 @@ func TestHaveDeploymentsInNamespace(t *testing.T) {
 		})
 	}
 }
+
+func TestHaveServerResourcesWithDiscovery(t *testing.T) {
+	kubeClient := fakeclientapps.NewSimpleClientset()
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "route.openshift.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "routes", Kind: "Route"},
+			},
+		},
+	}
+
+	type args struct {
+		clientDiscovery   discovery.DiscoveryInterface
+		expectedAPIGroups []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "api group served",
+			args: args{
+				clientDiscovery:   kubeClient.Discovery(),
+				expectedAPIGroups: []string{"route.openshift.io/v1"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "all api groups not served",
+			args: args{
+				clientDiscovery:   kubeClient.Discovery(),
+				expectedAPIGroups: []string{"route.openshift.io/v1", "config.openshift.io/v1"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := HaveServerResourcesWithDiscovery(tt.args.clientDiscovery, tt.args.expectedAPIGroups); (err != nil) != tt.wantErr {
+				t.Errorf("HaveServerResourcesWithDiscovery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//Package jsonschema validates JSON values against a schema, the subset of the JSON schema draft 7
+//and of the OpenAPI v2 and v3 schemas shared by the values schemas and the kubernetes resources schemas:
+//type, format, properties, additionalProperties, required, items, enum, const, minimum, maximum,
+//exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern, minItems, maxItems,
+//allOf, anyOf, oneOf, not, the local $ref and the x-kubernetes-preserve-unknown-fields,
+//x-kubernetes-int-or-string and x-kubernetes-embedded-resource extensions.
+//The schemas are the generic form of their JSON document, a map[string]interface{} or a bool.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+//Violation is a value which doesn't match its schema
+type Violation struct {
+	//The path of the value, for example spec.containers[0].name
+	Path    string
+	Message string
+}
+
+//Validator validates values against the schemas of a document
+type Validator struct {
+	//The document the local $ref are resolved in, for example #/definitions/name
+	Root interface{}
+	//If true, the rules of the kubernetes structural schemas apply: the null values are unset values
+	//and the fields which are not in the properties of an object are unknown,
+	//unless additionalProperties or x-kubernetes-preserve-unknown-fields is set.
+	Structural bool
+}
+
+//Validate returns the violations of the schema by the value, path is the path of the value
+func (v *Validator) Validate(value, schema interface{}, path string) []Violation {
+	w := &walker{validator: v}
+	w.validate(value, schema, path)
+	return w.violations
+}
+
+//walker validates a value against a schema and collects the violations
+type walker struct {
+	validator  *Validator
+	violations []Violation
+}
+
+func (w *walker) errorf(path, format string, a ...interface{}) {
+	w.violations = append(w.violations, Violation{Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+//valid returns true if the value matches the schema
+func (w *walker) valid(value, schema interface{}, path string) bool {
+	sub := &walker{validator: w.validator}
+	sub.validate(value, schema, path)
+	return len(sub.violations) == 0
+}
+
+func (w *walker) validate(value, schema interface{}, path string) {
+	if b, ok := schema.(bool); ok {
+		if !b {
+			w.errorf(path, "no value is allowed")
+		}
+		return
+	}
+	s := resolve(schema, w.validator.Root)
+	if s == nil || (value == nil && w.validator.Structural) {
+		return
+	}
+	switch {
+	case isIntOrString(s):
+		switch value.(type) {
+		case string, int64, float64:
+		default:
+			w.errorf(path, "expected an integer or a string, got %s", typeOf(value))
+			return
+		}
+	case s["format"] == "quantity":
+		w.validateQuantity(value, path)
+	default:
+		if t, ok := s["type"]; ok && !matchesType(value, t) {
+			w.errorf(path, "expected %s, got %s", typeNames(t), typeOf(value))
+			return
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok && !contains(enum, value) {
+		w.errorf(path, "unsupported value %v, must be one of %v", value, enum)
+	}
+	if c, ok := s["const"]; ok && !equal(c, value) {
+		w.errorf(path, "must be %v", c)
+	}
+	switch val := value.(type) {
+	case map[string]interface{}:
+		w.validateObject(val, s, path)
+	case []interface{}:
+		w.validateArray(val, s, path)
+	case string:
+		w.validateString(val, s, path)
+	case int64:
+		w.validateNumber(float64(val), s, path)
+	case float64:
+		w.validateNumber(val, s, path)
+	}
+	for _, sub := range list(s["allOf"]) {
+		w.validate(value, sub, path)
+	}
+	if anyOf := list(s["anyOf"]); len(anyOf) != 0 {
+		found := false
+		for _, sub := range anyOf {
+			if w.valid(value, sub, path) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			w.errorf(path, "must match at least one of the anyOf schemas")
+		}
+	}
+	if oneOf := list(s["oneOf"]); len(oneOf) != 0 {
+		count := 0
+		for _, sub := range oneOf {
+			if w.valid(value, sub, path) {
+				count++
+			}
+		}
+		if count != 1 {
+			w.errorf(path, "must match exactly one of the oneOf schemas, matches %d", count)
+		}
+	}
+	if not, ok := s["not"]; ok && w.valid(value, not, path) {
+		w.errorf(path, "must not match the not schema")
+	}
+}
+
+func (w *walker) validateObject(object map[string]interface{}, s map[string]interface{}, path string) {
+	for _, r := range list(s["required"]) {
+		name, _ := r.(string)
+		if _, ok := object[name]; !ok {
+			w.errorf(Join(path, name), "required field is missing")
+		}
+	}
+	properties, _ := s["properties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	preserveUnknown, _ := s["x-kubernetes-preserve-unknown-fields"].(bool)
+	embedded, _ := s["x-kubernetes-embedded-resource"].(bool)
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if p, ok := properties[name]; ok {
+			w.validate(object[name], p, Join(path, name))
+			continue
+		}
+		if embedded && (name == "apiVersion" || name == "kind" || name == "metadata") {
+			continue
+		}
+		if hasAdditional {
+			if b, ok := additional.(bool); ok {
+				if !b {
+					w.errorf(Join(path, name), "unknown field")
+				}
+				continue
+			}
+			w.validate(object[name], additional, Join(path, name))
+			continue
+		}
+		if w.validator.Structural && !preserveUnknown && len(properties) != 0 {
+			w.errorf(Join(path, name), "unknown field")
+		}
+	}
+}
+
+func (w *walker) validateArray(array []interface{}, s map[string]interface{}, path string) {
+	if min, ok := number(s["minItems"]); ok && float64(len(array)) < min {
+		w.errorf(path, "must have at least %v items", min)
+	}
+	if max, ok := number(s["maxItems"]); ok && float64(len(array)) > max {
+		w.errorf(path, "must have at most %v items", max)
+	}
+	if items, ok := s["items"]; ok {
+		for i, item := range array {
+			w.validate(item, items, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+func (w *walker) validateString(value string, s map[string]interface{}, path string) {
+	length := float64(len([]rune(value)))
+	if min, ok := number(s["minLength"]); ok && length < min {
+		w.errorf(path, "must be at least %v characters long", min)
+	}
+	if max, ok := number(s["maxLength"]); ok && length > max {
+		w.errorf(path, "must be at most %v characters long", max)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			w.errorf(path, "invalid pattern %s: %s", pattern, err)
+		} else if !re.MatchString(value) {
+			w.errorf(path, "must match the pattern %s", pattern)
+		}
+	}
+	switch s["format"] {
+	case "byte":
+		if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+			w.errorf(path, "expected a base64 encoded string")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			w.errorf(path, "expected a RFC 3339 date-time, got %q", value)
+		}
+	}
+}
+
+func (w *walker) validateNumber(value float64, s map[string]interface{}, path string) {
+	if min, ok := number(s["minimum"]); ok {
+		//the exclusiveMinimum of the OpenAPI schemas is a boolean modifying the minimum
+		if s["exclusiveMinimum"] == true && value <= min {
+			w.errorf(path, "must be greater than %v", min)
+		} else if value < min {
+			w.errorf(path, "must be greater than or equal to %v", min)
+		}
+	}
+	if max, ok := number(s["maximum"]); ok {
+		if s["exclusiveMaximum"] == true && value >= max {
+			w.errorf(path, "must be less than %v", max)
+		} else if value > max {
+			w.errorf(path, "must be less than or equal to %v", max)
+		}
+	}
+	if min, ok := number(s["exclusiveMinimum"]); ok && value <= min {
+		w.errorf(path, "must be greater than %v", min)
+	}
+	if max, ok := number(s["exclusiveMaximum"]); ok && value >= max {
+		w.errorf(path, "must be less than %v", max)
+	}
+	if s["format"] == "int32" && (value < math.MinInt32 || value > math.MaxInt32) {
+		w.errorf(path, "%v overflows a 32-bit integer", value)
+	}
+}
+
+//validateQuantity checks a resource quantity, a string or a number like 500m, 1Gi or 2
+func (w *walker) validateQuantity(value interface{}, path string) {
+	switch q := value.(type) {
+	case int64, float64:
+	case string:
+		if _, err := resource.ParseQuantity(q); err != nil {
+			w.errorf(path, "invalid quantity %q", q)
+		}
+	default:
+		w.errorf(path, "expected a quantity, got %s", typeOf(value))
+	}
+}
+
+//ApplyDefaults sets the missing properties of the object which have a default in the schema,
+//the missing objects having properties with defaults are created
+func ApplyDefaults(object map[string]interface{}, schema, root interface{}) {
+	s := resolve(schema, root)
+	properties, _ := s["properties"].(map[string]interface{})
+	for name, p := range properties {
+		ps := resolve(p, root)
+		if _, ok := object[name]; !ok {
+			if d, ok := ps["default"]; ok {
+				object[name] = runtime.DeepCopyJSONValue(d)
+			} else if _, ok := ps["properties"]; ok {
+				child := make(map[string]interface{})
+				ApplyDefaults(child, ps, root)
+				if len(child) != 0 {
+					object[name] = child
+				}
+				continue
+			}
+		}
+		if child, ok := object[name].(map[string]interface{}); ok {
+			ApplyDefaults(child, ps, root)
+		}
+	}
+	for _, sub := range list(s["allOf"]) {
+		ApplyDefaults(object, sub, root)
+	}
+}
+
+//Join returns the path of a field of an object
+func Join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+//resolve follows the local $ref of a schema, #/definitions/name or #/$defs/name for example
+func resolve(schema, root interface{}) map[string]interface{} {
+	s, _ := schema.(map[string]interface{})
+	for i := 0; i < 10; i++ {
+		ref, ok := s["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#") {
+			return s
+		}
+		var target interface{} = root
+		for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+			if token == "" {
+				continue
+			}
+			m, _ := target.(map[string]interface{})
+			target = m[strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")]
+		}
+		s, _ = target.(map[string]interface{})
+	}
+	return s
+}
+
+func isIntOrString(s map[string]interface{}) bool {
+	return s["x-kubernetes-int-or-string"] == true || s["format"] == "int-or-string"
+}
+
+func list(value interface{}) []interface{} {
+	l, _ := value.([]interface{})
+	return l
+}
+
+//number returns the value of a numeric keyword
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+func contains(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if equal(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+//equal compares JSON values, the numbers are equal whatever their go type
+func equal(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	return err == nil && bytes.Equal(ja, jb)
+}
+
+func matchesType(value interface{}, t interface{}) bool {
+	switch types := t.(type) {
+	case string:
+		return matchesTypeName(value, types)
+	case []interface{}:
+		for _, name := range types {
+			if n, ok := name.(string); ok && matchesTypeName(value, n) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTypeName(value interface{}, name string) bool {
+	switch v := value.(type) {
+	case nil:
+		return name == "null"
+	case bool:
+		return name == "boolean"
+	case int64:
+		return name == "integer" || name == "number"
+	case float64:
+		return name == "number" || (name == "integer" && v == math.Trunc(v))
+	case string:
+		return name == "string"
+	case []interface{}:
+		return name == "array"
+	case map[string]interface{}:
+		return name == "object"
+	default:
+		return false
+	}
+}
+
+func typeNames(t interface{}) string {
+	if types, ok := t.([]interface{}); ok {
+		names := make([]string, len(types))
+		for i, name := range types {
+			names[i] = withArticle(fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return withArticle(fmt.Sprint(t))
+}
+
+func withArticle(name string) string {
+	switch name {
+	case "null":
+		return name
+	case "array", "integer", "object":
+		return "an " + name
+	default:
+		return "a " + name
+	}
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case int64, float64:
+		return "a number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
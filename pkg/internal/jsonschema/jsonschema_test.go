@@ -0,0 +1,139 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package jsonschema
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestValidator_Validate(t *testing.T) {
+	root := map[string]interface{}{
+		"definitions": map[string]interface{}{
+			"port": map[string]interface{}{
+				"type":             "integer",
+				"format":           "int32",
+				"minimum":          int64(0),
+				"exclusiveMinimum": true,
+			},
+		},
+	}
+	object := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"name"},
+		"properties": map[string]interface{}{
+			"name":   map[string]interface{}{"type": "string"},
+			"port":   map[string]interface{}{"$ref": "#/definitions/port"},
+			"policy": map[string]interface{}{"type": "string", "enum": []interface{}{"Always", "Never"}},
+			"size":   map[string]interface{}{"type": "integer", "enum": []interface{}{float64(1), float64(2)}},
+			"extra":  map[string]interface{}{"type": "object", "x-kubernetes-preserve-unknown-fields": true},
+		},
+	}
+	tests := []struct {
+		name       string
+		structural bool
+		value      interface{}
+		want       []Violation
+	}{
+		{
+			name:  "valid",
+			value: map[string]interface{}{"name": "a", "port": int64(80), "size": int64(2), "unknown": true},
+		},
+		{
+			name:       "unknown field of a structural schema",
+			structural: true,
+			value: map[string]interface{}{
+				"name":    "a",
+				"unknown": true,
+				"extra":   map[string]interface{}{"any": "field"},
+			},
+			want: []Violation{{Path: "unknown", Message: "unknown field"}},
+		},
+		{
+			name:       "null values of a structural schema",
+			structural: true,
+			value:      map[string]interface{}{"name": nil, "port": nil},
+		},
+		{
+			name:  "null values",
+			value: map[string]interface{}{"name": nil},
+			want:  []Violation{{Path: "name", Message: "expected a string, got null"}},
+		},
+		{
+			name:  "violations",
+			value: map[string]interface{}{"port": int64(0), "policy": "Sometimes", "size": int64(3)},
+			want: []Violation{
+				{Path: "name", Message: "required field is missing"},
+				{Path: "policy", Message: "unsupported value Sometimes, must be one of [Always Never]"},
+				{Path: "port", Message: "must be greater than 0"},
+				{Path: "size", Message: "unsupported value 3, must be one of [1 2]"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Validator{Root: root, Structural: tt.structural}
+			if got := v.Validate(tt.value, object, ""); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator_Validate_Formats(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		schema  map[string]interface{}
+		wantErr bool
+	}{
+		{name: "string", value: "a", schema: map[string]interface{}{"type": "string"}},
+		{name: "number as string", value: int64(1), schema: map[string]interface{}{"type": "string"}, wantErr: true},
+		{name: "byte", value: "YWJj", schema: map[string]interface{}{"type": "string", "format": "byte"}},
+		{name: "invalid byte", value: "abc!", schema: map[string]interface{}{"type": "string", "format": "byte"}, wantErr: true},
+		{name: "date-time", value: "2020-01-02T03:04:05Z", schema: map[string]interface{}{"type": "string", "format": "date-time"}},
+		{name: "invalid date-time", value: "2020-01-02", schema: map[string]interface{}{"type": "string", "format": "date-time"}, wantErr: true},
+		{name: "int32", value: int64(math.MaxInt32), schema: map[string]interface{}{"type": "integer", "format": "int32"}},
+		{name: "int32 overflow", value: int64(math.MaxInt32) + 1, schema: map[string]interface{}{"type": "integer", "format": "int32"}, wantErr: true},
+		{name: "quantity", value: "100Mi", schema: map[string]interface{}{"type": "string", "format": "quantity"}},
+		{name: "quantity number", value: float64(0.5), schema: map[string]interface{}{"type": "string", "format": "quantity"}},
+		{name: "invalid quantity", value: "1 Gi", schema: map[string]interface{}{"type": "string", "format": "quantity"}, wantErr: true},
+		{name: "int-or-string", value: int64(8080), schema: map[string]interface{}{"type": "string", "format": "int-or-string"}},
+		{name: "x-kubernetes-int-or-string", value: "http", schema: map[string]interface{}{"x-kubernetes-int-or-string": true}},
+		{name: "invalid int-or-string", value: true, schema: map[string]interface{}{"x-kubernetes-int-or-string": true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Validator{Structural: true}
+			if got := v.Validate(tt.value, tt.schema, "field"); (len(got) != 0) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	schema := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"replicas": map[string]interface{}{"default": float64(1)},
+			"image": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"tag":  map[string]interface{}{"default": "latest"},
+					"name": map[string]interface{}{"type": "string"},
+				},
+			},
+			"labels": map[string]interface{}{"default": map[string]interface{}{"app": "a"}},
+		},
+	}
+	object := map[string]interface{}{"replicas": float64(3)}
+	ApplyDefaults(object, schema, schema)
+	want := map[string]interface{}{
+		"replicas": float64(3),
+		"image":    map[string]interface{}{"tag": "latest"},
+		"labels":   map[string]interface{}{"app": "a"},
+	}
+	if !reflect.DeepEqual(object, want) {
+		t.Errorf("ApplyDefaults() = %v, want %v", object, want)
+	}
+}
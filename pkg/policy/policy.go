@@ -0,0 +1,216 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//Package policy validates rendered resources against CEL rules
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/cel-go/cel"
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog"
+)
+
+//Severity defines what to do when a rule is violated
+type Severity string
+
+const (
+	//SeverityWarn reports the violation
+	SeverityWarn Severity = "warn"
+	//SeverityDeny reports the violation and fails the validation
+	SeverityDeny Severity = "deny"
+)
+
+//Rules is the content of a rules file
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+//Rule is a CEL expression which must be true for each matching rendered resource.
+//The resource is available in the expression as the variable `object`.
+type Rule struct {
+	//The name of the rule
+	Name string `json:"name"`
+	//The kinds on which the rule applies, all kinds if empty
+	Match []Match `json:"match,omitempty"`
+	//The CEL expression, returning a bool
+	Expression string `json:"expression"`
+	//The message reported when the expression is false
+	Message string `json:"message,omitempty"`
+	//The severity of a violation, deny if not set
+	Severity Severity `json:"severity,omitempty"`
+}
+
+//Match selects the resources on which a rule applies, an empty field matches all values
+type Match struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+}
+
+//Violation is a rule not satisfied by a rendered resource
+type Violation struct {
+	Rule      string
+	Severity  Severity
+	Message   string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s %s/%s violates rule %s: %s",
+		v.Severity, v.Kind, v.Namespace, v.Name, v.Rule, v.Message)
+}
+
+//ViolationsError is returned by Validate when a rule with the severity deny is violated
+type ViolationsError struct {
+	Violations []Violation
+}
+
+func (e *ViolationsError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return fmt.Sprintf("policy violations:\n%s", strings.Join(violations, "\n"))
+}
+
+//IsViolationsError returns true if the error is a ViolationsError
+func IsViolationsError(err error) bool {
+	_, ok := err.(*ViolationsError)
+	return ok
+}
+
+//Validator evaluates compiled rules against rendered resources,
+//it implements templateprocessor.Validator
+type Validator struct {
+	rules    []Rule
+	programs []cel.Program
+	//Called for each violation of a rule with the severity warn
+	OnWarning func(v Violation)
+}
+
+var _ templateprocessor.Validator = &Validator{}
+
+//LoadRules reads a yaml or json rules file
+func LoadRules(path string) ([]Rule, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	rules := &Rules{}
+	err = yaml.Unmarshal(b, rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules.Rules, nil
+}
+
+//NewValidator compiles the rules and returns a Validator
+func NewValidator(rules []Rule) (*Validator, error) {
+	env, err := cel.NewEnv(cel.Variable("object", cel.DynType))
+	if err != nil {
+		return nil, err
+	}
+	v := &Validator{
+		rules:    make([]Rule, len(rules)),
+		programs: make([]cel.Program, len(rules)),
+	}
+	for i, rule := range rules {
+		if rule.Severity == "" {
+			rule.Severity = SeverityDeny
+		}
+		if rule.Severity != SeverityDeny && rule.Severity != SeverityWarn {
+			return nil, fmt.Errorf("Invalid severity %s for rule %s", rule.Severity, rule.Name)
+		}
+		if rule.Message == "" {
+			rule.Message = fmt.Sprintf("failed expression: %s", rule.Expression)
+		}
+		ast, issues := env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("Invalid expression for rule %s: %s", rule.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("Invalid expression for rule %s: must return a bool, not %s",
+				rule.Name, ast.OutputType())
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid expression for rule %s: %s", rule.Name, err)
+		}
+		v.rules[i] = rule
+		v.programs[i] = program
+	}
+	return v, nil
+}
+
+//Evaluate returns the violations of the rules by the resources
+func (v *Validator) Evaluate(us []*unstructured.Unstructured) []Violation {
+	violations := make([]Violation, 0)
+	for _, u := range us {
+		for i, rule := range v.rules {
+			if !matches(rule, u) {
+				continue
+			}
+			message := rule.Message
+			out, _, err := v.programs[i].Eval(map[string]interface{}{"object": u.Object})
+			if err == nil {
+				if valid, ok := out.Value().(bool); ok && valid {
+					continue
+				} else if !ok {
+					err = fmt.Errorf("expression returned %v instead of a bool", out.Value())
+				}
+			}
+			if err != nil {
+				message = fmt.Sprintf("error evaluating the expression: %s", err)
+			}
+			violations = append(violations, Violation{
+				Rule:      rule.Name,
+				Severity:  rule.Severity,
+				Message:   message,
+				Kind:      u.GetKind(),
+				Namespace: u.GetNamespace(),
+				Name:      u.GetName(),
+			})
+		}
+	}
+	return violations
+}
+
+//Validate evaluates the rules, reports the warnings to OnWarning
+//and returns a ViolationsError holding the violations of the deny rules.
+func (v *Validator) Validate(us []*unstructured.Unstructured) error {
+	denied := make([]Violation, 0)
+	for _, violation := range v.Evaluate(us) {
+		if violation.Severity == SeverityDeny {
+			denied = append(denied, violation)
+			continue
+		}
+		klog.Warning(violation.String())
+		if v.OnWarning != nil {
+			v.OnWarning(violation)
+		}
+	}
+	if len(denied) != 0 {
+		return &ViolationsError{Violations: denied}
+	}
+	return nil
+}
+
+func matches(rule Rule, u *unstructured.Unstructured) bool {
+	if len(rule.Match) == 0 {
+		return true
+	}
+	for _, m := range rule.Match {
+		if (m.APIVersion == "" || m.APIVersion == u.GetAPIVersion()) &&
+			(m.Kind == "" || m.Kind == u.GetKind()) {
+			return true
+		}
+	}
+	return false
+}
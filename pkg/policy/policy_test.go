@@ -0,0 +1,176 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var assets = map[string]string{
+	"deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+        resources:
+          limits:
+            cpu: 100m
+      - name: sidecar
+        image: sidecar:1.0
+      volumes:
+      - name: host
+        hostPath:
+          path: /var/run`,
+	"configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default`,
+}
+
+const rulesFile = `
+rules:
+- name: resource-limits
+  match:
+  - apiVersion: apps/v1
+    kind: Deployment
+  expression: object.spec.template.spec.containers.all(c, has(c.resources) && has(c.resources.limits))
+  message: containers must set resource limits
+  severity: warn
+- name: no-host-path
+  match:
+  - kind: Deployment
+  expression: "!has(object.spec.template.spec.volumes) || object.spec.template.spec.volumes.all(v, !has(v.hostPath))"
+  message: hostPath volumes are not allowed
+- name: namespaced
+  expression: has(object.metadata.namespace)
+`
+
+func TestValidator_Validate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.yaml")
+	err = ioutil.WriteFile(path, []byte(rulesFile), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("Unable to load the rules %s", err.Error())
+	}
+	v, err := NewValidator(rules)
+	if err != nil {
+		t.Fatalf("Unable to create the validator %s", err.Error())
+	}
+	warnings := make([]Violation, 0)
+	v.OnWarning = func(violation Violation) {
+		warnings = append(warnings, violation)
+	}
+	tp, err := templateprocessor.NewTemplateProcessor(templateprocessor.NewTestReader(assets),
+		&templateprocessor.Options{Validators: []templateprocessor.Validator{v}})
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+
+	_, err = tp.TemplateResourcesUnstructured([]string{"configmap"}, nil)
+	if err != nil {
+		t.Errorf("Expected no violation, got %s", err)
+	}
+
+	_, err = tp.TemplateResourcesUnstructured([]string{"deployment", "configmap"}, nil)
+	if !IsViolationsError(err) {
+		t.Fatalf("Expected a ViolationsError, got %v", err)
+	}
+	wantDenied := []Violation{{
+		Rule:      "no-host-path",
+		Severity:  SeverityDeny,
+		Message:   "hostPath volumes are not allowed",
+		Kind:      "Deployment",
+		Namespace: "default",
+		Name:      "app",
+	}}
+	if !reflect.DeepEqual(err.(*ViolationsError).Violations, wantDenied) {
+		t.Errorf("Expected %v, got %v", wantDenied, err.(*ViolationsError).Violations)
+	}
+	wantWarnings := []Violation{{
+		Rule:      "resource-limits",
+		Severity:  SeverityWarn,
+		Message:   "containers must set resource limits",
+		Kind:      "Deployment",
+		Namespace: "default",
+		Name:      "app",
+	}}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("Expected %v, got %v", wantWarnings, warnings)
+	}
+}
+
+func TestNewValidator(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			rule: Rule{Name: "valid", Expression: "object.kind == 'ConfigMap'"},
+		},
+		{
+			name:    "syntax error",
+			rule:    Rule{Name: "invalid", Expression: "object.kind =="},
+			wantErr: true,
+		},
+		{
+			name:    "not a bool",
+			rule:    Rule{Name: "string", Expression: "'a' + 'b'"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid severity",
+			rule:    Rule{Name: "severity", Expression: "true", Severity: "info"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewValidator([]Rule{tt.rule})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewValidator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidator_Evaluate_Error(t *testing.T) {
+	v, err := NewValidator([]Rule{{Name: "replicas", Expression: "object.spec.replicas > 1"}})
+	if err != nil {
+		t.Fatalf("Unable to create the validator %s", err.Error())
+	}
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "config"},
+	}}
+	violations := v.Evaluate([]*unstructured.Unstructured{u})
+	if len(violations) != 1 || violations[0].Severity != SeverityDeny {
+		t.Errorf("Expected a deny violation, got %v", violations)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//BundleFinding is an issue found by the BundleValidator on a rendered resource
+type BundleFinding struct {
+	Kind      string
+	Namespace string
+	Name      string
+	//The template the resource was rendered from, empty if unknown
+	Source  string
+	Message string
+}
+
+func (f BundleFinding) String() string {
+	if f.Source == "" {
+		return fmt.Sprintf("%s %s/%s: %s", f.Kind, f.Namespace, f.Name, f.Message)
+	}
+	return fmt.Sprintf("%s %s/%s (%s): %s", f.Kind, f.Namespace, f.Name, f.Source, f.Message)
+}
+
+//BundleError is returned by the BundleValidator when issues are found
+type BundleError struct {
+	Findings []BundleFinding
+}
+
+func (e *BundleError) Error() string {
+	findings := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		findings[i] = f.String()
+	}
+	return fmt.Sprintf("invalid bundle:\n%s", strings.Join(findings, "\n"))
+}
+
+//IsBundleError returns true if the error is a BundleError
+func IsBundleError(err error) bool {
+	_, ok := err.(*BundleError)
+	return ok
+}
+
+//BundleReference identifies a resource which exists outside of the bundle,
+//the Namespace is empty for a cluster scoped resource.
+type BundleReference struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+//BundleValidator validates a rendered bundle, it reports:
+//- the resources rendered more than once
+//- the RoleBindings and ClusterRoleBindings to missing Roles, ClusterRoles or ServiceAccounts
+//- the Pods and workloads using missing ConfigMaps, Secrets or ServiceAccounts
+//- the Services with a selector matching no rendered pod template
+//The built-in ClusterRoles and the default ServiceAccount are considered as existing.
+type BundleValidator struct {
+	//The resources referenced by the bundle which exist outside of it
+	External []BundleReference
+}
+
+var _ SourceValidator = &BundleValidator{}
+
+//builtInClusterRoles are the user-facing ClusterRoles created by kubernetes
+var builtInClusterRoles = map[string]bool{
+	"cluster-admin": true,
+	"admin":         true,
+	"edit":          true,
+	"view":          true,
+}
+
+//Validate returns a BundleError if issues are found
+func (v *BundleValidator) Validate(us []*unstructured.Unstructured) error {
+	return v.ValidateSources(us, nil)
+}
+
+//ValidateSources returns a BundleError if issues are found, the findings name the source templates
+func (v *BundleValidator) ValidateSources(us []*unstructured.Unstructured, sources Sources) error {
+	findings := v.Findings(us, sources)
+	if len(findings) != 0 {
+		return &BundleError{Findings: findings}
+	}
+	return nil
+}
+
+//Findings returns the issues found in the bundle
+func (v *BundleValidator) Findings(us []*unstructured.Unstructured, sources Sources) []BundleFinding {
+	b := &bundle{
+		resources: make(map[BundleReference]bool),
+		sources:   sources,
+		findings:  make([]BundleFinding, 0),
+	}
+	for _, r := range v.External {
+		b.resources[r] = true
+	}
+	rendered := make(map[string]*unstructured.Unstructured)
+	for _, u := range us {
+		if u.GetName() == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s/%s/%s/%s", u.GroupVersionKind().Group, u.GetKind(), u.GetNamespace(), u.GetName())
+		if first, ok := rendered[key]; ok {
+			b.report(u, "duplicate of the resource rendered from %s", b.source(first))
+			continue
+		}
+		rendered[key] = u
+		b.resources[BundleReference{Kind: u.GetKind(), Namespace: u.GetNamespace(), Name: u.GetName()}] = true
+	}
+	podTemplates := make([]*unstructured.Unstructured, 0)
+	for _, u := range us {
+		switch u.GetKind() {
+		case "RoleBinding", "ClusterRoleBinding":
+			b.checkBinding(u)
+		case "Pod":
+			b.checkPodSpec(u, u.Object["spec"])
+			podTemplates = append(podTemplates, u)
+		default:
+			if path, ok := podTemplatePaths[u.GetKind()]; ok {
+				template, _, _ := unstructured.NestedMap(u.Object, path...)
+				b.checkPodSpec(u, template["spec"])
+				podTemplates = append(podTemplates, u)
+			}
+		}
+	}
+	for _, u := range us {
+		if u.GetKind() == "Service" {
+			b.checkService(u, podTemplates)
+		}
+	}
+	return b.findings
+}
+
+//bundle holds the state of a validation
+type bundle struct {
+	resources map[BundleReference]bool
+	sources   Sources
+	findings  []BundleFinding
+}
+
+func (b *bundle) source(u *unstructured.Unstructured) string {
+	if s, ok := b.sources[u]; ok {
+		return s
+	}
+	return "an unknown template"
+}
+
+func (b *bundle) report(u *unstructured.Unstructured, format string, a ...interface{}) {
+	b.findings = append(b.findings, BundleFinding{
+		Kind:      u.GetKind(),
+		Namespace: u.GetNamespace(),
+		Name:      u.GetName(),
+		Source:    b.sources[u],
+		Message:   fmt.Sprintf(format, a...),
+	})
+}
+
+//checkReference reports a reference to a resource missing in the bundle
+func (b *bundle) checkReference(u *unstructured.Unstructured, kind, namespace, name string) {
+	if name == "" || b.resources[BundleReference{Kind: kind, Namespace: namespace, Name: name}] {
+		return
+	}
+	if namespace == "" {
+		b.report(u, "references the missing %s %s", kind, name)
+		return
+	}
+	b.report(u, "references the missing %s %s/%s", kind, namespace, name)
+}
+
+func (b *bundle) checkBinding(u *unstructured.Unstructured) {
+	kind, _, _ := unstructured.NestedString(u.Object, "roleRef", "kind")
+	name, _, _ := unstructured.NestedString(u.Object, "roleRef", "name")
+	switch kind {
+	case "Role":
+		b.checkReference(u, kind, u.GetNamespace(), name)
+	case "ClusterRole":
+		if !builtInClusterRoles[name] && !strings.HasPrefix(name, "system:") {
+			b.checkReference(u, kind, "", name)
+		}
+	}
+	subjects, _, _ := unstructured.NestedSlice(u.Object, "subjects")
+	for _, s := range subjects {
+		subject, ok := s.(map[string]interface{})
+		if !ok || subject["kind"] != "ServiceAccount" {
+			continue
+		}
+		name, _ := subject["name"].(string)
+		namespace, _ := subject["namespace"].(string)
+		if namespace == "" {
+			namespace = u.GetNamespace()
+		}
+		b.checkServiceAccount(u, namespace, name)
+	}
+}
+
+func (b *bundle) checkServiceAccount(u *unstructured.Unstructured, namespace, name string) {
+	if name != "default" {
+		b.checkReference(u, "ServiceAccount", namespace, name)
+	}
+}
+
+//checkPodSpec reports the ServiceAccount, ConfigMaps and Secrets used by the pod spec and missing in the bundle
+func (b *bundle) checkPodSpec(u *unstructured.Unstructured, podSpec interface{}) {
+	spec, ok := podSpec.(map[string]interface{})
+	if !ok {
+		return
+	}
+	namespace := u.GetNamespace()
+	serviceAccountName, _, _ := unstructured.NestedString(spec, "serviceAccountName")
+	if serviceAccountName == "" {
+		serviceAccountName, _, _ = unstructured.NestedString(spec, "serviceAccount")
+	}
+	b.checkServiceAccount(u, namespace, serviceAccountName)
+	for _, s := range nestedMaps(spec, "imagePullSecrets") {
+		name, _ := s["name"].(string)
+		b.checkReference(u, "Secret", namespace, name)
+	}
+	for _, volume := range nestedMaps(spec, "volumes") {
+		b.checkConfigMapOrSecret(u, volume, "configMap", "name", "ConfigMap")
+		b.checkConfigMapOrSecret(u, volume, "secret", "secretName", "Secret")
+		projected, _ := volume["projected"].(map[string]interface{})
+		for _, source := range nestedMaps(projected, "sources") {
+			b.checkConfigMapOrSecret(u, source, "configMap", "name", "ConfigMap")
+			b.checkConfigMapOrSecret(u, source, "secret", "name", "Secret")
+		}
+	}
+	containers := append(nestedMaps(spec, "containers"), nestedMaps(spec, "initContainers")...)
+	for _, container := range containers {
+		for _, envFrom := range nestedMaps(container, "envFrom") {
+			b.checkConfigMapOrSecret(u, envFrom, "configMapRef", "name", "ConfigMap")
+			b.checkConfigMapOrSecret(u, envFrom, "secretRef", "name", "Secret")
+		}
+		for _, env := range nestedMaps(container, "env") {
+			valueFrom, _ := env["valueFrom"].(map[string]interface{})
+			b.checkConfigMapOrSecret(u, valueFrom, "configMapKeyRef", "name", "ConfigMap")
+			b.checkConfigMapOrSecret(u, valueFrom, "secretKeyRef", "name", "Secret")
+		}
+	}
+}
+
+//checkConfigMapOrSecret checks the reference at field/nameField of the object unless it is optional
+func (b *bundle) checkConfigMapOrSecret(
+	u *unstructured.Unstructured,
+	object map[string]interface{},
+	field, nameField, kind string,
+) {
+	ref, ok := object[field].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if optional, _ := ref["optional"].(bool); optional {
+		return
+	}
+	name, _ := ref[nameField].(string)
+	b.checkReference(u, kind, u.GetNamespace(), name)
+}
+
+//checkService reports a Service which selector matches no pod template of its namespace
+func (b *bundle) checkService(u *unstructured.Unstructured, podTemplates []*unstructured.Unstructured) {
+	selector, _, _ := unstructured.NestedStringMap(u.Object, "spec", "selector")
+	if len(selector) == 0 {
+		return
+	}
+	for _, p := range podTemplates {
+		if p.GetNamespace() != u.GetNamespace() {
+			continue
+		}
+		labels := p.GetLabels()
+		if path, ok := podTemplatePaths[p.GetKind()]; ok {
+			labels, _, _ = unstructured.NestedStringMap(p.Object,
+				append(append([]string{}, path...), "metadata", "labels")...)
+		}
+		if matchesSelector(labels, selector) {
+			return
+		}
+	}
+	b.report(u, "selector %v matches no rendered pod template", selector)
+}
+
+func matchesSelector(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+//nestedMaps returns the objects of the list at field, ignoring the items which are not objects
+func nestedMaps(object map[string]interface{}, field string) []map[string]interface{} {
+	list, _ := object[field].([]interface{})
+	maps := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			maps = append(maps, m)
+		}
+	}
+	return maps
+}
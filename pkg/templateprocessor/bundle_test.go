@@ -0,0 +1,215 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var bundleAssets = map[string]string{
+	"bundle/serviceaccount.yaml": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns`,
+	"bundle/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myconfig
+  namespace: myns`,
+	"bundle/configmap-copy.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myconfig
+  namespace: myns`,
+	"bundle/rolebinding.yaml": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: mybinding
+  namespace: myns
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: myrole
+subjects:
+- kind: ServiceAccount
+  name: mysa
+- kind: ServiceAccount
+  name: othersa
+  namespace: otherns`,
+	"bundle/clusterrolebinding.yaml": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: myclusterbinding
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: view
+subjects:
+- kind: ServiceAccount
+  name: mysa
+  namespace: myns`,
+	"bundle/deployment.yaml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+spec:
+  selector:
+    matchLabels:
+      app: myapp
+  template:
+    metadata:
+      labels:
+        app: myapp
+    spec:
+      serviceAccountName: mysa
+      containers:
+      - name: mycontainer
+        image: myimage
+        envFrom:
+        - configMapRef:
+            name: myconfig
+        - secretRef:
+            name: optionalsecret
+            optional: true
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: mysecret
+              key: password
+      volumes:
+      - name: config
+        configMap:
+          name: missingconfig`,
+	"bundle/service.yaml": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: myservice
+  namespace: myns
+spec:
+  selector:
+    app: myapp
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: otherservice
+  namespace: myns
+spec:
+  selector:
+    app: otherapp`,
+}
+
+func TestBundleValidator_Findings(t *testing.T) {
+	tests := []struct {
+		name         string
+		validator    *BundleValidator
+		wantFindings []BundleFinding
+	}{
+		{
+			name:      "findings",
+			validator: &BundleValidator{},
+			wantFindings: []BundleFinding{
+				{
+					Kind:      "ConfigMap",
+					Namespace: "myns",
+					Name:      "myconfig",
+					Source:    "bundle/configmap.yaml",
+					Message:   "duplicate of the resource rendered from bundle/configmap-copy.yaml",
+				},
+				{
+					Kind:      "Deployment",
+					Namespace: "myns",
+					Name:      "mydeployment",
+					Source:    "bundle/deployment.yaml",
+					Message:   "references the missing ConfigMap myns/missingconfig",
+				},
+				{
+					Kind:      "Deployment",
+					Namespace: "myns",
+					Name:      "mydeployment",
+					Source:    "bundle/deployment.yaml",
+					Message:   "references the missing Secret myns/mysecret",
+				},
+				{
+					Kind:      "RoleBinding",
+					Namespace: "myns",
+					Name:      "mybinding",
+					Source:    "bundle/rolebinding.yaml",
+					Message:   "references the missing Role myns/myrole",
+				},
+				{
+					Kind:      "RoleBinding",
+					Namespace: "myns",
+					Name:      "mybinding",
+					Source:    "bundle/rolebinding.yaml",
+					Message:   "references the missing ServiceAccount otherns/othersa",
+				},
+				{
+					Kind:      "Service",
+					Namespace: "myns",
+					Name:      "otherservice",
+					Source:    "bundle/service.yaml",
+					Message:   "selector map[app:otherapp] matches no rendered pod template",
+				},
+			},
+		},
+		{
+			name: "external references",
+			validator: &BundleValidator{External: []BundleReference{
+				{Kind: "Role", Namespace: "myns", Name: "myrole"},
+				{Kind: "ServiceAccount", Namespace: "otherns", Name: "othersa"},
+				{Kind: "ConfigMap", Namespace: "myns", Name: "missingconfig"},
+				{Kind: "Secret", Namespace: "myns", Name: "mysecret"},
+			}},
+			wantFindings: []BundleFinding{
+				{
+					Kind:      "ConfigMap",
+					Namespace: "myns",
+					Name:      "myconfig",
+					Source:    "bundle/configmap.yaml",
+					Message:   "duplicate of the resource rendered from bundle/configmap-copy.yaml",
+				},
+				{
+					Kind:      "Service",
+					Namespace: "myns",
+					Name:      "otherservice",
+					Source:    "bundle/service.yaml",
+					Message:   "selector map[app:otherapp] matches no rendered pod template",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(bundleAssets),
+				&Options{Validators: []Validator{tt.validator}})
+			if err != nil {
+				t.Fatalf("Unable to create the template processor %s", err.Error())
+			}
+			names, err := tp.AssetNamesInPath("bundle", nil, false)
+			if err != nil {
+				t.Fatalf("Unable to list the assets %s", err.Error())
+			}
+			sort.Strings(names)
+			_, err = tp.TemplateResourcesUnstructured(names, nil)
+			if !IsBundleError(err) {
+				t.Fatalf("Expected a BundleError, got %v", err)
+			}
+			if !reflect.DeepEqual(err.(*BundleError).Findings, tt.wantFindings) {
+				t.Errorf("Expected findings:\n%v\ngot:\n%v", tt.wantFindings, err.(*BundleError).Findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	libgoclient "github.com/stolostron/library-go/pkg/client"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog"
+)
+
+//DefaultKubeVersion is the kubernetes version of the DefaultCapabilities, the version of the client libraries
+const DefaultKubeVersion = "v1.18.6"
+
+//CapabilitiesValuesKey is the key of the Options.Capabilities in the values
+const CapabilitiesValuesKey = "Capabilities"
+
+//openShiftGroupVersions are the API versions which are only served by OpenShift
+var openShiftGroupVersions = []string{"config.openshift.io/v1", "route.openshift.io/v1"}
+
+//Capabilities describes the cluster the templates are rendered for,
+//exposed as .Capabilities to the charts.
+//It can be saved in yaml or json and loaded with LoadCapabilities to render offline.
+type Capabilities struct {
+	//The kubernetes version
+	KubeVersion KubeVersion `json:"kubeVersion"`
+	//The available API versions, as group/version and group/version/kind
+	APIVersions VersionSet `json:"apiVersions"`
+	//True if the cluster is an OpenShift cluster
+	IsOpenShift bool `json:"isOpenShift"`
+}
+
+//KubeVersion is a kubernetes version, serialized as its Version
+type KubeVersion struct {
+	//The full version, for example v1.18.6
+	Version string
+	Major   string
+	Minor   string
+}
+
+//String returns the Version
+func (kv KubeVersion) String() string {
+	return kv.Version
+}
+
+//GitVersion returns the Version
+func (kv KubeVersion) GitVersion() string {
+	return kv.Version
+}
+
+//MarshalJSON serializes the Version
+func (kv KubeVersion) MarshalJSON() ([]byte, error) {
+	return json.Marshal(kv.Version)
+}
+
+//UnmarshalJSON parses the Version
+func (kv *KubeVersion) UnmarshalJSON(b []byte) error {
+	var version string
+	err := json.Unmarshal(b, &version)
+	if err != nil {
+		return err
+	}
+	*kv, err = NewKubeVersion(version)
+	return err
+}
+
+//VersionSet is a set of API versions, as group/version and group/version/kind,
+//for example apps/v1 and apps/v1/Deployment
+type VersionSet []string
+
+//Has returns true if the API version is available
+func (v VersionSet) Has(apiVersion string) bool {
+	for _, version := range v {
+		if version == apiVersion {
+			return true
+		}
+	}
+	return false
+}
+
+//NewKubeVersion parses a version like v1.18.6 or v1.18.6+k3s1
+func NewKubeVersion(version string) (KubeVersion, error) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return KubeVersion{}, fmt.Errorf("Invalid kubernetes version %s", version)
+	}
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return KubeVersion{
+		Version: version,
+		Major:   parts[0],
+		Minor:   strings.TrimRight(parts[1], "+"),
+	}, nil
+}
+
+//DefaultCapabilities returns the capabilities of the DefaultKubeVersion
+//with the API versions of the client-go scheme
+func DefaultCapabilities() *Capabilities {
+	kubeVersion, _ := NewKubeVersion(DefaultKubeVersion)
+	return &Capabilities{
+		KubeVersion: kubeVersion,
+		APIVersions: schemeVersionSet(scheme.Scheme),
+	}
+}
+
+//NewCapabilities returns the capabilities of a cluster using the discovery API,
+//the groups which failed to be discovered, for example an unavailable aggregated API, are skipped.
+//discovery: The discovery client, for example kubernetes.Interface.Discovery()
+func NewCapabilities(d discovery.DiscoveryInterface) (*Capabilities, error) {
+	serverVersion, err := d.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	kubeVersion, err := NewKubeVersion(serverVersion.GitVersion)
+	if err != nil {
+		return nil, err
+	}
+	groups, resources, err := d.ServerGroupsAndResources()
+	if err != nil {
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return nil, err
+		}
+		klog.V(1).Infof("Some API groups are skipped: %s", err.Error())
+	}
+	set := make(map[string]bool)
+	for _, group := range groups {
+		for _, version := range group.Versions {
+			set[version.GroupVersion] = true
+		}
+	}
+	for _, list := range resources {
+		for _, resource := range list.APIResources {
+			//Skip the subresources
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+			set[list.GroupVersion+"/"+resource.Kind] = true
+		}
+	}
+	capabilities := &Capabilities{
+		KubeVersion: kubeVersion,
+		APIVersions: toVersionSet(set),
+	}
+	capabilities.IsOpenShift = isOpenShift(d)
+	klog.V(2).Infof("Capabilities: kubernetes %s, %d API versions, OpenShift %t",
+		kubeVersion, len(capabilities.APIVersions), capabilities.IsOpenShift)
+	return capabilities, nil
+}
+
+//LoadCapabilities reads capabilities saved in yaml or json, for example:
+//
+//	kubeVersion: v1.21.1
+//	apiVersions: [v1, policy/v1, policy/v1/PodDisruptionBudget, route.openshift.io/v1]
+//
+//The DefaultKubeVersion is used if kubeVersion is not set and
+//isOpenShift is true if not set and an OpenShift API group is available.
+func LoadCapabilities(path string) (*Capabilities, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	capabilities := &Capabilities{}
+	err = yaml.Unmarshal(b, capabilities)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid capabilities %s: %s", path, err)
+	}
+	if capabilities.KubeVersion.Version == "" {
+		capabilities.KubeVersion, _ = NewKubeVersion(DefaultKubeVersion)
+	}
+	if !capabilities.IsOpenShift {
+		capabilities.IsOpenShift = capabilities.hasOpenShiftGroup()
+	}
+	return capabilities, nil
+}
+
+func (c *Capabilities) hasOpenShiftGroup() bool {
+	for _, groupVersion := range openShiftGroupVersions {
+		if c.APIVersions.Has(groupVersion) {
+			return true
+		}
+	}
+	return false
+}
+
+//isOpenShift returns true if the cluster serves an OpenShift API version
+func isOpenShift(d discovery.DiscoveryInterface) bool {
+	for _, groupVersion := range openShiftGroupVersions {
+		if libgoclient.HaveServerResourcesWithDiscovery(d, []string{groupVersion}) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+//injectCapabilities returns a copy of the map values with the Options.Capabilities
+//as CapabilitiesValuesKey, the values are returned as is if they are not a map
+//or if they already have a CapabilitiesValuesKey
+func (tp *TemplateProcessor) injectCapabilities(values interface{}) interface{} {
+	if tp.options.Capabilities == nil {
+		return values
+	}
+	m := map[string]interface{}{}
+	if values != nil {
+		var ok bool
+		m, ok = toStringMap(values)
+		if !ok {
+			klog.V(2).Infof("The capabilities are only added to map values, not to %T", values)
+			return values
+		}
+	}
+	if _, ok := m[CapabilitiesValuesKey]; ok {
+		klog.V(2).Infof("The values already have a %s", CapabilitiesValuesKey)
+		return values
+	}
+	withCapabilities := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		withCapabilities[k] = v
+	}
+	withCapabilities[CapabilitiesValuesKey] = tp.options.Capabilities
+	return withCapabilities
+}
+
+//schemeVersionSet returns the versions and kinds known by a scheme
+func schemeVersionSet(s *runtime.Scheme) VersionSet {
+	set := make(map[string]bool)
+	for gvk := range s.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal {
+			continue
+		}
+		gv := gvk.GroupVersion().String()
+		set[gv] = true
+		set[gv+"/"+gvk.Kind] = true
+	}
+	return toVersionSet(set)
+}
+
+func toVersionSet(set map[string]bool) VersionSet {
+	versions := make(VersionSet, 0, len(set))
+	for v := range set {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
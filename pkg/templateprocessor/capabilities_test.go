@@ -0,0 +1,187 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewCapabilities(t *testing.T) {
+	kubeClient := fakekubeclient.NewSimpleClientset()
+	fakeDiscovery := kubeClient.Discovery().(*fakediscovery.FakeDiscovery)
+	fakeDiscovery.FakedServerVersion = &version.Info{GitVersion: "v1.21.1+6438632"}
+	fakeDiscovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "policy/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "poddisruptionbudgets", Kind: "PodDisruptionBudget"},
+				{Name: "poddisruptionbudgets/status", Kind: "PodDisruptionBudget"},
+			},
+		},
+		{
+			GroupVersion: "route.openshift.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "routes", Kind: "Route"},
+			},
+		},
+	}
+	capabilities, err := NewCapabilities(kubeClient.Discovery())
+	if err != nil {
+		t.Fatalf("Unable to discover the capabilities %s", err.Error())
+	}
+	want := &Capabilities{
+		KubeVersion: KubeVersion{Version: "v1.21.1+6438632", Major: "1", Minor: "21"},
+		APIVersions: VersionSet{
+			"policy/v1",
+			"policy/v1/PodDisruptionBudget",
+			"route.openshift.io/v1",
+			"route.openshift.io/v1/Route",
+		},
+		IsOpenShift: true,
+	}
+	if !reflect.DeepEqual(capabilities, want) {
+		t.Errorf("Expected %v, got %v", want, capabilities)
+	}
+}
+
+func TestLoadCapabilities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capabilities")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name    string
+		content string
+		want    *Capabilities
+		wantErr bool
+	}{
+		{
+			name:    "openshift",
+			content: "kubeVersion: v1.21.1\napiVersions: [v1, config.openshift.io/v1]\n",
+			want: &Capabilities{
+				KubeVersion: KubeVersion{Version: "v1.21.1", Major: "1", Minor: "21"},
+				APIVersions: VersionSet{"v1", "config.openshift.io/v1"},
+				IsOpenShift: true,
+			},
+		},
+		{
+			name:    "default version",
+			content: `{"apiVersions": ["v1"]}`,
+			want: &Capabilities{
+				KubeVersion: KubeVersion{Version: DefaultKubeVersion, Major: "1", Minor: "18"},
+				APIVersions: VersionSet{"v1"},
+			},
+		},
+		{
+			name:    "invalid version",
+			content: "kubeVersion: latest\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "capabilities.yaml")
+			err := ioutil.WriteFile(path, []byte(tt.content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadCapabilities(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadCapabilities() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCapabilities_RoundTrip(t *testing.T) {
+	capabilities := DefaultCapabilities()
+	b, err := yaml.Marshal(capabilities)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &Capabilities{}
+	err = yaml.Unmarshal(b, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, capabilities) {
+		t.Errorf("Expected the capabilities unchanged, got %s", string(b))
+	}
+}
+
+func TestTemplateProcessor_Capabilities(t *testing.T) {
+	assets := map[string]string{
+		"capabilities/pdb.yaml": `
+apiVersion: {{ if .Capabilities.APIVersions.Has "policy/v1/PodDisruptionBudget" }}policy/v1{{ else }}policy/v1beta1{{ end }}
+kind: PodDisruptionBudget
+metadata:
+  name: {{ .name }}
+  namespace: default
+  annotations:
+    openshift: "{{ .Capabilities.IsOpenShift }}"
+    minor: "{{ .Capabilities.KubeVersion.Minor }}"`,
+	}
+	tests := []struct {
+		name            string
+		capabilities    *Capabilities
+		values          interface{}
+		wantAPIVersion  string
+		wantAnnotations map[string]string
+	}{
+		{
+			name: "policy/v1",
+			capabilities: &Capabilities{
+				KubeVersion: KubeVersion{Version: "v1.21.1", Major: "1", Minor: "21"},
+				APIVersions: VersionSet{"policy/v1", "policy/v1/PodDisruptionBudget"},
+			},
+			values:          map[string]interface{}{"name": "pdb"},
+			wantAPIVersion:  "policy/v1",
+			wantAnnotations: map[string]string{"openshift": "false", "minor": "21"},
+		},
+		{
+			name:            "default capabilities",
+			capabilities:    DefaultCapabilities(),
+			values:          map[string]interface{}{"name": "pdb"},
+			wantAPIVersion:  "policy/v1beta1",
+			wantAnnotations: map[string]string{"openshift": "false", "minor": "18"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(assets), &Options{Capabilities: tt.capabilities})
+			if err != nil {
+				t.Fatalf("Unable to create the template processor %s", err.Error())
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured("capabilities", nil, false, tt.values)
+			if err != nil {
+				t.Fatalf("Unable to render %s", err.Error())
+			}
+			if len(us) != 1 {
+				t.Fatalf("Expected 1 resource, got %d", len(us))
+			}
+			if us[0].GetAPIVersion() != tt.wantAPIVersion {
+				t.Errorf("Expected %s, got %s", tt.wantAPIVersion, us[0].GetAPIVersion())
+			}
+			if !reflect.DeepEqual(us[0].GetAnnotations(), tt.wantAnnotations) {
+				t.Errorf("Expected annotations %v, got %v", tt.wantAnnotations, us[0].GetAnnotations())
+			}
+			if _, ok := tt.values.(map[string]interface{})[CapabilitiesValuesKey]; ok {
+				t.Errorf("Expected the values of the caller unchanged")
+			}
+		})
+	}
+}
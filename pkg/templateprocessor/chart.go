@@ -0,0 +1,554 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/ghodss/yaml"
+	libvalues "github.com/stolostron/library-go/pkg/values"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog"
+)
+
+const (
+	//ChartFileName is the chart metadata file
+	ChartFileName = "Chart.yaml"
+	//ChartValuesFileName is the file of the default values of a chart
+	ChartValuesFileName = "values.yaml"
+	//ChartNotesFileName is the template of the notes displayed after the install of a chart
+	ChartNotesFileName = "NOTES.txt"
+	//DefaultReleaseName is the name of the release if ChartOptions.Release.Name is not set
+	DefaultReleaseName = "release-name"
+)
+
+//ChartMetadata is the content of the Chart.yaml, exposed as .Chart to the templates
+type ChartMetadata struct {
+	APIVersion   string            `json:"apiVersion,omitempty"`
+	Name         string            `json:"name"`
+	Version      string            `json:"version,omitempty"`
+	AppVersion   string            `json:"appVersion,omitempty"`
+	KubeVersion  string            `json:"kubeVersion,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Type         string            `json:"type,omitempty"`
+	Home         string            `json:"home,omitempty"`
+	Icon         string            `json:"icon,omitempty"`
+	Keywords     []string          `json:"keywords,omitempty"`
+	Sources      []string          `json:"sources,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Dependencies []ChartDependency `json:"dependencies,omitempty"`
+}
+
+//ChartDependency is a subchart declared in the Chart.yaml
+type ChartDependency struct {
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	//Comma separated paths of boolean values enabling the subchart, the first path found is used
+	Condition string `json:"condition,omitempty"`
+	//The name of the subchart in the values
+	Alias string `json:"alias,omitempty"`
+}
+
+//Release describes the release of a chart, exposed as .Release to the templates
+type Release struct {
+	//The name of the release, DefaultReleaseName if not set
+	Name string
+	//The namespace of the release, the Options.Namespace or default if not set
+	Namespace string
+	//The revision of the release, 1 if not set
+	Revision int
+	//True for a first install, the default if IsUpgrade is not set
+	IsInstall bool
+	//True for an upgrade
+	IsUpgrade bool
+	//The service rendering the chart, Helm if not set as the charts use it in their labels
+	Service string
+}
+
+//ChartOptions defines how a chart is rendered
+type ChartOptions struct {
+	Release Release
+	//The values overriding the values.yaml of the chart
+	Values map[string]interface{}
+	//The capabilities of the cluster, the Options.Capabilities or DefaultCapabilities if not set
+	Capabilities *Capabilities
+}
+
+//RenderedChart is the result of the rendering of a chart
+type RenderedChart struct {
+	Metadata *ChartMetadata
+	//The rendered resources, sorted for apply
+	Resources []*unstructured.Unstructured
+	//The rendered NOTES.txt of the chart
+	Notes string
+}
+
+//Files are the files of a chart which are not templates, exposed as .Files to the templates
+type Files map[string][]byte
+
+//Get returns the content of a file, empty if not found
+func (f Files) Get(name string) string {
+	return string(f.GetBytes(name))
+}
+
+//GetBytes returns the content of a file, nil if not found
+func (f Files) GetBytes(name string) []byte {
+	return f[name]
+}
+
+//Glob returns the files matching the pattern
+func (f Files) Glob(pattern string) Files {
+	matches := make(Files)
+	for name, b := range f {
+		if ok, _ := path.Match(pattern, name); ok {
+			matches[name] = b
+		}
+	}
+	return matches
+}
+
+//Lines returns the lines of a file
+func (f Files) Lines(name string) []string {
+	s := f.Get(name)
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+//AsConfig returns the files as the yaml data of a ConfigMap, keyed by their base name
+func (f Files) AsConfig() string {
+	m := make(map[string]string, len(f))
+	for name, b := range f {
+		m[path.Base(name)] = string(b)
+	}
+	y, _ := yaml.Marshal(m)
+	return strings.TrimSuffix(string(y), "\n")
+}
+
+//AsSecrets returns the files as the yaml data of a Secret, keyed by their base name
+func (f Files) AsSecrets() string {
+	m := make(map[string]string, len(f))
+	for name, b := range f {
+		m[path.Base(name)] = base64.StdEncoding.EncodeToString(b)
+	}
+	y, _ := yaml.Marshal(m)
+	return strings.TrimSuffix(string(y), "\n")
+}
+
+//chart is a chart or a subchart being rendered
+type chart struct {
+	//The directory of the chart in the reader
+	path string
+	//The name of the chart in the templates, for example parent/charts/child
+	fullName  string
+	metadata  *ChartMetadata
+	values    map[string]interface{}
+	files     Files
+	templates []string
+	notes     string
+	subcharts []*chart
+}
+
+//TemplateChart renders a directory laid out as a Helm chart: the Chart.yaml, the values.yaml,
+//the templates of the templates directory, the partials named _* of all the charts are shared,
+//the NOTES.txt and the unpacked subcharts of the charts directory.
+//The templates get the .Values, .Release, .Chart, .Capabilities, .Files and .Template objects,
+//the lookup function reads the existing objects with the Options.LookupClient.
+//The values are validated against the values.schema.json of each chart if any.
+//The namespaced resources without namespace get the namespace of the release.
+func (tp *TemplateProcessor) TemplateChart(chartPath string, options *ChartOptions) (*RenderedChart, error) {
+	if options == nil {
+		options = &ChartOptions{}
+	}
+	release := options.Release
+	if release.Name == "" {
+		release.Name = DefaultReleaseName
+	}
+	if release.Namespace == "" {
+		release.Namespace = tp.options.Namespace
+	}
+	if release.Namespace == "" {
+		release.Namespace = "default"
+	}
+	if release.Revision == 0 {
+		release.Revision = 1
+	}
+	if !release.IsInstall && !release.IsUpgrade {
+		release.IsInstall = true
+	}
+	if release.Service == "" {
+		release.Service = "Helm"
+	}
+	capabilities := options.Capabilities
+	if capabilities == nil {
+		capabilities = tp.options.Capabilities
+	}
+	if capabilities == nil {
+		capabilities = DefaultCapabilities()
+	}
+	names, err := tp.reader.AssetNames()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	root, err := tp.loadChart(cleanChartPath(chartPath), "", names)
+	if err != nil {
+		return nil, err
+	}
+	root.values = libvalues.Merge(libvalues.Merge(nil, root.values), options.Values)
+	err = tp.coalesceValues(root)
+	if err != nil {
+		return nil, err
+	}
+
+	t := template.New(root.fullName).Option(string(tp.options.MissingKeyType))
+	t.Funcs(chartFuncMap(t)).Funcs(tp.lookupFuncMap())
+	err = tp.parseChartTemplates(t, root)
+	if err != nil {
+		return nil, err
+	}
+
+	us := make([]*unstructured.Unstructured, 0)
+	sources := make(Sources)
+	err = tp.renderChart(t, root, release, capabilities, &us, sources)
+	if err != nil {
+		return nil, err
+	}
+	notes := ""
+	if root.notes != "" {
+		b, err := tp.executeChartTemplate(t, root.notes, chartData(root, root.notes, release, capabilities))
+		if err != nil {
+			return nil, err
+		}
+		notes = string(b)
+	}
+
+	//The resources without namespace get the namespace of the release
+	ctp := tp
+	if tp.options.Namespace == "" {
+		o := *tp.options
+		o.Namespace = release.Namespace
+		ctp = &TemplateProcessor{reader: tp.reader, options: &o}
+	}
+	err = ctp.postRender(us, sources)
+	if err != nil {
+		return nil, err
+	}
+	tp.sortUnstructuredForApply(us)
+	return &RenderedChart{
+		Metadata:  root.metadata,
+		Resources: us,
+		Notes:     notes,
+	}, nil
+}
+
+func cleanChartPath(p string) string {
+	p = path.Clean(p)
+	if p == "." || p == "/" {
+		return ""
+	}
+	return p
+}
+
+//chartAsset returns the path of a file of a chart
+func chartAsset(chartPath, name string) string {
+	if chartPath == "" {
+		return name
+	}
+	return chartPath + "/" + name
+}
+
+//loadChart reads a chart and its subcharts, names are all the assets of the reader
+func (tp *TemplateProcessor) loadChart(chartPath, parentName string, names []string) (*chart, error) {
+	b, err := tp.reader.Asset(chartAsset(chartPath, ChartFileName))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the %s of the chart %s: %s", ChartFileName, chartPath, err)
+	}
+	metadata := &ChartMetadata{}
+	err = yaml.Unmarshal(b, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %s", chartAsset(chartPath, ChartFileName), err)
+	}
+	if metadata.Name == "" {
+		return nil, fmt.Errorf("The name is missing in %s", chartAsset(chartPath, ChartFileName))
+	}
+	c := &chart{
+		path:     chartPath,
+		fullName: metadata.Name,
+		metadata: metadata,
+		values:   make(map[string]interface{}),
+		files:    make(Files),
+	}
+	if parentName != "" {
+		c.fullName = parentName + "/charts/" + path.Base(chartPath)
+	}
+	if b, err := tp.reader.Asset(chartAsset(chartPath, ChartValuesFileName)); err == nil {
+		err = yaml.Unmarshal(b, &c.values)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", chartAsset(chartPath, ChartValuesFileName), err)
+		}
+		if c.values == nil {
+			c.values = make(map[string]interface{})
+		}
+	}
+	prefix := chartAsset(chartPath, "")
+	subcharts := make(map[string]bool)
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rel := strings.TrimPrefix(name, prefix)
+		switch {
+		case strings.HasPrefix(rel, "charts/"):
+			parts := strings.SplitN(strings.TrimPrefix(rel, "charts/"), "/", 2)
+			if len(parts) == 1 {
+				if strings.HasSuffix(parts[0], ".tgz") {
+					return nil, fmt.Errorf("The packaged subchart %s is not supported, it must be unpacked", name)
+				}
+				continue
+			}
+			subcharts[parts[0]] = true
+		case rel == ChartFileName || rel == ChartValuesFileName:
+		case rel == "templates/"+ChartNotesFileName:
+			c.notes = name
+		case strings.HasPrefix(rel, "templates/"):
+			c.templates = append(c.templates, name)
+		default:
+			b, err := tp.reader.Asset(name)
+			if err != nil {
+				return nil, err
+			}
+			c.files[rel] = b
+		}
+	}
+	subchartNames := make([]string, 0, len(subcharts))
+	for name := range subcharts {
+		subchartNames = append(subchartNames, name)
+	}
+	sort.Strings(subchartNames)
+	for _, name := range subchartNames {
+		sub, err := tp.loadChart(chartAsset(chartPath, "charts/"+name), c.fullName, names)
+		if err != nil {
+			return nil, err
+		}
+		c.subcharts = append(c.subcharts, sub)
+	}
+	return c, nil
+}
+
+//valuesKey returns the key of the values of a subchart in the values of its parent
+func (c *chart) valuesKey(sub *chart) string {
+	for _, d := range c.metadata.Dependencies {
+		if d.Name == sub.metadata.Name && d.Alias != "" {
+			return d.Alias
+		}
+	}
+	return sub.metadata.Name
+}
+
+//enabled returns false if the condition of the subchart is false in the values of the parent
+func (c *chart) enabled(sub *chart) bool {
+	for _, d := range c.metadata.Dependencies {
+		if d.Name != sub.metadata.Name || d.Condition == "" {
+			continue
+		}
+		for _, condition := range strings.Split(d.Condition, ",") {
+			var value interface{} = c.values
+			for _, key := range strings.Split(strings.TrimSpace(condition), ".") {
+				m, _ := value.(map[string]interface{})
+				value = m[key]
+			}
+			if b, ok := value.(bool); ok {
+				return b
+			}
+		}
+	}
+	return true
+}
+
+//coalesceValues validates the values of the chart and computes the values of the enabled subcharts:
+//the values.yaml of the subchart overridden by the values of the parent at the key of the subchart,
+//the global values of the parent are passed to the subcharts.
+func (tp *TemplateProcessor) coalesceValues(c *chart) error {
+	if b, err := tp.reader.Asset(chartAsset(c.path, ValuesSchemaFileName)); err == nil {
+		v, err := tp.applyValuesSchema(b, chartAsset(c.path, ValuesSchemaFileName), c.values)
+		if err != nil {
+			return err
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			c.values = m
+		}
+	}
+	enabled := make([]*chart, 0, len(c.subcharts))
+	for _, sub := range c.subcharts {
+		if !c.enabled(sub) {
+			klog.V(2).Infof("Subchart %s disabled", sub.fullName)
+			continue
+		}
+		key := c.valuesKey(sub)
+		parentValues, _ := c.values[key].(map[string]interface{})
+		sub.values = libvalues.Merge(libvalues.Merge(nil, sub.values), parentValues)
+		if global, ok := c.values["global"].(map[string]interface{}); ok {
+			subGlobal, _ := sub.values["global"].(map[string]interface{})
+			sub.values["global"] = libvalues.Merge(libvalues.Merge(nil, subGlobal), global)
+		}
+		err := tp.coalesceValues(sub)
+		if err != nil {
+			return err
+		}
+		c.values[key] = sub.values
+		enabled = append(enabled, sub)
+	}
+	c.subcharts = enabled
+	return nil
+}
+
+//parseChartTemplates parses the templates and partials of the chart and its subcharts in t
+func (tp *TemplateProcessor) parseChartTemplates(t *template.Template, c *chart) error {
+	templates := c.templates
+	if c.notes != "" {
+		templates = append(append([]string{}, templates...), c.notes)
+	}
+	for _, name := range templates {
+		b, err := tp.reader.Asset(name)
+		if err != nil {
+			return err
+		}
+		_, err = t.New(name).Parse(string(b))
+		if err != nil {
+			return tp.newTemplateError(name, err)
+		}
+	}
+	for _, sub := range c.subcharts {
+		err := tp.parseChartTemplates(t, sub)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//renderChart renders the templates of the chart and its subcharts, the partials are not rendered
+func (tp *TemplateProcessor) renderChart(
+	t *template.Template,
+	c *chart,
+	release Release,
+	capabilities *Capabilities,
+	us *[]*unstructured.Unstructured,
+	sources Sources,
+) error {
+	for _, name := range c.templates {
+		if strings.HasPrefix(path.Base(name), "_") {
+			continue
+		}
+		b, err := tp.executeChartTemplate(t, name, chartData(c, name, release, capabilities))
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		items, err := tp.decodeRendered(name, b)
+		if err != nil {
+			return err
+		}
+		for _, u := range items {
+			sources[u] = name
+		}
+		*us = append(*us, items...)
+	}
+	for _, sub := range c.subcharts {
+		err := tp.renderChart(t, sub, release, capabilities, us, sources)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//chartData returns the objects passed to a template of the chart
+func chartData(c *chart, name string, release Release, capabilities *Capabilities) map[string]interface{} {
+	templateName := c.fullName + "/" + strings.TrimPrefix(name, chartAsset(c.path, ""))
+	return map[string]interface{}{
+		"Values":       c.values,
+		"Release":      release,
+		"Chart":        c.metadata,
+		"Capabilities": capabilities,
+		"Files":        c.files,
+		"Template": map[string]interface{}{
+			"Name":     templateName,
+			"BasePath": c.fullName + "/templates",
+		},
+	}
+}
+
+func (tp *TemplateProcessor) executeChartTemplate(t *template.Template, name string, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := t.ExecuteTemplate(&buf, name, data)
+	if err != nil {
+		return nil, tp.newTemplateError(name, err)
+	}
+	//As Helm, the missing values are rendered as empty strings
+	return bytes.ReplaceAll(buf.Bytes(), []byte("<no value>"), []byte("")), nil
+}
+
+//chartFuncMap returns the functions of the charts: sprig, include, tpl, required, toYaml, fromYaml, toJson and fromJson
+func chartFuncMap(t *template.Template) template.FuncMap {
+	funcMap := sprig.TxtFuncMap()
+	for k, v := range ApplierFuncMap() {
+		funcMap[k] = v
+	}
+	for k, v := range TemplateFuncMap(t) {
+		funcMap[k] = v
+	}
+	funcMap["toYaml"] = func(v interface{}) string {
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSuffix(string(b), "\n")
+	}
+	funcMap["fromYaml"] = func(s string) map[string]interface{} {
+		m := make(map[string]interface{})
+		if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+			m["Error"] = err.Error()
+		}
+		return m
+	}
+	funcMap["required"] = func(message string, v interface{}) (interface{}, error) {
+		if v == nil {
+			return nil, errors.New(message)
+		}
+		if s, ok := v.(string); ok && s == "" {
+			return nil, errors.New(message)
+		}
+		return v, nil
+	}
+	funcMap["tpl"] = func(s string, data interface{}) (string, error) {
+		clone, err := t.Clone()
+		if err != nil {
+			return "", err
+		}
+		tmpl, err := clone.New("tpl").Parse(s)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, data)
+		if err != nil {
+			return "", err
+		}
+		return strings.ReplaceAll(buf.String(), "<no value>", ""), nil
+	}
+	return funcMap
+}
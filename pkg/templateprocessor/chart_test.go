@@ -0,0 +1,225 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var chartAssets = map[string]string{
+	"chart/Chart.yaml": `
+apiVersion: v2
+name: app
+version: 0.1.0
+appVersion: "1.0"
+dependencies:
+- name: cache
+  condition: cache.enabled
+- name: db
+  alias: database
+  condition: database.enabled`,
+	"chart/values.yaml": `
+image:
+  repository: quay.io/app
+replicas: 1
+global:
+  team: blue
+cache:
+  enabled: false
+database:
+  enabled: true
+  size: 1Gi`,
+	"chart/values.schema.json":    `{"type": "object", "properties": {"replicas": {"type": "integer"}}}`,
+	"chart/config/app.properties": "log.level=info\n",
+	"chart/templates/_helpers.tpl": `
+{{- define "app.fullname" -}}
+{{ .Release.Name }}-{{ .Chart.Name }}
+{{- end -}}`,
+	"chart/templates/_labels.tpl": `
+{{- define "app.labels" -}}
+app.kubernetes.io/name: {{ .Chart.Name }}
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+{{- end -}}`,
+	"chart/templates/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "app.fullname" . }}
+  labels:
+{{ include "app.labels" . | indent 4 }}
+data:
+  image: {{ .Values.image.repository }}:{{ .Values.image.tag | default .Chart.AppVersion }}
+  replicas: "{{ .Values.replicas }}"
+  missing: "{{ .Values.missing }}"
+  template: {{ .Template.Name }}
+  greeting: {{ tpl "hello {{ .Release.Name }}" . }}
+  deployment: "{{ .Capabilities.APIVersions.Has "apps/v1/Deployment" }}"
+{{ (.Files.Glob "config/*").AsConfig | indent 2 }}`,
+	"chart/templates/NOTES.txt": `{{ .Chart.Name }} installed as {{ .Release.Name }} in {{ .Release.Namespace }}`,
+	"chart/charts/db/Chart.yaml": `
+name: db
+version: 0.2.0`,
+	"chart/charts/db/values.yaml": `
+size: 500Mi
+storageClass: standard`,
+	"chart/charts/db/templates/pvc.yaml": `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: {{ include "app.fullname" . }}-data
+  labels:
+    team: {{ .Values.global.team }}
+spec:
+  storageClassName: {{ .Values.storageClass }}
+  resources:
+    requests:
+      storage: {{ .Values.size }}`,
+	"chart/charts/cache/Chart.yaml": `
+name: cache`,
+	"chart/charts/cache/templates/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cache`,
+}
+
+func TestTemplateProcessor_TemplateChart(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(chartAssets), nil)
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	rendered, err := tp.TemplateChart("chart", &ChartOptions{
+		Release: Release{Name: "r1", Namespace: "apps"},
+		Values: map[string]interface{}{
+			"replicas": 2,
+			"database": map[string]interface{}{"storageClass": "fast"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to render the chart %s", err.Error())
+	}
+	if rendered.Metadata.Name != "app" || rendered.Metadata.Version != "0.1.0" {
+		t.Errorf("Unexpected metadata %v", rendered.Metadata)
+	}
+	if rendered.Notes != "app installed as r1 in apps" {
+		t.Errorf("Unexpected notes %s", rendered.Notes)
+	}
+	if len(rendered.Resources) != 2 {
+		t.Fatalf("Expected 2 resources, got %d", len(rendered.Resources))
+	}
+	cm := rendered.Resources[0]
+	pvc := rendered.Resources[1]
+	if cm.GetKind() != "ConfigMap" || pvc.GetKind() != "PersistentVolumeClaim" {
+		t.Fatalf("Unexpected resources order %s %s", cm.GetKind(), pvc.GetKind())
+	}
+	if pvc.GetName() != "r1-db-data" || pvc.GetNamespace() != "apps" {
+		t.Errorf("Unexpected pvc %s/%s", pvc.GetNamespace(), pvc.GetName())
+	}
+	wantSpec := map[string]interface{}{
+		"storageClassName": "fast",
+		"resources": map[string]interface{}{
+			"requests": map[string]interface{}{"storage": "1Gi"},
+		},
+	}
+	if !reflect.DeepEqual(pvc.Object["spec"], wantSpec) {
+		t.Errorf("Expected spec %v, got %v", wantSpec, pvc.Object["spec"])
+	}
+	if pvc.GetLabels()["team"] != "blue" {
+		t.Errorf("Expected the global values in the subchart, got %v", pvc.GetLabels())
+	}
+	if cm.GetName() != "r1-app" || cm.GetNamespace() != "apps" {
+		t.Errorf("Unexpected configmap %s/%s", cm.GetNamespace(), cm.GetName())
+	}
+	wantLabels := map[string]string{
+		"app.kubernetes.io/name":       "app",
+		"app.kubernetes.io/managed-by": "Helm",
+	}
+	if !reflect.DeepEqual(cm.GetLabels(), wantLabels) {
+		t.Errorf("Expected labels %v, got %v", wantLabels, cm.GetLabels())
+	}
+	wantData := map[string]interface{}{
+		"image":          "quay.io/app:1.0",
+		"replicas":       "2",
+		"missing":        "",
+		"template":       "app/templates/configmap.yaml",
+		"greeting":       "hello r1",
+		"deployment":     "true",
+		"app.properties": "log.level=info",
+	}
+	if !reflect.DeepEqual(cm.Object["data"], wantData) {
+		t.Errorf("Expected data %v, got %v", wantData, cm.Object["data"])
+	}
+}
+
+func TestTemplateProcessor_TemplateChart_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		assets  map[string]string
+		path    string
+		options *ChartOptions
+		wantErr string
+	}{
+		{
+			name:    "missing chart",
+			assets:  chartAssets,
+			wantErr: "Unable to read the Chart.yaml",
+		},
+		{
+			name:    "invalid values",
+			assets:  chartAssets,
+			path:    "chart",
+			options: &ChartOptions{Values: map[string]interface{}{"replicas": "two"}},
+			wantErr: "$.replicas",
+		},
+		{
+			name: "required value",
+			assets: map[string]string{
+				"Chart.yaml":        "name: required",
+				"templates/cm.yaml": `{{ required "name is required" .Values.name }}`,
+			},
+			wantErr: "name is required",
+		},
+		{
+			name: "packaged subchart",
+			assets: map[string]string{
+				"Chart.yaml":        "name: packaged",
+				"charts/db-1.0.tgz": "",
+			},
+			wantErr: "must be unpacked",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(tt.assets), nil)
+			if err != nil {
+				t.Fatalf("Unable to create the template processor %s", err.Error())
+			}
+			_, err = tp.TemplateChart(tt.path, tt.options)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %s, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFiles(t *testing.T) {
+	f := Files{
+		"config/a.txt": []byte("a\nb\n"),
+		"config/b.txt": []byte("c"),
+		"other.txt":    []byte("d"),
+	}
+	if got := f.Lines("config/a.txt"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Unexpected lines %v", got)
+	}
+	if got := f.Glob("config/*"); len(got) != 2 {
+		t.Errorf("Expected 2 files, got %v", got)
+	}
+	if got := f.Glob("config/b.txt").AsSecrets(); got != "b.txt: Yw==" {
+		t.Errorf("Unexpected secrets %s", got)
+	}
+	if got := f.Get("missing"); got != "" {
+		t.Errorf("Expected an empty content, got %s", got)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"path/filepath"
+	"sync"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+//VersionedReader is a TemplateReader which reports when its assets change
+type VersionedReader interface {
+	TemplateReader
+	//AssetsVersion returns a version which changes each time the assets change
+	AssetsVersion() (string, error)
+}
+
+//CompiledBundle holds the templates of a path and their partials parsed once,
+//they are rendered many times with different values.
+//Rendering never reads the assets, the templates are parsed again only by Invalidate or by Refresh,
+//called by the caller or every interval by RefreshEvery, when the reader is a VersionedReader reporting a new version.
+//A CompiledBundle can be rendered concurrently.
+type CompiledBundle struct {
+	tp        *TemplateProcessor
+	path      string
+	excluded  []string
+	recursive bool
+	dir       string
+	mutex     sync.RWMutex
+	compiled  *compiledTemplates
+}
+
+//compiledTemplates is a version of the parsed templates
+type compiledTemplates struct {
+	version       string
+	templateNames []string
+	templates     map[string]*template.Template
+}
+
+//CompileInPath parses all templates in a path once, the returned CompiledBundle renders them
+//as TemplateResourcesInPathUnstructured does.
+func (tp *TemplateProcessor) CompileInPath(
+	path string,
+	excluded []string,
+	recursive bool,
+) (*CompiledBundle, error) {
+	b := &CompiledBundle{
+		tp:        tp,
+		path:      path,
+		excluded:  excluded,
+		recursive: recursive,
+		dir:       path,
+	}
+	if _, err := tp.reader.Asset(path); err == nil {
+		b.dir = filepath.Dir(path)
+	}
+	version, err := b.version()
+	if err != nil {
+		return nil, err
+	}
+	b.compiled, err = b.compile(version)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+//TemplateNames returns the names of the compiled templates
+func (b *CompiledBundle) TemplateNames() ([]string, error) {
+	compiled, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	return compiled.templateNames, nil
+}
+
+//Refresh parses the templates again if the reader reports a new version of the assets,
+//it returns true if the templates were parsed again.
+func (b *CompiledBundle) Refresh() (bool, error) {
+	version, err := b.version()
+	if err != nil {
+		return false, err
+	}
+	if version == "" {
+		return false, nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.compiled.version == version {
+		return false, nil
+	}
+	klog.V(2).Infof("assets of %s changed, compiling again", b.path)
+	compiled, err := b.compile(version)
+	if err != nil {
+		return false, err
+	}
+	b.compiled = compiled
+	return true, nil
+}
+
+//RefreshEvery calls Refresh every interval until stop is closed, the errors are logged
+func (b *CompiledBundle) RefreshEvery(interval time.Duration, stop <-chan struct{}) {
+	go wait.Until(func() {
+		if _, err := b.Refresh(); err != nil {
+			klog.Errorf("Unable to refresh the templates of %s: %s", b.path, err)
+		}
+	}, interval, stop)
+}
+
+//Invalidate parses all templates again, whatever the reader reports
+func (b *CompiledBundle) Invalidate() error {
+	version, err := b.version()
+	if err != nil {
+		return err
+	}
+	compiled, err := b.compile(version)
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.compiled = compiled
+	return nil
+}
+
+//TemplateResources renders the compiled templates with the provided values,
+//the results are identical to the TemplateProcessor.TemplateResources ones.
+func (b *CompiledBundle) TemplateResources(values interface{}) ([][]byte, error) {
+	compiled, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	values, err = b.tp.prepareValues(b.dir, values)
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]byte, 0)
+	for _, templateName := range compiled.templateNames {
+		result, err := b.render(compiled, templateName, values)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+//TemplateResourcesUnstructured renders the compiled templates with the provided values,
+//the results are identical to the TemplateProcessor.TemplateResourcesInPathUnstructured ones.
+func (b *CompiledBundle) TemplateResourcesUnstructured(values interface{}) ([]*unstructured.Unstructured, error) {
+	compiled, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	values, err = b.tp.prepareValues(b.dir, values)
+	if err != nil {
+		return nil, err
+	}
+	return b.tp.renderUnstructured(compiled.templateNames, func(templateName string) ([]byte, error) {
+		return b.render(compiled, templateName, values)
+	})
+}
+
+//current returns the templates parsed last
+func (b *CompiledBundle) current() (*compiledTemplates, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.compiled, nil
+}
+
+//render executes a compiled template, nil is returned for the files which are not templates
+func (b *CompiledBundle) render(compiled *compiledTemplates, templateName string, values interface{}) ([]byte, error) {
+	tmpl, ok := compiled.templates[templateName]
+	if !ok {
+		return nil, nil
+	}
+	templated, err := executeTemplate(tmpl, values)
+	if err != nil {
+		return nil, b.tp.newTemplateError(templateName, err)
+	}
+	return templated, nil
+}
+
+//version returns the version of the assets, empty if the reader does not report it
+func (b *CompiledBundle) version() (string, error) {
+	reader, ok := b.tp.reader.(VersionedReader)
+	if !ok {
+		return "", nil
+	}
+	return reader.AssetsVersion()
+}
+
+//compile parses all templates of the path
+func (b *CompiledBundle) compile(version string) (*compiledTemplates, error) {
+	templateNames, err := b.tp.AssetNamesInPath(b.path, b.excluded, b.recursive)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(5).Infof("templateNames: %v", templateNames)
+	compiled := &compiledTemplates{
+		version:       version,
+		templateNames: templateNames,
+		templates:     make(map[string]*template.Template),
+	}
+	p, err := b.tp.newPartials()
+	if err != nil {
+		return nil, err
+	}
+	for _, templateName := range templateNames {
+		tmpl, err := b.tp.parseTemplate(p, templateName)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl != nil {
+			compiled.templates[templateName] = tmpl
+		}
+	}
+	return compiled, nil
+}
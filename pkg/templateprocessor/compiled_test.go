@@ -0,0 +1,197 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var compiledAssets = map[string]string{
+	"compiled/_helpers.tpl": `{{- define "labels" -}}
+app: {{ .name }}
+{{- end -}}
+`,
+	"compiled/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name }}
+  labels:
+{{ include "labels" . | indent 4 }}
+data:
+  size: "{{ .size | default 1 }}"`,
+	"compiled/sa.yaml": `{{ if .serviceAccount }}
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{ .name }}
+  namespace: default
+{{ end }}`,
+	"compiled/fail.yaml": `{{ if .fail }}{{ fail "failed" }}{{ end }}`,
+}
+
+//versionedTestReader is a MapReader reporting the version set by the test
+type versionedTestReader struct {
+	*MapReader
+	version string
+}
+
+func (r *versionedTestReader) AssetsVersion() (string, error) {
+	return r.version, nil
+}
+
+func TestCompiledBundle_Identical(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(compiledAssets), nil)
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	b, err := tp.CompileInPath("compiled", nil, false)
+	if err != nil {
+		t.Fatalf("Unable to compile %s", err.Error())
+	}
+	templateNames, err := b.TemplateNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+	}{
+		{name: "defaults", values: map[string]interface{}{"name": "first"}},
+		{name: "all values", values: map[string]interface{}{"name": "second", "size": 3, "serviceAccount": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := tp.TemplateResourcesInPathUnstructured("compiled", nil, false, tt.values)
+			if err != nil {
+				t.Fatalf("Unable to render %s", err.Error())
+			}
+			got, err := b.TemplateResourcesUnstructured(tt.values)
+			if err != nil {
+				t.Fatalf("Unable to render the compiled templates %s", err.Error())
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected\n%v\ngot\n%v", want, got)
+			}
+			wantBytes, err := tp.TemplateResources(templateNames, tt.values)
+			if err != nil {
+				t.Fatalf("Unable to render %s", err.Error())
+			}
+			gotBytes, err := b.TemplateResources(tt.values)
+			if err != nil {
+				t.Fatalf("Unable to render the compiled templates %s", err.Error())
+			}
+			if !reflect.DeepEqual(gotBytes, wantBytes) {
+				t.Errorf("Expected\n%s\ngot\n%s", wantBytes, gotBytes)
+			}
+		})
+	}
+	_, wantErr := tp.TemplateResourcesInPathUnstructured("compiled", nil, false, map[string]interface{}{"fail": true})
+	_, err = b.TemplateResourcesUnstructured(map[string]interface{}{"fail": true})
+	if !IsRenderError(err) || err.Error() != wantErr.Error() {
+		t.Errorf("Expected the error %v, got %v", wantErr, err)
+	}
+}
+
+func TestCompiledBundle_Refresh(t *testing.T) {
+	assets := map[string]string{
+		"refresh/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name }}`,
+	}
+	reader := &versionedTestReader{MapReader: NewTestReader(assets), version: "1"}
+	tp, err := NewTemplateProcessor(reader, nil)
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	b, err := tp.CompileInPath("refresh", nil, false)
+	if err != nil {
+		t.Fatalf("Unable to compile %s", err.Error())
+	}
+	render := func() string {
+		us, err := b.TemplateResourcesUnstructured(map[string]interface{}{"name": "cm"})
+		if err != nil {
+			t.Fatalf("Unable to render the compiled templates %s", err.Error())
+		}
+		if len(us) != 1 {
+			t.Fatalf("Expected 1 resource, got %d", len(us))
+		}
+		return us[0].GetName()
+	}
+	if name := render(); name != "cm" {
+		t.Errorf("Expected cm, got %s", name)
+	}
+	assets["refresh/cm.yaml"] = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name }}-changed`
+	if name := render(); name != "cm" {
+		t.Errorf("Expected the templates parsed once, got %s", name)
+	}
+	refreshed, err := b.Refresh()
+	if err != nil || refreshed {
+		t.Errorf("Expected no refresh for the same version, got %v %v", refreshed, err)
+	}
+	reader.version = "2"
+	if name := render(); name != "cm" {
+		t.Errorf("Expected the templates parsed again only on refresh, got %s", name)
+	}
+	refreshed, err = b.Refresh()
+	if err != nil || !refreshed {
+		t.Errorf("Expected a refresh for the new version, got %v %v", refreshed, err)
+	}
+	if name := render(); name != "cm-changed" {
+		t.Errorf("Expected the templates parsed again for the new version, got %s", name)
+	}
+	assets["refresh/cm.yaml"] = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name }}-invalidated`
+	err = b.Invalidate()
+	if err != nil {
+		t.Fatalf("Unable to invalidate %s", err.Error())
+	}
+	if name := render(); name != "cm-invalidated" {
+		t.Errorf("Expected the templates parsed again on invalidate, got %s", name)
+	}
+}
+
+func TestCompiledBundle_RefreshEvery(t *testing.T) {
+	assets := map[string]string{
+		"refresh/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm`,
+	}
+	reader := &versionedTestReader{MapReader: NewTestReader(assets), version: "1"}
+	tp, err := NewTemplateProcessor(reader, nil)
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	b, err := tp.CompileInPath("refresh", nil, false)
+	if err != nil {
+		t.Fatalf("Unable to compile %s", err.Error())
+	}
+	assets["refresh/cm.yaml"] = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm-changed`
+	reader.version = "2"
+	stop := make(chan struct{})
+	defer close(stop)
+	b.RefreshEvery(time.Millisecond, stop)
+	err = wait.PollImmediate(time.Millisecond, 5*time.Second, func() (bool, error) {
+		us, err := b.TemplateResourcesUnstructured(nil)
+		if err != nil {
+			return false, err
+		}
+		return len(us) == 1 && us[0].GetName() == "cm-changed", nil
+	})
+	if err != nil {
+		t.Errorf("Expected the templates refreshed, got %v", err)
+	}
+}
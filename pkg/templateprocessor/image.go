@@ -0,0 +1,225 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog"
+)
+
+//ImageRewriteConfig defines how the container images of the rendered resources are rewritten
+type ImageRewriteConfig struct {
+	//Mirrors the registry mirror rules, the longest matching source is used
+	Mirrors []ImageMirror `json:"mirrors,omitempty"`
+	//Digests maps an image reference as rendered (ie: quay.io/stolostron/foo:2.5.0)
+	//to its digest (ie: sha256:...), the tag is replaced by the digest.
+	Digests map[string]string `json:"digests,omitempty"`
+	//Paths the additional image paths for custom resources
+	Paths []ImagePaths `json:"paths,omitempty"`
+}
+
+//ImageMirror defines a registry mirror rule
+type ImageMirror struct {
+	//Source the registry or repository to replace, ie: quay.io/stolostron
+	Source string `json:"source"`
+	//Mirror the replacement, ie: registry.local:5000/stolostron
+	Mirror string `json:"mirror"`
+}
+
+//ImagePaths defines the paths of the images in a custom resource
+type ImagePaths struct {
+	//APIVersion of the custom resource, all versions if empty
+	APIVersion string `json:"apiVersion,omitempty"`
+	//Kind of the custom resource
+	Kind string `json:"kind"`
+	//Paths dot-separated paths to the image fields, ie: spec.registrationImagePullSpec.
+	//If a path goes through a list, the rest of the path is applied on each element.
+	Paths []string `json:"paths"`
+}
+
+//ImageRewrite reports an image rewrite
+type ImageRewrite struct {
+	Kind      string
+	Namespace string
+	Name      string
+	//Path the dot-separated path of the image field
+	Path string
+	From string
+	To   string
+}
+
+func (r ImageRewrite) String() string {
+	return fmt.Sprintf("%s %s/%s %s: %s -> %s", r.Kind, r.Namespace, r.Name, r.Path, r.From, r.To)
+}
+
+//podSpecImagePaths the image paths in a pod spec
+var podSpecImagePaths = [][]string{
+	{"containers", "image"},
+	{"initContainers", "image"},
+	{"ephemeralContainers", "image"},
+}
+
+//LoadImageRewriteConfig reads an ImageRewriteConfig from a yaml or json file
+func LoadImageRewriteConfig(path string) (*ImageRewriteConfig, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	config := &ImageRewriteConfig{}
+	err = yaml.Unmarshal(b, config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+//LoadImageDigests reads an image manifest file, a yaml or json map of image references to digests
+func LoadImageDigests(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[string]string)
+	err = yaml.Unmarshal(b, &digests)
+	if err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+//RewriteImage returns the rewritten image reference,
+//the tag is first replaced by the digest if any and then the mirror rule is applied.
+func (c *ImageRewriteConfig) RewriteImage(image string) string {
+	result := image
+	if digest, ok := c.Digests[image]; ok {
+		result = imageRepository(image) + "@" + digest
+	}
+	mirror := ImageMirror{}
+	for _, m := range c.Mirrors {
+		if len(m.Source) > len(mirror.Source) && imageMatchesSource(result, m.Source) {
+			mirror = m
+		}
+	}
+	if mirror.Source != "" {
+		result = mirror.Mirror + strings.TrimPrefix(result, mirror.Source)
+	}
+	return result
+}
+
+//imageRepository returns the image reference without its tag and digest
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	//A colon after the last slash is a tag, otherwise it is a registry port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+//imageMatchesSource returns true if the image is the source or in the source registry or repository
+func imageMatchesSource(image, source string) bool {
+	if !strings.HasPrefix(image, source) {
+		return false
+	}
+	rest := strings.TrimPrefix(image, source)
+	return rest == "" ||
+		strings.HasPrefix(rest, "/") ||
+		strings.HasPrefix(rest, ":") ||
+		strings.HasPrefix(rest, "@")
+}
+
+//imagePaths returns the image paths of a resource
+func (c *ImageRewriteConfig) imagePaths(u *unstructured.Unstructured) [][]string {
+	paths := make([][]string, 0)
+	var podSpecPath []string
+	if u.GetKind() == "Pod" {
+		podSpecPath = []string{"spec"}
+	} else if templatePath, ok := podTemplatePaths[u.GetKind()]; ok {
+		podSpecPath = append(append([]string{}, templatePath...), "spec")
+	}
+	if podSpecPath != nil {
+		for _, p := range podSpecImagePaths {
+			paths = append(paths, append(append([]string{}, podSpecPath...), p...))
+		}
+	}
+	for _, p := range c.Paths {
+		if p.Kind != u.GetKind() ||
+			(p.APIVersion != "" && p.APIVersion != u.GetAPIVersion()) {
+			continue
+		}
+		for _, path := range p.Paths {
+			paths = append(paths, strings.Split(path, "."))
+		}
+	}
+	return paths
+}
+
+//rewriteImages rewrites the images of the resources following the options.ImageRewrite
+func (tp *TemplateProcessor) rewriteImages(us []*unstructured.Unstructured) {
+	c := tp.options.ImageRewrite
+	if c == nil {
+		return
+	}
+	for _, u := range us {
+		for _, path := range c.imagePaths(u) {
+			rewriteAtPath(u.Object, path, 0, func(field []string, image string) string {
+				rewritten := c.RewriteImage(image)
+				if rewritten != image {
+					rewrite := ImageRewrite{
+						Kind:      u.GetKind(),
+						Namespace: u.GetNamespace(),
+						Name:      u.GetName(),
+						Path:      strings.Join(field, "."),
+						From:      image,
+						To:        rewritten,
+					}
+					klog.V(2).Infof("Image rewritten: %s", rewrite)
+					if tp.options.OnImageRewrite != nil {
+						tp.options.OnImageRewrite(rewrite)
+					}
+				}
+				return rewritten
+			})
+		}
+	}
+}
+
+//rewriteAtPath calls the rewrite function on the string fields found at the path,
+//if a list is found the rest of the path is applied on each element.
+func rewriteAtPath(o interface{}, path []string, depth int, rewrite func(field []string, s string) string) {
+	switch v := o.(type) {
+	case []interface{}:
+		for i, e := range v {
+			field := append(append([]string{}, path[:depth]...), fmt.Sprintf("%d", i))
+			field = append(field, path[depth:]...)
+			if s, ok := e.(string); ok && depth == len(path) {
+				v[i] = rewrite(field[:depth+1], s)
+				continue
+			}
+			rewriteAtPath(e, field, depth+1, rewrite)
+		}
+	case map[string]interface{}:
+		if depth >= len(path) {
+			return
+		}
+		child, ok := v[path[depth]]
+		if !ok {
+			return
+		}
+		if s, ok := child.(string); ok {
+			if depth == len(path)-1 {
+				v[path[depth]] = rewrite(path, s)
+			}
+			return
+		}
+		rewriteAtPath(child, path, depth+1, rewrite)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var imageAssets = map[string]string{
+	"image/deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  namespace: myns
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: quay.io/stolostron/init:1.0
+      containers:
+      - name: first
+        image: quay.io/stolostron/registration:2.5.0
+      - name: second
+        image: docker.io/library/busybox`,
+	"image/cronjob": `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: mycronjob
+  namespace: myns
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+            image: quay.io/stolostron-other/job:1.0`,
+	"image/cr": `
+apiVersion: operator.open-cluster-management.io/v1
+kind: ClusterManager
+metadata:
+  name: cluster-manager
+spec:
+  registrationImagePullSpec: quay.io/stolostron/registration:2.5.0
+  images:
+  - quay.io/stolostron/work:2.5.0`,
+}
+
+func TestImageRewriteConfig_RewriteImage(t *testing.T) {
+	c := &ImageRewriteConfig{
+		Mirrors: []ImageMirror{
+			{Source: "quay.io", Mirror: "registry.local:5000/quay"},
+			{Source: "quay.io/stolostron", Mirror: "registry.local:5000/acm"},
+			{Source: "localhost:5000/a", Mirror: "registry.local:5000/b"},
+		},
+		Digests: map[string]string{
+			"quay.io/stolostron/registration:2.5.0": "sha256:1234",
+			"localhost:5000/a:1.0":                  "sha256:5678",
+		},
+	}
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"quay.io/stolostron/registration:2.5.0", "registry.local:5000/acm/registration@sha256:1234"},
+		{"quay.io/stolostron/work:2.5.0", "registry.local:5000/acm/work:2.5.0"},
+		{"quay.io/stolostron-other/work:2.5.0", "registry.local:5000/quay/stolostron-other/work:2.5.0"},
+		{"localhost:5000/a:1.0", "registry.local:5000/b@sha256:5678"},
+		{"docker.io/library/busybox", "docker.io/library/busybox"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := c.RewriteImage(tt.image); got != tt.want {
+				t.Errorf("RewriteImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_PostRender_ImageRewrite(t *testing.T) {
+	rewrites := make([]string, 0)
+	tp, err := NewTemplateProcessor(NewTestReader(imageAssets), &Options{
+		ImageRewrite: &ImageRewriteConfig{
+			Mirrors: []ImageMirror{
+				{Source: "quay.io/stolostron", Mirror: "registry.local/acm"},
+			},
+			Paths: []ImagePaths{
+				{
+					Kind:  "ClusterManager",
+					Paths: []string{"spec.registrationImagePullSpec", "spec.images"},
+				},
+			},
+		},
+		OnImageRewrite: func(rewrite ImageRewrite) {
+			rewrites = append(rewrites, rewrite.Name+" "+rewrite.Path)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create templateProcessor %s", err.Error())
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured("image", nil, false, nil)
+	if err != nil {
+		t.Fatalf("Unable to render %s", err.Error())
+	}
+	for _, u := range us {
+		switch u.GetKind() {
+		case "Deployment":
+			containers, _, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "containers")
+			if containers[0].(map[string]interface{})["image"] != "registry.local/acm/registration:2.5.0" ||
+				containers[1].(map[string]interface{})["image"] != "docker.io/library/busybox" {
+				t.Errorf("Unexpected containers images %v", containers)
+			}
+			initContainers, _, _ := unstructured.NestedSlice(u.Object, "spec", "template", "spec", "initContainers")
+			if initContainers[0].(map[string]interface{})["image"] != "registry.local/acm/init:1.0" {
+				t.Errorf("Unexpected init containers images %v", initContainers)
+			}
+		case "CronJob":
+			containers, _, _ := unstructured.NestedSlice(u.Object,
+				"spec", "jobTemplate", "spec", "template", "spec", "containers")
+			if containers[0].(map[string]interface{})["image"] != "quay.io/stolostron-other/job:1.0" {
+				t.Errorf("Unexpected cronjob images %v", containers)
+			}
+		case "ClusterManager":
+			image, _, _ := unstructured.NestedString(u.Object, "spec", "registrationImagePullSpec")
+			images, _, _ := unstructured.NestedStringSlice(u.Object, "spec", "images")
+			if image != "registry.local/acm/registration:2.5.0" ||
+				!reflect.DeepEqual(images, []string{"registry.local/acm/work:2.5.0"}) {
+				t.Errorf("Unexpected custom resource images %s %v", image, images)
+			}
+		}
+	}
+	sort.Strings(rewrites)
+	want := []string{
+		"cluster-manager spec.images.0",
+		"cluster-manager spec.registrationImagePullSpec",
+		"mydeployment spec.template.spec.containers.0.image",
+		"mydeployment spec.template.spec.initContainers.0.image",
+	}
+	if !reflect.DeepEqual(rewrites, want) {
+		t.Errorf("Unexpected rewrites %v, want %v", rewrites, want)
+	}
+}
+
+func TestLoadImageRewriteConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "config.yaml")
+	err = ioutil.WriteFile(configPath, []byte(`
+mirrors:
+- source: quay.io/stolostron
+  mirror: registry.local/acm
+paths:
+- kind: ClusterManager
+  paths:
+  - spec.registrationImagePullSpec
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digestsPath := filepath.Join(dir, "digests.yaml")
+	err = ioutil.WriteFile(digestsPath, []byte(`quay.io/stolostron/work:2.5.0: sha256:1234`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadImageRewriteConfig(configPath)
+	if err != nil {
+		t.Errorf("Unable to load the config %s", err.Error())
+	}
+	if len(c.Mirrors) != 1 || len(c.Paths) != 1 || c.Paths[0].Paths[0] != "spec.registrationImagePullSpec" {
+		t.Errorf("Unexpected config %v", c)
+	}
+	digests, err := LoadImageDigests(digestsPath)
+	if err != nil {
+		t.Errorf("Unable to load the digests %s", err.Error())
+	}
+	if digests["quay.io/stolostron/work:2.5.0"] != "sha256:1234" {
+		t.Errorf("Unexpected digests %v", digests)
+	}
+	_, err = LoadImageRewriteConfig(filepath.Join(dir, "missing.yaml"))
+	if err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
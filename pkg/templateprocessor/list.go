@@ -0,0 +1,76 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//ListKind the kind of the generic kubernetes list
+const ListKind = "List"
+
+//IsList returns true if the unstructured is a kubernetes list such as a v1/List or a SecretList
+func IsList(u *unstructured.Unstructured) bool {
+	return strings.HasSuffix(u.GetKind(), ListKind) && u.IsList()
+}
+
+//ExpandList returns the items of a kubernetes list as an []*unstructured.Unstructured.
+//The items of a typed list (ie: SecretList) which don't have an apiVersion and kind
+//inherit them from the list. Nested lists are expanded too.
+//If the unstructured is not a list, it is returned as the single element of the array.
+func ExpandList(u *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	if !IsList(u) {
+		return []*unstructured.Unstructured{u}, nil
+	}
+	items, _, err := unstructured.NestedSlice(u.Object, "items")
+	if err != nil {
+		return nil, err
+	}
+	itemKind := strings.TrimSuffix(u.GetKind(), ListKind)
+	us := make([]*unstructured.Unstructured, 0)
+	for i, item := range items {
+		o, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Item %d of %s is not an object", i, u.GetKind())
+		}
+		child := &unstructured.Unstructured{Object: o}
+		if child.GetKind() == "" {
+			if itemKind == "" {
+				return nil, fmt.Errorf("Kind is missing for item %d of %s", i, u.GetKind())
+			}
+			child.SetKind(itemKind)
+		}
+		if child.GetAPIVersion() == "" {
+			child.SetAPIVersion(u.GetAPIVersion())
+		}
+		children, err := ExpandList(child)
+		if err != nil {
+			return nil, err
+		}
+		us = append(us, children...)
+	}
+	return us, nil
+}
+
+//ToListUnstructured packs an []*unstructured.Unstructured into a single v1/List
+func ToListUnstructured(us []*unstructured.Unstructured) *unstructured.Unstructured {
+	items := make([]interface{}, len(us))
+	for i, u := range us {
+		items[i] = u.Object
+	}
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       ListKind,
+			"items":      items,
+		},
+	}
+}
+
+//ToYAMLListUnstructured converts an []*unstructured.Unstructured to a single v1/List in yaml format
+func ToYAMLListUnstructured(us []*unstructured.Unstructured) ([]byte, error) {
+	return ToYAMLUnstructured(ToListUnstructured(us))
+}
@@ -0,0 +1,159 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var listAssets = map[string]string{
+	"list/secrets": `
+apiVersion: v1
+kind: SecretList
+items:
+- metadata:
+    name: {{ .ManagedClusterName }}-b
+    namespace: {{ .ManagedClusterNamespace }}
+- metadata:
+    name: {{ .ManagedClusterName }}-a
+    namespace: {{ .ManagedClusterNamespace }}`,
+	"list/list": `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ServiceAccount
+  metadata:
+    name: {{ .BootstrapServiceAccountName }}
+    namespace: {{ .ManagedClusterNamespace }}
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: {{ .ManagedClusterNamespace }}
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleList
+  items:
+  - metadata:
+      name: {{ .ManagedClusterName }}
+      namespace: {{ .ManagedClusterNamespace }}`,
+}
+
+func TestTemplateProcessor_TemplateResourcesInPathUnstructured_List(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(listAssets), nil)
+	if err != nil {
+		t.Errorf("Unable to create templateProcessor %s", err.Error())
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured("list", nil, false, values)
+	if err != nil {
+		t.Errorf("Unable to render %s", err.Error())
+	}
+	want := []struct {
+		apiVersion string
+		kind       string
+		name       string
+	}{
+		{"v1", "Namespace", "myclusterns"},
+		{"v1", "ServiceAccount", "mysa"},
+		{"v1", "Secret", "mycluster-a"},
+		{"v1", "Secret", "mycluster-b"},
+		{"rbac.authorization.k8s.io/v1", "Role", "mycluster"},
+	}
+	if len(us) != len(want) {
+		t.Fatalf("Expected %d resources, got %d", len(want), len(us))
+	}
+	for i, w := range want {
+		if us[i].GetAPIVersion() != w.apiVersion || us[i].GetKind() != w.kind || us[i].GetName() != w.name {
+			t.Errorf("Expected %s/%s/%s at position %d, got %s/%s/%s",
+				w.apiVersion, w.kind, w.name, i,
+				us[i].GetAPIVersion(), us[i].GetKind(), us[i].GetName())
+		}
+	}
+}
+
+func TestExpandList(t *testing.T) {
+	tests := []struct {
+		name    string
+		u       *unstructured.Unstructured
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "not a list",
+			u: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+			}},
+			want: 1,
+		},
+		{
+			name: "empty list",
+			u: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "List",
+				"items":      []interface{}{},
+			}},
+			want: 0,
+		},
+		{
+			name: "generic list item without kind",
+			u: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "List",
+				"items": []interface{}{
+					map[string]interface{}{"metadata": map[string]interface{}{"name": "a"}},
+				},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "item not an object",
+			u: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "SecretList",
+				"items":      []interface{}{"a"},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandList(tt.u)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExpandList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && len(got) != tt.want {
+				t.Errorf("ExpandList() got %d items, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_TemplateResourcesInPathYamlList(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(listAssets), nil)
+	if err != nil {
+		t.Errorf("Unable to create templateProcessor %s", err.Error())
+	}
+	y, err := tp.TemplateResourcesInPathYamlList("list", nil, false, values)
+	if err != nil {
+		t.Errorf("Unable to render %s", err.Error())
+	}
+	u := &unstructured.Unstructured{}
+	err = yaml.Unmarshal(y, &u.Object)
+	if err != nil {
+		t.Errorf("Unable to unmarshal %s", err.Error())
+	}
+	if u.GetKind() != ListKind || u.GetAPIVersion() != "v1" {
+		t.Errorf("Expected a v1/List got %s/%s", u.GetAPIVersion(), u.GetKind())
+	}
+	items, err := ExpandList(u)
+	if err != nil {
+		t.Errorf("Unable to expand list %s", err.Error())
+	}
+	if len(items) != 5 {
+		t.Errorf("Expected 5 items got %d", len(items))
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"context"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//lookupFuncMap returns the lookup and lookupList functions which read the existing objects
+//with the Options.LookupClient, they return empty results if the LookupClient is not set.
+func (tp *TemplateProcessor) lookupFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"lookup":     tp.lookup,
+		"lookupList": tp.lookupList,
+	}
+}
+
+//lookup returns the object as a map, for example
+//(lookup "v1" "Secret" "my-namespace" "my-secret").data.password
+//An empty name returns the list of the objects of the namespace as Helm does.
+//An empty map is returned if the object or its kind doesn't exist.
+func (tp *TemplateProcessor) lookup(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+	if name == "" {
+		items, err := tp.lookupList(apiVersion, kind, namespace, "")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind + "List",
+			"items":      items,
+		}, nil
+	}
+	if tp.options.LookupClient == nil {
+		klog.V(4).Infof("No lookup client, lookup of %s %s %s/%s is empty", apiVersion, kind, namespace, name)
+		return map[string]interface{}{}, nil
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(lookupGVK(apiVersion, kind))
+	err := tp.options.LookupClient.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, u)
+	if err != nil {
+		if isLookupNotFound(err) {
+			klog.V(4).Infof("Lookup of %s %s %s/%s not found", apiVersion, kind, namespace, name)
+			return map[string]interface{}{}, nil
+		}
+		return nil, err
+	}
+	return u.Object, nil
+}
+
+//lookupList returns the objects of the namespace matching the label selector, for example
+//range (lookupList "v1" "ConfigMap" "my-namespace" "app=my-app")
+//An empty namespace lists all the namespaces, an empty selector matches all the objects.
+//An empty list is returned if the kind doesn't exist.
+func (tp *TemplateProcessor) lookupList(apiVersion, kind, namespace, selector string) ([]interface{}, error) {
+	items := make([]interface{}, 0)
+	if tp.options.LookupClient == nil {
+		klog.V(4).Infof("No lookup client, lookup of %s %s in %s is empty", apiVersion, kind, namespace)
+		return items, nil
+	}
+	listOptions := &client.ListOptions{Namespace: namespace}
+	if selector != "" {
+		s, err := labels.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+		listOptions.LabelSelector = s
+	}
+	gvk := lookupGVK(apiVersion, kind)
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(gvk.GroupVersion().WithKind(strings.TrimSuffix(gvk.Kind, "List") + "List"))
+	err := tp.options.LookupClient.List(context.TODO(), list, listOptions)
+	if err != nil {
+		if isLookupNotFound(err) {
+			klog.V(4).Infof("Lookup of %s %s in %s not found", apiVersion, kind, namespace)
+			return items, nil
+		}
+		return nil, err
+	}
+	for i := range list.Items {
+		items = append(items, list.Items[i].Object)
+	}
+	return items, nil
+}
+
+func lookupGVK(apiVersion, kind string) schema.GroupVersionKind {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		gv = schema.GroupVersion{Version: apiVersion}
+	}
+	return gv.WithKind(kind)
+}
+
+//isLookupNotFound returns true if the object or its kind doesn't exist
+func isLookupNotFound(err error) bool {
+	return errors.IsNotFound(err) || meta.IsNoMatchError(err)
+}
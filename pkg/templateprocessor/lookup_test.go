@@ -0,0 +1,110 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var lookupAssets = map[string]string{
+	"lookup/secret.yaml": `
+{{- $existing := lookup "v1" "Secret" "default" "db" }}
+apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: default
+data:
+{{- if $existing }}
+  password: {{ $existing.data.password }}
+{{- else }}
+  password: {{ "generated" | encodeBase64 }}
+{{- end }}`,
+	"lookup/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: apps
+  namespace: default
+data:
+  apps: "{{ range lookupList "v1" "ConfigMap" "default" "team=blue" }}{{ .metadata.name }} {{ end }}"
+  all: "{{ len (lookup "v1" "ConfigMap" "default" "").items }}"
+  missing: "{{ len (lookup "v1" "ConfigMap" "default" "missing") }}"
+  crd: "{{ if lookup "example.com/v1" "Unknown" "default" "x" }}found{{ end }}"`,
+}
+
+func TestTemplateProcessor_Lookup(t *testing.T) {
+	existing := []*corev1.ConfigMap{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", Labels: map[string]string{"team": "blue"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", Labels: map[string]string{"team": "red"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "other", Labels: map[string]string{"team": "blue"}}},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("existing")},
+	}
+	tests := []struct {
+		name         string
+		options      *Options
+		wantPassword string
+		wantData     map[string]interface{}
+	}{
+		{
+			name: "with a client",
+			options: &Options{
+				LookupClient: fake.NewFakeClient(existing[0], existing[1], existing[2], secret),
+			},
+			wantPassword: "ZXhpc3Rpbmc=",
+			wantData: map[string]interface{}{
+				"apps":    "a ",
+				"all":     "2",
+				"missing": "0",
+				"crd":     "",
+			},
+		},
+		{
+			name:         "without client",
+			options:      &Options{},
+			wantPassword: "Z2VuZXJhdGVk",
+			wantData: map[string]interface{}{
+				"apps":    "",
+				"all":     "0",
+				"missing": "0",
+				"crd":     "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(lookupAssets), tt.options)
+			if err != nil {
+				t.Fatalf("Unable to create the template processor %s", err.Error())
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured("lookup", nil, false, nil)
+			if err != nil {
+				t.Fatalf("Unable to render %s", err.Error())
+			}
+			if len(us) != 2 {
+				t.Fatalf("Expected 2 resources, got %d", len(us))
+			}
+			for _, u := range us {
+				switch u.GetKind() {
+				case "Secret":
+					got := u.Object["data"].(map[string]interface{})["password"]
+					if got != tt.wantPassword {
+						t.Errorf("Expected password %s, got %v", tt.wantPassword, got)
+					}
+				case "ConfigMap":
+					if !reflect.DeepEqual(u.Object["data"], tt.wantData) {
+						t.Errorf("Expected data %v, got %v", tt.wantData, u.Object["data"])
+					}
+				}
+			}
+		})
+	}
+}
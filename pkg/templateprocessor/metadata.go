@@ -0,0 +1,166 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+)
+
+//podTemplatePaths the path of the pod template for each workload kind
+var podTemplatePaths = map[string][]string{
+	"Deployment":            {"spec", "template"},
+	"StatefulSet":           {"spec", "template"},
+	"DaemonSet":             {"spec", "template"},
+	"ReplicaSet":            {"spec", "template"},
+	"ReplicationController": {"spec", "template"},
+	"Job":                   {"spec", "template"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template"},
+}
+
+//selectorPaths the path of the pod selector labels for each workload kind
+var selectorPaths = map[string][]string{
+	"Deployment":            {"spec", "selector", "matchLabels"},
+	"StatefulSet":           {"spec", "selector", "matchLabels"},
+	"DaemonSet":             {"spec", "selector", "matchLabels"},
+	"ReplicaSet":            {"spec", "selector", "matchLabels"},
+	"ReplicationController": {"spec", "selector"},
+	"Job":                   {"spec", "selector", "matchLabels"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "selector", "matchLabels"},
+}
+
+//injectMetadata injects the options.CommonLabels, options.CommonAnnotations and options.Namespace
+func (tp *TemplateProcessor) injectMetadata(us []*unstructured.Unstructured) error {
+	if len(tp.options.CommonLabels) == 0 &&
+		len(tp.options.CommonAnnotations) == 0 &&
+		tp.options.Namespace == "" {
+		return nil
+	}
+	crdScopes := crdScopes(us)
+	for _, u := range us {
+		u.SetLabels(mergeStringMaps(u.GetLabels(), tp.options.CommonLabels))
+		u.SetAnnotations(mergeStringMaps(u.GetAnnotations(), tp.options.CommonAnnotations))
+		err := injectPodTemplateMetadata(u, tp.options.CommonLabels, tp.options.CommonAnnotations)
+		if err != nil {
+			return err
+		}
+		if tp.options.Namespace == "" ||
+			(u.GetNamespace() != "" && !tp.options.OverrideNamespace) {
+			continue
+		}
+		namespaced, ok := crdScopes[u.GroupVersionKind().GroupKind()]
+		if !ok {
+			namespaced, err = tp.options.ScopeResolver.IsNamespaced(u.GroupVersionKind())
+			if err != nil {
+				if !IsUnknownScopeError(err) {
+					return err
+				}
+				klog.V(2).Infof("Namespace not set on %s %s: %s", u.GetKind(), u.GetName(), err)
+				continue
+			}
+		}
+		if namespaced {
+			u.SetNamespace(tp.options.Namespace)
+		}
+	}
+	return nil
+}
+
+//MergeCommonMetadata sets the CommonLabels and CommonAnnotations of a rendered resource on the current one,
+//as the mergers of the applier don't merge the metadata. It returns true if the current resource changed.
+func (tp *TemplateProcessor) MergeCommonMetadata(current, rendered *unstructured.Unstructured) bool {
+	labels, labelsChanged := copyStringMapKeys(current.GetLabels(), rendered.GetLabels(), tp.options.CommonLabels)
+	annotations, annotationsChanged := copyStringMapKeys(current.GetAnnotations(), rendered.GetAnnotations(),
+		tp.options.CommonAnnotations)
+	if labelsChanged {
+		current.SetLabels(labels)
+	}
+	if annotationsChanged {
+		current.SetAnnotations(annotations)
+	}
+	return labelsChanged || annotationsChanged
+}
+
+//copyStringMapKeys copies the values of the keys from the source map to the current map
+//and returns true if the current map changed
+func copyStringMapKeys(current, source, keys map[string]string) (map[string]string, bool) {
+	changed := false
+	for k := range keys {
+		v, ok := source[k]
+		if !ok {
+			continue
+		}
+		if cv, ok := current[k]; ok && cv == v {
+			continue
+		}
+		if current == nil {
+			current = make(map[string]string)
+		}
+		current[k] = v
+		changed = true
+	}
+	return current, changed
+}
+
+//injectPodTemplateMetadata injects the labels and annotations in the pod template of a workload.
+//The labels which are part of the selector are not changed to keep the selector matching the pods.
+func injectPodTemplateMetadata(u *unstructured.Unstructured, labels, annotations map[string]string) error {
+	templatePath, ok := podTemplatePaths[u.GetKind()]
+	if !ok {
+		return nil
+	}
+	template, found, err := unstructured.NestedMap(u.Object, templatePath...)
+	if err != nil || !found {
+		return err
+	}
+	selector, _, err := unstructured.NestedStringMap(u.Object, selectorPaths[u.GetKind()]...)
+	if err != nil {
+		return err
+	}
+	podLabels := make(map[string]string)
+	for k, v := range labels {
+		if _, ok := selector[k]; ok {
+			klog.V(2).Infof("Label %s not set on the pod template of %s %s as it is part of the selector",
+				k, u.GetKind(), u.GetName())
+			continue
+		}
+		podLabels[k] = v
+	}
+	pod := &unstructured.Unstructured{Object: template}
+	pod.SetLabels(mergeStringMaps(pod.GetLabels(), podLabels))
+	pod.SetAnnotations(mergeStringMaps(pod.GetAnnotations(), annotations))
+	return unstructured.SetNestedMap(u.Object, pod.Object, templatePath...)
+}
+
+//crdScopes returns the scope of the custom resources defined by the CRDs in the resources
+func crdScopes(us []*unstructured.Unstructured) map[schema.GroupKind]bool {
+	scopes := make(map[schema.GroupKind]bool)
+	for _, u := range us {
+		if u.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(u.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(u.Object, "spec", "names", "kind")
+		scope, _, _ := unstructured.NestedString(u.Object, "spec", "scope")
+		if kind == "" {
+			continue
+		}
+		scopes[schema.GroupKind{Group: group, Kind: kind}] = scope != "Cluster"
+	}
+	return scopes
+}
+
+//mergeStringMaps returns the current map with the values of the added map, nil if both are empty
+func mergeStringMaps(current, added map[string]string) map[string]string {
+	if len(added) == 0 {
+		return current
+	}
+	if current == nil {
+		current = make(map[string]string, len(added))
+	}
+	for k, v := range added {
+		current[k] = v
+	}
+	return current
+}
@@ -0,0 +1,175 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var metadataAssets = map[string]string{
+	"metadata/deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: mydeployment
+  labels:
+    app: myapp
+spec:
+  selector:
+    matchLabels:
+      app: myapp
+  template:
+    metadata:
+      labels:
+        app: myapp
+    spec:
+      containers:
+      - name: mycontainer
+        image: myimage`,
+	"metadata/clusterrole": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: myclusterrole`,
+	"metadata/serviceaccount": `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: mysa
+  namespace: myns`,
+	"metadata/crd": `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: mycrs.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    kind: MyCR`,
+	"metadata/cr": `
+apiVersion: example.com/v1
+kind: MyCR
+metadata:
+  name: mycr`,
+	"metadata/unknown": `
+apiVersion: unknown.example.com/v1
+kind: Unknown
+metadata:
+  name: myunknown`,
+}
+
+func TestTemplateProcessor_PostRender(t *testing.T) {
+	commonLabels := map[string]string{
+		"app":   "other",
+		"owner": "me",
+	}
+	commonAnnotations := map[string]string{
+		"team": "us",
+	}
+	tests := []struct {
+		name           string
+		options        *Options
+		wantNamespaces map[string]string
+	}{
+		{
+			name: "default namespace",
+			options: &Options{
+				CommonLabels:      commonLabels,
+				CommonAnnotations: commonAnnotations,
+				Namespace:         "default-ns",
+			},
+			wantNamespaces: map[string]string{
+				"mydeployment":      "default-ns",
+				"myclusterrole":     "",
+				"mysa":              "myns",
+				"mycrs.example.com": "",
+				"mycr":              "default-ns",
+				"myunknown":         "",
+			},
+		},
+		{
+			name: "override namespace",
+			options: &Options{
+				CommonLabels:      commonLabels,
+				CommonAnnotations: commonAnnotations,
+				Namespace:         "override-ns",
+				OverrideNamespace: true,
+			},
+			wantNamespaces: map[string]string{
+				"mydeployment":      "override-ns",
+				"myclusterrole":     "",
+				"mysa":              "override-ns",
+				"mycrs.example.com": "",
+				"mycr":              "override-ns",
+				"myunknown":         "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(metadataAssets), tt.options)
+			if err != nil {
+				t.Fatalf("Unable to create templateProcessor %s", err.Error())
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured("metadata", nil, false, nil)
+			if err != nil {
+				t.Fatalf("Unable to render %s", err.Error())
+			}
+			for _, u := range us {
+				if u.GetLabels()["owner"] != "me" || u.GetLabels()["app"] != "other" {
+					t.Errorf("Labels not injected in %s: %v", u.GetName(), u.GetLabels())
+				}
+				if !reflect.DeepEqual(u.GetAnnotations(), commonAnnotations) {
+					t.Errorf("Annotations not injected in %s: %v", u.GetName(), u.GetAnnotations())
+				}
+				if u.GetNamespace() != tt.wantNamespaces[u.GetName()] {
+					t.Errorf("Expected namespace %s for %s, got %s",
+						tt.wantNamespaces[u.GetName()], u.GetName(), u.GetNamespace())
+				}
+				if u.GetKind() != "Deployment" {
+					continue
+				}
+				podLabels, _, _ := unstructured.NestedStringMap(u.Object, "spec", "template", "metadata", "labels")
+				if !reflect.DeepEqual(podLabels, map[string]string{"app": "myapp", "owner": "me"}) {
+					t.Errorf("Expected the selector label to be kept on the pod template, got %v", podLabels)
+				}
+				selector, _, _ := unstructured.NestedStringMap(u.Object, "spec", "selector", "matchLabels")
+				if !reflect.DeepEqual(selector, map[string]string{"app": "myapp"}) {
+					t.Errorf("Expected the selector to be unchanged, got %v", selector)
+				}
+				podAnnotations, _, _ := unstructured.NestedStringMap(u.Object,
+					"spec", "template", "metadata", "annotations")
+				if !reflect.DeepEqual(podAnnotations, commonAnnotations) {
+					t.Errorf("Annotations not injected in the pod template: %v", podAnnotations)
+				}
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_TemplateResourcesInPathYaml_Metadata(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(metadataAssets), &Options{
+		CommonLabels: map[string]string{"owner": "me"},
+		Namespace:    "default-ns",
+	})
+	if err != nil {
+		t.Fatalf("Unable to create templateProcessor %s", err.Error())
+	}
+	ys, err := tp.TemplateResourcesInPathYaml("metadata", []string{"metadata/unknown"}, false, nil)
+	if err != nil {
+		t.Fatalf("Unable to render %s", err.Error())
+	}
+	us, err := tp.BytesArrayToUnstructured(ys)
+	if err != nil {
+		t.Fatalf("Unable to decode %s", err.Error())
+	}
+	for _, u := range us {
+		if u.GetLabels()["owner"] != "me" {
+			t.Errorf("Labels not injected in the yaml of %s", u.GetName())
+		}
+	}
+}
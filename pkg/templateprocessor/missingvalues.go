@@ -0,0 +1,448 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"k8s.io/klog"
+)
+
+//maxIncludeDepth limits the depth of the included templates followed by MissingValues
+const maxIncludeDepth = 20
+
+//guardFunctions are the functions which handle a missing value
+var guardFunctions = map[string]bool{
+	"default":  true,
+	"empty":    true,
+	"coalesce": true,
+	"hasKey":   true,
+}
+
+//MissingValue is a reference of a template to a value which is not in the values
+type MissingValue struct {
+	//The path of the value, for example .image.tag
+	Path string
+	//The template using the value
+	Template string
+	//The file where the value is used, the template or the partial the template includes
+	File   string
+	Line   int
+	Column int
+	//True if the reference is guarded by an if, with, range or a function like default
+	//and the template can be rendered without the value
+	Guarded bool
+}
+
+//String returns the location and the path of the value
+func (m MissingValue) String() string {
+	s := fmt.Sprintf("%s:%d:%d: %s", m.File, m.Line, m.Column, m.Path)
+	if m.File != m.Template {
+		s = fmt.Sprintf("%s (included by %s)", s, m.Template)
+	}
+	if m.Guarded {
+		s = fmt.Sprintf("%s (guarded)", s)
+	}
+	return s
+}
+
+//MissingValuesInPath returns the values missing for the templates of a path,
+//see MissingValues
+func (tp *TemplateProcessor) MissingValuesInPath(
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) ([]MissingValue, error) {
+	templateNames, err := tp.AssetNamesInPath(path, excluded, recursive)
+	if err != nil {
+		return nil, err
+	}
+	return tp.MissingValues(templateNames, values)
+}
+
+//MissingValues returns all the references of the templates to values which are not in the values,
+//instead of stopping at the first one with MissingKeyTypeError or rendering a zero value with MissingKeyTypeZero.
+//The templates are analysed without being rendered, the if, else, with and range branches are all followed,
+//as well as the included templates. The references which can be missing are flagged as Guarded:
+//the conditions of if, with and range, the pipelines with a default, empty, coalesce or hasKey function
+//and the references under a value checked by an enclosing if or with.
+//A reference with a missing parent, like .image.tag without .image, fails the render
+//and is guarded only if the parent is checked by an enclosing if or with.
+//The references of the items of a list are analysed for each item.
+//The values schema is not validated.
+func (tp *TemplateProcessor) MissingValues(templateNames []string, values interface{}) ([]MissingValue, error) {
+	values = tp.injectCapabilities(values)
+	p, err := tp.newPartials()
+	if err != nil {
+		return nil, err
+	}
+	missing := make([]MissingValue, 0)
+	for _, templateName := range templateNames {
+		tmpl, err := tp.parseTemplate(p, templateName)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl == nil {
+			continue
+		}
+		a := &missingValuesAnalyzer{
+			tp:           tp,
+			templateName: templateName,
+			tmpl:         tmpl,
+			seen:         make(map[string]bool),
+		}
+		root := valueRef{value: values, known: true}
+		a.walk(tmpl.Tree, tmpl.Tree.Root, &scope{
+			dot:  root,
+			vars: map[string]valueRef{"$": root},
+		}, 0)
+		missing = append(missing, a.missing...)
+	}
+	sort.SliceStable(missing, func(i, j int) bool {
+		if missing[i].Template != missing[j].Template {
+			return missing[i].Template < missing[j].Template
+		}
+		if missing[i].File != missing[j].File {
+			return missing[i].File < missing[j].File
+		}
+		if missing[i].Line != missing[j].Line {
+			return missing[i].Line < missing[j].Line
+		}
+		return missing[i].Column < missing[j].Column
+	})
+	return missing, nil
+}
+
+//valueRef is a value referenced by a template, known is false if the value can not be determined
+type valueRef struct {
+	path  string
+	value interface{}
+	known bool
+}
+
+//scope is the dot, the variables and the guarded paths of a template node
+type scope struct {
+	dot    valueRef
+	vars   map[string]valueRef
+	guards []string
+}
+
+func (s *scope) with(dot valueRef, guards []string) *scope {
+	vars := make(map[string]valueRef, len(s.vars))
+	for k, v := range s.vars {
+		vars[k] = v
+	}
+	return &scope{
+		dot:    dot,
+		vars:   vars,
+		guards: append(append([]string{}, s.guards...), guards...),
+	}
+}
+
+func (s *scope) isGuarded(path string) bool {
+	for _, g := range s.guards {
+		if path == g || strings.HasPrefix(path, g+".") || strings.HasPrefix(path, g+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+type missingValuesAnalyzer struct {
+	tp           *TemplateProcessor
+	templateName string
+	tmpl         *template.Template
+	missing      []MissingValue
+	//The reported references by location and path
+	seen map[string]bool
+}
+
+func (a *missingValuesAnalyzer) walk(tree *parse.Tree, node parse.Node, s *scope, depth int) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			a.walk(tree, child, s, depth)
+		}
+	case *parse.ActionNode:
+		a.pipe(tree, n.Pipe, s, false, depth)
+	case *parse.IfNode:
+		_, guards := a.pipe(tree, n.Pipe, s, true, depth)
+		a.walk(tree, n.List, s.with(s.dot, guards), depth)
+		a.walk(tree, n.ElseList, s, depth)
+	case *parse.WithNode:
+		ref, guards := a.pipe(tree, n.Pipe, s, true, depth)
+		a.walk(tree, n.List, s.with(ref, guards), depth)
+		a.walk(tree, n.ElseList, s, depth)
+	case *parse.RangeNode:
+		a.walkRange(tree, n, s, depth)
+	case *parse.TemplateNode:
+		dot := valueRef{}
+		if n.Pipe != nil {
+			dot, _ = a.pipe(tree, n.Pipe, s, false, depth)
+		}
+		a.include(n.Name, dot, s, depth)
+	}
+}
+
+func (a *missingValuesAnalyzer) walkRange(tree *parse.Tree, n *parse.RangeNode, s *scope, depth int) {
+	ref, _ := a.pipe(tree, n.Pipe, s, true, depth)
+	items := make([]valueRef, 0)
+	if ref.known {
+		v := reflect.ValueOf(ref.value)
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				items = append(items, valueRef{
+					path:  fmt.Sprintf("%s[%d]", ref.path, i),
+					value: v.Index(i).Interface(),
+					known: true,
+				})
+			}
+		case reflect.Map:
+			keys := make([]string, 0, v.Len())
+			for _, k := range v.MapKeys() {
+				keys = append(keys, fmt.Sprint(k.Interface()))
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				item, _ := lookupValue(ref.value, k)
+				items = append(items, valueRef{path: ref.path + "." + k, value: item, known: true})
+			}
+		}
+	}
+	if len(items) == 0 {
+		//The items are unknown, only the variables and $ can be checked
+		items = append(items, valueRef{})
+	}
+	//The range guards the missing list, not the references to its items
+	for _, item := range items {
+		itemScope := s.with(item, nil)
+		if len(n.Pipe.Decl) > 0 {
+			itemScope.vars[n.Pipe.Decl[len(n.Pipe.Decl)-1].Ident[0]] = item
+		}
+		a.walk(tree, n.List, itemScope, depth)
+	}
+	a.walk(tree, n.ElseList, s, depth)
+}
+
+//include analyses a defined template with the dot
+func (a *missingValuesAnalyzer) include(name string, dot valueRef, s *scope, depth int) {
+	t := a.tmpl.Lookup(name)
+	if t == nil || t.Tree == nil || depth >= maxIncludeDepth {
+		return
+	}
+	//The variables are not visible in the included template
+	root := s.vars["$"]
+	a.walk(t.Tree, t.Tree.Root, &scope{
+		dot:    dot,
+		vars:   map[string]valueRef{"$": root},
+		guards: s.guards,
+	}, depth+1)
+}
+
+//pipe analyses a pipeline and returns the referenced value if it is a single reference
+//and the paths of the referenced values
+func (a *missingValuesAnalyzer) pipe(
+	tree *parse.Tree,
+	pipe *parse.PipeNode,
+	s *scope,
+	guarded bool,
+	depth int,
+) (valueRef, []string) {
+	if pipe == nil {
+		return valueRef{}, nil
+	}
+	for _, cmd := range pipe.Cmds {
+		if len(cmd.Args) > 0 {
+			if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok && guardFunctions[id.Ident] {
+				guarded = true
+			}
+		}
+	}
+	result := valueRef{}
+	paths := make([]string, 0)
+	for _, cmd := range pipe.Cmds {
+		for i, arg := range cmd.Args {
+			ref := a.arg(tree, arg, s, guarded, depth)
+			if ref.path != "" {
+				paths = append(paths, ref.path)
+			}
+			if len(pipe.Cmds) == 1 && len(cmd.Args) == 1 && i == 0 {
+				result = ref
+			}
+		}
+		a.includeCall(tree, cmd, s, guarded, depth)
+	}
+	for _, v := range pipe.Decl {
+		s.vars[v.Ident[0]] = result
+	}
+	return result, paths
+}
+
+//includeCall analyses the template of an include "name" dot call
+func (a *missingValuesAnalyzer) includeCall(tree *parse.Tree, cmd *parse.CommandNode, s *scope, guarded bool, depth int) {
+	if len(cmd.Args) != 3 {
+		return
+	}
+	id, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok || id.Ident != "include" {
+		return
+	}
+	name, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return
+	}
+	dot := a.arg(tree, cmd.Args[2], s, guarded, depth)
+	a.include(name.Text, dot, s, depth)
+}
+
+//arg returns the value referenced by a node, the missing references are reported
+func (a *missingValuesAnalyzer) arg(tree *parse.Tree, node parse.Node, s *scope, guarded bool, depth int) valueRef {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return s.dot
+	case *parse.FieldNode:
+		return a.resolve(tree, n, s.dot, n.Ident, s, guarded)
+	case *parse.VariableNode:
+		base, ok := s.vars[n.Ident[0]]
+		if !ok {
+			return valueRef{}
+		}
+		return a.resolve(tree, n, base, n.Ident[1:], s, guarded)
+	case *parse.ChainNode:
+		base := valueRef{}
+		if p, ok := n.Node.(*parse.PipeNode); ok {
+			base, _ = a.pipe(tree, p, s, guarded, depth)
+		} else {
+			base = a.arg(tree, n.Node, s, guarded, depth)
+		}
+		return a.resolve(tree, n, base, n.Field, s, guarded)
+	case *parse.PipeNode:
+		ref, _ := a.pipe(tree, n, s, guarded, depth)
+		return ref
+	}
+	return valueRef{}
+}
+
+//resolve follows the fields from the base value and reports the reference if a field is missing
+func (a *missingValuesAnalyzer) resolve(
+	tree *parse.Tree,
+	node parse.Node,
+	base valueRef,
+	fields []string,
+	s *scope,
+	guarded bool,
+) valueRef {
+	ref := base
+	for i, field := range fields {
+		if !ref.known {
+			return valueRef{}
+		}
+		value, state := lookupValue(ref.value, field)
+		switch state {
+		case lookupMissing:
+			path := base.path + "." + strings.Join(fields, ".")
+			if i < len(fields)-1 {
+				//A missing parent fails the render even in a condition or with a default,
+				//the reference is guarded only if an enclosing if or with guards the parent
+				parent := base.path + "." + strings.Join(fields[:i+1], ".")
+				a.report(tree, node, path, s.isGuarded(parent))
+				return valueRef{path: path}
+			}
+			a.report(tree, node, path, guarded || s.isGuarded(path))
+			return valueRef{path: path}
+		case lookupUnknown:
+			return valueRef{path: base.path + "." + strings.Join(fields[:i+1], ".")}
+		}
+		ref = valueRef{path: ref.path + "." + field, value: value, known: true}
+	}
+	return ref
+}
+
+func (a *missingValuesAnalyzer) report(tree *parse.Tree, node parse.Node, path string, guarded bool) {
+	location, _ := tree.ErrorContext(node)
+	//The location is name:line:column
+	parts := strings.Split(location, ":")
+	if len(parts) < 3 {
+		return
+	}
+	line, _ := strconv.Atoi(parts[len(parts)-2])
+	column, _ := strconv.Atoi(parts[len(parts)-1])
+	//The position of a reference like .a.b or $.a is the one of its second element
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		if len(n.Ident) > 1 {
+			column -= len(n.Ident[0]) + 1
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 {
+			column -= len(n.Ident[0])
+		}
+	}
+	file := strings.Join(parts[:len(parts)-2], ":")
+	key := fmt.Sprintf("%s:%d:%d:%s", file, line, column, path)
+	if a.seen[key] {
+		return
+	}
+	a.seen[key] = true
+	klog.V(5).Infof("Missing value %s in %s", path, location)
+	a.missing = append(a.missing, MissingValue{
+		Path:     path,
+		Template: a.templateName,
+		File:     file,
+		Line:     line,
+		Column:   column,
+		Guarded:  guarded,
+	})
+}
+
+type lookupState int
+
+const (
+	lookupFound lookupState = iota
+	lookupMissing
+	lookupUnknown
+)
+
+//lookupValue returns the field of a value, it is missing if the value is a map without the key
+//or nil, unknown if it is not a map, for example a method of a struct
+func lookupValue(value interface{}, field string) (interface{}, lookupState) {
+	if value == nil {
+		return nil, lookupMissing
+	}
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, lookupMissing
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, lookupUnknown
+		}
+		e := v.MapIndex(reflect.ValueOf(field).Convert(v.Type().Key()))
+		if !e.IsValid() {
+			return nil, lookupMissing
+		}
+		return e.Interface(), lookupFound
+	case reflect.Struct:
+		f := v.FieldByName(field)
+		if !f.IsValid() || !f.CanInterface() {
+			return nil, lookupUnknown
+		}
+		return f.Interface(), lookupFound
+	}
+	return nil, lookupUnknown
+}
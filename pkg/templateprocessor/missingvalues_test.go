@@ -0,0 +1,151 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+var missingValuesAssets = map[string]string{
+	"missing/_helpers.tpl": `{{- define "labels" -}}
+app: {{ .name }}
+team: {{ .team }}
+{{- end -}}
+`,
+	"missing/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .name }}
+  labels:
+{{ include "labels" . | indent 4 }}
+spec:
+  replicas: {{ .replicas | default 1 }}
+  template:
+    spec:
+      containers:
+      - image: {{ .image.repository }}:{{ .image.tag }}
+{{- if .resources }}
+        resources:
+          limits:
+            cpu: {{ .resources.cpu }}
+{{- end }}
+{{- with .probe }}
+        livenessProbe:
+          path: {{ .path }}
+{{- end }}
+        env:
+{{- range .env }}
+        - name: {{ .name }}
+          value: {{ .value }}
+{{- end }}
+        args: [{{ $.debug }}]`,
+	"missing/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name }}
+data:
+  version: {{ .Capabilities.KubeVersion.Version }}
+  openshift: "{{ .Capabilities.APIVersions.Has "route.openshift.io/v1" }}"`,
+}
+
+func TestTemplateProcessor_MissingValues(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(missingValuesAssets), &Options{Capabilities: DefaultCapabilities()})
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	values := map[string]interface{}{
+		"name":  "app",
+		"image": map[string]interface{}{"repository": "quay.io/app"},
+		"env": []interface{}{
+			map[string]interface{}{"name": "A", "value": "1"},
+			map[string]interface{}{"name": "B"},
+		},
+	}
+	got, err := tp.MissingValuesInPath("missing", nil, false, values)
+	if err != nil {
+		t.Fatalf("Unable to find the missing values %s", err.Error())
+	}
+	const deployment = "missing/deployment.yaml"
+	const helpers = "missing/_helpers.tpl"
+	want := []MissingValue{
+		{Path: ".team", Template: deployment, File: helpers, Line: 3, Column: 9},
+		{Path: ".replicas", Template: deployment, File: deployment, Line: 8, Column: 15, Guarded: true},
+		{Path: ".image.tag", Template: deployment, File: deployment, Line: 12, Column: 42},
+		{Path: ".resources", Template: deployment, File: deployment, Line: 13, Column: 7, Guarded: true},
+		{Path: ".resources.cpu", Template: deployment, File: deployment, Line: 16, Column: 20, Guarded: true},
+		{Path: ".probe", Template: deployment, File: deployment, Line: 18, Column: 9, Guarded: true},
+		{Path: ".env[1].value", Template: deployment, File: deployment, Line: 25, Column: 20},
+		{Path: ".debug", Template: deployment, File: deployment, Line: 27, Column: 18},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected\n%v\ngot\n%v", want, got)
+	}
+	if s := want[0].String(); s != "missing/_helpers.tpl:3:9: .team (included by missing/deployment.yaml)" {
+		t.Errorf("Unexpected string %s", s)
+	}
+	if s := want[1].String(); s != "missing/deployment.yaml:8:15: .replicas (guarded)" {
+		t.Errorf("Unexpected string %s", s)
+	}
+}
+
+func TestTemplateProcessor_MissingValues_MissingParent(t *testing.T) {
+	assets := map[string]string{
+		"parent/deployment.yaml": `image: {{ .image.tag | default "latest" }}
+{{- if .image }}
+tag: {{ .image.tag | default "latest" }}
+{{- end }}
+{{- if .registry.host }}
+registry: true
+{{- end }}`,
+	}
+	tp, err := NewTemplateProcessor(NewTestReader(assets), &Options{})
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	got, err := tp.MissingValuesInPath("parent", nil, false, map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Unable to find the missing values %s", err.Error())
+	}
+	const deployment = "parent/deployment.yaml"
+	want := []MissingValue{
+		{Path: ".image.tag", Template: deployment, File: deployment, Line: 1, Column: 10},
+		{Path: ".image", Template: deployment, File: deployment, Line: 2, Column: 7, Guarded: true},
+		{Path: ".image.tag", Template: deployment, File: deployment, Line: 3, Column: 8, Guarded: true},
+		{Path: ".registry.host", Template: deployment, File: deployment, Line: 5, Column: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected\n%v\ngot\n%v", want, got)
+	}
+	//The render fails on the references which are not guarded
+	_, err = tp.TemplateResource(deployment, map[string]interface{}{})
+	if err == nil {
+		t.Error("Expected the render to fail on the missing .image")
+	}
+}
+
+func Test_lookupValue(t *testing.T) {
+	type named map[string]interface{}
+	tests := []struct {
+		name      string
+		value     interface{}
+		field     string
+		want      interface{}
+		wantState lookupState
+	}{
+		{name: "map", value: map[string]interface{}{"a": 1}, field: "a", want: 1, wantState: lookupFound},
+		{name: "named map", value: named{"a": 1}, field: "a", want: 1, wantState: lookupFound},
+		{name: "missing key", value: map[string]interface{}{}, field: "a", wantState: lookupMissing},
+		{name: "nil", value: nil, field: "a", wantState: lookupMissing},
+		{name: "struct field", value: &KubeVersion{Minor: "18"}, field: "Minor", want: "18", wantState: lookupFound},
+		{name: "method", value: VersionSet{}, field: "Has", wantState: lookupUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, state := lookupValue(tt.value, tt.field)
+			if state != tt.wantState || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookupValue() = %v %v, want %v %v", got, state, tt.want, tt.wantState)
+			}
+		})
+	}
+}
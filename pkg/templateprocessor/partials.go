@@ -0,0 +1,143 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+//PartialsExtension is the extension of the partials, the files defining the named templates
+const PartialsExtension = ".tpl"
+
+//IsPartial returns true if the asset is a partial, a _*.tpl file like the _helpers.tpl
+func IsPartial(name string) bool {
+	base := filepath.Base(name)
+	return strings.HasPrefix(base, "_") && filepath.Ext(base) == PartialsExtension
+}
+
+//partials indexes the partials of the reader
+type partials struct {
+	//The .tpl files of the Options.PartialsPath
+	shared []string
+	//The _*.tpl files by directory
+	byDir map[string][]string
+}
+
+//newPartials indexes the partials of the reader
+func (tp *TemplateProcessor) newPartials() (*partials, error) {
+	names, err := tp.reader.AssetNames()
+	if err != nil {
+		return nil, err
+	}
+	names = append([]string{}, names...)
+	sort.Strings(names)
+	p := &partials{
+		byDir: make(map[string][]string),
+	}
+	for _, name := range names {
+		switch {
+		case tp.isSharedPartial(name):
+			p.shared = append(p.shared, name)
+		case IsPartial(name):
+			dir := filepath.Dir(filepath.Clean(name))
+			p.byDir[dir] = append(p.byDir[dir], name)
+		}
+	}
+	return p, nil
+}
+
+//isSharedPartial returns true if the asset is a .tpl file of the Options.PartialsPath or of its subdirectories
+func (tp *TemplateProcessor) isSharedPartial(name string) bool {
+	if tp.options.PartialsPath == "" || filepath.Ext(name) != PartialsExtension {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(tp.options.PartialsPath), filepath.Clean(name))
+	return err == nil && !isOutside(rel)
+}
+
+//isPartial returns true if the asset is a partial and not a template to render
+func (tp *TemplateProcessor) isPartial(name string) bool {
+	return IsPartial(name) || tp.isSharedPartial(name)
+}
+
+//of returns the partials available to a template in the order they are parsed, the shared partials
+//then the partials of the base directory of the reader and of each directory down to the directory of the template,
+//a template defined again by a later partial replaces the former one.
+func (p *partials) of(templateName string) []string {
+	dir := filepath.Dir(filepath.Clean(templateName))
+	dirs := []string{dir}
+	for d := dir; d != "." && filepath.Dir(d) != d; {
+		d = filepath.Dir(d)
+		dirs = append(dirs, d)
+	}
+	names := append([]string{}, p.shared...)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		names = append(names, p.byDir[dirs[i]]...)
+	}
+	return names
+}
+
+//parse parses the partials available to a template in the template set of the template.
+//The text of the partials outside of their define blocks is rendered before the template,
+//as when the _helpers.tpl was prepended to it: parse returns its nodes and the variables it declares.
+func (p *partials) parse(
+	tp *TemplateProcessor,
+	tmpl *template.Template,
+	templateName string,
+) ([]parse.Node, []string, error) {
+	nodes := make([]parse.Node, 0)
+	vars := make([]string, 0)
+	for _, name := range p.of(templateName) {
+		b, err := tp.reader.Asset(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		t, err := parseWithVariables(tmpl.New(name), string(b), vars)
+		if err != nil {
+			return nil, nil, err
+		}
+		if t.Tree == nil {
+			continue
+		}
+		nodes = append(nodes, t.Tree.Root.Nodes...)
+		for _, node := range t.Tree.Root.Nodes {
+			if action, ok := node.(*parse.ActionNode); ok {
+				for _, v := range action.Pipe.Decl {
+					vars = append(vars, v.Ident[0])
+				}
+			}
+		}
+	}
+	return nodes, vars, nil
+}
+
+//parseWithVariables parses a text using the variables declared by the partials parsed before.
+//As the parser rejects the undefined variables, the text is parsed after a declaration of the variables
+//it contains, the declarations are then removed from the parsed nodes.
+func parseWithVariables(t *template.Template, text string, vars []string) (*template.Template, error) {
+	declarations := ""
+	declared := make(map[string]bool)
+	for _, v := range vars {
+		if !declared[v] && strings.Contains(text, v) {
+			declarations += "{{" + v + " := 0}}"
+			declared[v] = true
+		}
+	}
+	t, err := t.Parse(declarations + text)
+	if err != nil {
+		return nil, err
+	}
+	if t.Tree != nil {
+		t.Tree.Root.Nodes = t.Tree.Root.Nodes[len(declared):]
+	}
+	return t, nil
+}
+
+//isOutside returns true if a relative path goes out of its base directory
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
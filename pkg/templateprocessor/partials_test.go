@@ -0,0 +1,159 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+var partialsAssets = map[string]string{
+	"shared/common.tpl": `{{- define "team" -}}platform{{- end -}}
+{{- define "name" -}}shared{{- end -}}`,
+	"root/_helpers.tpl": `{{- define "name" -}}root{{- end -}}
+{{- define "labels" -}}
+team: {{ include "team" . }}
+{{- end -}}`,
+	"root/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "name" . }}
+  namespace: default
+  labels:
+{{ include "labels" . | indent 4 }}`,
+	"root/sub/_names.tpl": `{{- define "name" -}}sub{{- end -}}`,
+	"root/sub/_ports.tpl": `{{- define "port" -}}8080{{- end -}}`,
+	"root/sub/deep/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "name" . }}-deep
+  namespace: default
+  labels:
+{{ include "labels" . | indent 4 }}
+data:
+  port: "{{ include "port" . }}"`,
+	"root/other/_names.tpl": `{{- define "name" -}}other{{- end -}}`,
+	"root/other/_fail.tpl": `{{- define "fail" -}}
+{{ fail "partial failed" }}
+{{- end -}}`,
+	"root/other/fail.yaml": `{{ if .fail }}{{ include "fail" . }}{{ end }}`,
+}
+
+func TestTemplateProcessor_Partials(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(partialsAssets), &Options{PartialsPath: "shared"})
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured("root", nil, true, map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Unable to render %s", err.Error())
+	}
+	names := make(map[string]map[string]string)
+	for _, u := range us {
+		names[u.GetName()] = u.GetLabels()
+	}
+	want := map[string]map[string]string{
+		"root":     {"team": "platform"},
+		"sub-deep": {"team": "platform"},
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected %v, got %v", want, names)
+	}
+	_, err = tp.TemplateResourcesInPathUnstructured("root", nil, true, map[string]interface{}{"fail": true})
+	if !IsRenderError(err) {
+		t.Fatalf("Expected a RenderError, got %v", err)
+	}
+	e := err.(*RenderError)
+	if e.Template != "root/other/fail.yaml" || e.File != "root/other/_fail.tpl" || e.Line != 2 || e.Column != 3 {
+		t.Errorf("Expected the error in root/other/_fail.tpl:2:3, got %s:%d:%d", e.File, e.Line, e.Column)
+	}
+}
+
+func TestTemplateProcessor_PartialsTemplateResource(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(partialsAssets), &Options{PartialsPath: "shared"})
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	want, err := tp.TemplateResources([]string{"root/sub/deep/cm.yaml"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Unable to render %s", err.Error())
+	}
+	//Rendered alone, the template inherits the partials of its parent directories as in a list
+	got, err := tp.TemplateResource("root/sub/deep/cm.yaml", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Unable to render %s", err.Error())
+	}
+	if len(want) != 1 || string(got) != string(want[0]) {
+		t.Errorf("Expected\n%s\ngot\n%s", want, got)
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured("root/sub", nil, true, map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Unable to render %s", err.Error())
+	}
+	if len(us) != 1 || us[0].GetName() != "sub-deep" || us[0].GetLabels()["team"] != "platform" {
+		t.Errorf("Expected sub-deep with the inherited labels, got %v", us)
+	}
+}
+
+func Test_partials_of(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(partialsAssets), &Options{PartialsPath: "shared"})
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	tests := []struct {
+		name         string
+		templateName string
+		want         []string
+	}{
+		{
+			name:         "root",
+			templateName: "root/cm.yaml",
+			want:         []string{"shared/common.tpl", "root/_helpers.tpl"},
+		},
+		{
+			name:         "inherited",
+			templateName: "root/sub/deep/cm.yaml",
+			want:         []string{"shared/common.tpl", "root/_helpers.tpl", "root/sub/_names.tpl", "root/sub/_ports.tpl"},
+		},
+		{
+			name:         "sibling",
+			templateName: "root/other/fail.yaml",
+			want:         []string{"shared/common.tpl", "root/_helpers.tpl", "root/other/_fail.tpl", "root/other/_names.tpl"},
+		},
+		{
+			name:         "base directory",
+			templateName: "cm.yaml",
+			want:         []string{"shared/common.tpl"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tp.newPartials()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.of(tt.templateName); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("partials.of() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPartial(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "dir/_helpers.tpl", want: true},
+		{name: "_labels.tpl", want: true},
+		{name: "dir/helpers.tpl", want: false},
+		{name: "dir/_deployment.yaml", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPartial(tt.name); got != tt.want {
+				t.Errorf("IsPartial() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
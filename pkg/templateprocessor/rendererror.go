@@ -0,0 +1,197 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+//RenderPhase is the phase in which a template failed
+type RenderPhase string
+
+const (
+	//RenderPhaseTemplate is the rendering of the template
+	RenderPhaseTemplate RenderPhase = "render"
+	//RenderPhaseDecode is the decoding of the rendered yaml or json
+	RenderPhaseDecode RenderPhase = "decode"
+)
+
+//snippetContext is the number of lines displayed before and after the line of the error
+const snippetContext = 2
+
+//templateErrorRegexp matches the locations of the text/template errors, for example
+//template: dir/file.yaml:12:5: executing "dir/file.yaml" at <.Values.x>: ...
+//The errors of the included templates are nested in the error of the include.
+var templateErrorRegexp = regexp.MustCompile(`template: ([^\s:]+):(\d+)(?::(\d+))?: `)
+
+//yamlErrorRegexp matches the line of the yaml errors
+var yamlErrorRegexp = regexp.MustCompile(`yaml: line (\d+):`)
+
+//RenderError is returned when a template can not be rendered or its rendered yaml can not be decoded
+type RenderError struct {
+	Phase RenderPhase
+	//The template being rendered
+	Template string
+	//The file where the error is, the template or the partial the template includes
+	File string
+	//The line and column in the File for the render errors,
+	//the line in the rendered template for the decode errors, 0 if unknown
+	Line   int
+	Column int
+	//The index of the document in the rendered template for the decode errors, -1 for the render errors
+	Document int
+	//The lines around the error, from the File for the render errors
+	//and from the rendered template for the decode errors
+	Snippet string
+	//The error without its location
+	Message string
+	//The original error
+	Err error
+}
+
+//Error returns the location, the message and the snippet of the error
+func (e *RenderError) Error() string {
+	var location string
+	switch e.Phase {
+	case RenderPhaseDecode:
+		location = fmt.Sprintf("%s document %d", e.Template, e.Document)
+		if e.Line > 0 {
+			location = fmt.Sprintf("%s line %d", location, e.Line)
+		}
+	default:
+		location = e.File
+		if e.Line > 0 {
+			location = fmt.Sprintf("%s:%d", location, e.Line)
+		}
+		if e.Column > 0 {
+			location = fmt.Sprintf("%s:%d", location, e.Column)
+		}
+		if e.File != e.Template {
+			location = fmt.Sprintf("%s (included by %s)", location, e.Template)
+		}
+	}
+	msg := fmt.Sprintf("%s %s: %s", e.Phase, location, e.Message)
+	if e.Snippet != "" {
+		msg = fmt.Sprintf("%s\n%s", msg, e.Snippet)
+	}
+	return msg
+}
+
+//Unwrap returns the original error
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+//IsRenderError returns true if the error is a RenderError
+func IsRenderError(err error) bool {
+	_, ok := err.(*RenderError)
+	return ok
+}
+
+//newTemplateError locates a text/template error in the template or in the partial where it is
+func (tp *TemplateProcessor) newTemplateError(templateName string, err error) error {
+	e := &RenderError{
+		Phase:    RenderPhaseTemplate,
+		Template: templateName,
+		File:     templateName,
+		Document: -1,
+		Message:  err.Error(),
+		Err:      err,
+	}
+	//The innermost location is where the error is
+	matches := templateErrorRegexp.FindAllStringSubmatchIndex(err.Error(), -1)
+	if len(matches) == 0 {
+		return e
+	}
+	m := matches[len(matches)-1]
+	msg := err.Error()
+	e.File = msg[m[2]:m[3]]
+	e.Line, _ = strconv.Atoi(msg[m[4]:m[5]])
+	if m[6] >= 0 {
+		e.Column, _ = strconv.Atoi(msg[m[6]:m[7]])
+	}
+	e.Message = msg[m[1]:]
+	source, _ := tp.reader.Asset(e.File)
+	e.Snippet = snippet(source, e.Line)
+	return e
+}
+
+//newDecodeError locates the line of a decode error in the rendered template,
+//offset is the number of lines of the rendered template before the document
+func newDecodeError(templateName string, document int, rendered []byte, offset int, err error) error {
+	e := &RenderError{
+		Phase:    RenderPhaseDecode,
+		Template: templateName,
+		File:     templateName,
+		Document: document,
+		Message:  err.Error(),
+		Err:      err,
+	}
+	if m := yamlErrorRegexp.FindStringSubmatch(err.Error()); m != nil {
+		e.Line, _ = strconv.Atoi(m[1])
+		e.Line += offset
+	}
+	e.Snippet = snippet(rendered, e.Line)
+	return e
+}
+
+//decodeRendered decodes the documents rendered by a template,
+//the decode errors are returned as RenderError
+func (tp *TemplateProcessor) decodeRendered(templateName string, rendered []byte) ([]*unstructured.Unstructured, error) {
+	re, err := regexp.Compile(tp.options.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+	s := string(rendered)
+	delimiters := append(re.FindAllStringIndex(s, -1), []int{len(s), len(s)})
+	us := make([]*unstructured.Unstructured, 0)
+	start := 0
+	for i, delimiter := range delimiters {
+		document := s[start:delimiter[0]]
+		if len(strings.TrimSpace(document)) != 0 {
+			items, err := tp.BytesArrayToUnstructured([][]byte{[]byte(document)})
+			if err != nil {
+				return nil, newDecodeError(templateName, i, rendered, countRune(s[:start], '\n'), err)
+			}
+			us = append(us, items...)
+		}
+		start = delimiter[1]
+	}
+	return us, nil
+}
+
+//snippet returns the numbered lines around the line, the line is marked with a >,
+//all the lines if line is 0 and the source is short
+func snippet(source []byte, line int) string {
+	if len(source) == 0 {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSuffix(string(source), "\n"), "\n")
+	first, last := line-snippetContext, line+snippetContext
+	if line <= 0 {
+		if len(lines) > 2*snippetContext+1 {
+			return ""
+		}
+		first, last = 1, len(lines)
+	}
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	var b strings.Builder
+	for i := first; i <= last; i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "%s %4d | %s\n", marker, i, lines[i-1])
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
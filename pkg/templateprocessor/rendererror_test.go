@@ -0,0 +1,156 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var renderErrorAssets = map[string]string{
+	"errors/_helpers.tpl": `{{- define "name" -}}
+{{ fail "helper failed" }}
+{{- end -}}
+`,
+	"errors/exec.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ fail "exec failed" }}`,
+	"errors/include.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "name" . }}`,
+	"errors/parse.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name`,
+	"errors/decode.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name }}
+   namespace: default`,
+}
+
+func TestTemplateProcessor_RenderError(t *testing.T) {
+	tests := []struct {
+		name         string
+		template     string
+		want         RenderError
+		wantSnippet  string
+		wantInString string
+	}{
+		{
+			name:     "execution",
+			template: "errors/exec.yaml",
+			want: RenderError{
+				Phase:    RenderPhaseTemplate,
+				Template: "errors/exec.yaml",
+				File:     "errors/exec.yaml",
+				Line:     4,
+				Column:   11,
+				Document: -1,
+			},
+			wantSnippet:  ">    4 |   name: {{ fail \"exec failed\" }}",
+			wantInString: "render errors/exec.yaml:4:11: ",
+		},
+		{
+			name:     "in the helpers",
+			template: "errors/include.yaml",
+			want: RenderError{
+				Phase:    RenderPhaseTemplate,
+				Template: "errors/include.yaml",
+				File:     "errors/_helpers.tpl",
+				Line:     2,
+				Column:   3,
+				Document: -1,
+			},
+			wantSnippet:  ">    2 | {{ fail \"helper failed\" }}",
+			wantInString: "render errors/_helpers.tpl:2:3 (included by errors/include.yaml): ",
+		},
+		{
+			name:     "parse",
+			template: "errors/parse.yaml",
+			want: RenderError{
+				Phase:    RenderPhaseTemplate,
+				Template: "errors/parse.yaml",
+				File:     "errors/parse.yaml",
+				Line:     4,
+				Document: -1,
+			},
+			wantSnippet:  ">    4 |   name: {{ .name",
+			wantInString: "render errors/parse.yaml:4: ",
+		},
+		{
+			name:     "decode",
+			template: "errors/decode.yaml",
+			want: RenderError{
+				Phase:    RenderPhaseDecode,
+				Template: "errors/decode.yaml",
+				File:     "errors/decode.yaml",
+				Line:     10,
+				Document: 1,
+			},
+			wantSnippet:  ">   10 |    namespace: default",
+			wantInString: "decode errors/decode.yaml document 1 line 10: ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(renderErrorAssets), nil)
+			if err != nil {
+				t.Fatalf("Unable to create the template processor %s", err.Error())
+			}
+			_, err = tp.TemplateResourcesUnstructured([]string{tt.template}, map[string]interface{}{"name": "second"})
+			if !IsRenderError(err) {
+				t.Fatalf("Expected a RenderError, got %v", err)
+			}
+			got := err.(*RenderError)
+			if got.Phase != tt.want.Phase ||
+				got.Template != tt.want.Template ||
+				got.File != tt.want.File ||
+				got.Line != tt.want.Line ||
+				got.Column != tt.want.Column ||
+				got.Document != tt.want.Document {
+				t.Errorf("Expected %s %s %s:%d:%d document %d, got %s %s %s:%d:%d document %d",
+					tt.want.Phase, tt.want.Template, tt.want.File, tt.want.Line, tt.want.Column, tt.want.Document,
+					got.Phase, got.Template, got.File, got.Line, got.Column, got.Document)
+			}
+			if !strings.Contains(got.Snippet, tt.wantSnippet) {
+				t.Errorf("Expected the snippet to contain %q, got\n%s", tt.wantSnippet, got.Snippet)
+			}
+			if !strings.HasPrefix(err.Error(), tt.wantInString) {
+				t.Errorf("Expected the error to start with %q, got\n%s", tt.wantInString, err.Error())
+			}
+			if errors.Unwrap(err) == nil {
+				t.Errorf("Expected the original error")
+			}
+		})
+	}
+}
+
+func Test_snippet(t *testing.T) {
+	source := []byte("1\n2\n3\n4\n5\n6\n7\n")
+	tests := []struct {
+		name string
+		line int
+		want string
+	}{
+		{name: "middle", line: 4, want: "     2 | 2\n     3 | 3\n>    4 | 4\n     5 | 5\n     6 | 6"},
+		{name: "first", line: 1, want: ">    1 | 1\n     2 | 2\n     3 | 3"},
+		{name: "last", line: 7, want: "     5 | 5\n     6 | 6\n>    7 | 7"},
+		{name: "unknown line of a long source", line: 0, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippet(source, tt.line); got != tt.want {
+				t.Errorf("snippet() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog"
+)
+
+//ScopeResolver defines if a kind is namespaced or cluster-scoped
+type ScopeResolver interface {
+	//IsNamespaced returns true if the kind is namespaced,
+	//an UnknownScopeError is returned if the scope can not be determined.
+	IsNamespaced(gvk schema.GroupVersionKind) (bool, error)
+}
+
+//UnknownScopeError is returned by a ScopeResolver when it doesn't know the kind
+type UnknownScopeError struct {
+	GVK schema.GroupVersionKind
+}
+
+func (e *UnknownScopeError) Error() string {
+	return fmt.Sprintf("Unable to determine if %s is namespaced", e.GVK.String())
+}
+
+//IsUnknownScopeError returns true if the error is an UnknownScopeError
+func IsUnknownScopeError(err error) bool {
+	_, ok := err.(*UnknownScopeError)
+	return ok
+}
+
+//IsNamespaced returns true if the kind is namespaced according to the Options.ScopeResolver,
+//an UnknownScopeError is returned if the scope can not be determined.
+func (tp *TemplateProcessor) IsNamespaced(gvk schema.GroupVersionKind) (bool, error) {
+	return tp.options.ScopeResolver.IsNamespaced(gvk)
+}
+
+//namespacedGroupKinds the scope of the well-known kinds, true if namespaced
+var namespacedGroupKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "Namespace"}:             false,
+	{Group: "", Kind: "Node"}:                  false,
+	{Group: "", Kind: "PersistentVolume"}:      false,
+	{Group: "", Kind: "ConfigMap"}:             true,
+	{Group: "", Kind: "Endpoints"}:             true,
+	{Group: "", Kind: "LimitRange"}:            true,
+	{Group: "", Kind: "PersistentVolumeClaim"}: true,
+	{Group: "", Kind: "Pod"}:                   true,
+	{Group: "", Kind: "ReplicationController"}: true,
+	{Group: "", Kind: "ResourceQuota"}:         true,
+	{Group: "", Kind: "Secret"}:                true,
+	{Group: "", Kind: "Service"}:               true,
+	{Group: "", Kind: "ServiceAccount"}:        true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:   false,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}: false,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:               false,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                           false,
+	{Group: "apps", Kind: "DaemonSet"}:                                              true,
+	{Group: "apps", Kind: "Deployment"}:                                             true,
+	{Group: "apps", Kind: "ReplicaSet"}:                                             true,
+	{Group: "apps", Kind: "StatefulSet"}:                                            true,
+	{Group: "autoscaling", Kind: "HorizontalPodAutoscaler"}:                         true,
+	{Group: "batch", Kind: "CronJob"}:                                               true,
+	{Group: "batch", Kind: "Job"}:                                                   true,
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"}:               false,
+	{Group: "coordination.k8s.io", Kind: "Lease"}:                                   true,
+	{Group: "extensions", Kind: "Ingress"}:                                          true,
+	{Group: "networking.k8s.io", Kind: "Ingress"}:                                   true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                              false,
+	{Group: "networking.k8s.io", Kind: "NetworkPolicy"}:                             true,
+	{Group: "node.k8s.io", Kind: "RuntimeClass"}:                                    false,
+	{Group: "policy", Kind: "PodDisruptionBudget"}:                                  true,
+	{Group: "policy", Kind: "PodSecurityPolicy"}:                                    false,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                       false,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                false,
+	{Group: "rbac.authorization.k8s.io", Kind: "Role"}:                              true,
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}:                       true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                             false,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                    false,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                 false,
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:                             false,
+}
+
+//DefaultScopeResolver is a ScopeResolver which doesn't need a cluster,
+//it knows only the scope of the well-known kubernetes kinds.
+var DefaultScopeResolver ScopeResolver = &staticScopeResolver{}
+
+type staticScopeResolver struct{}
+
+func (*staticScopeResolver) IsNamespaced(gvk schema.GroupVersionKind) (bool, error) {
+	namespaced, ok := namespacedGroupKinds[gvk.GroupKind()]
+	if !ok {
+		return false, &UnknownScopeError{GVK: gvk}
+	}
+	return namespaced, nil
+}
+
+//discoveryScopeResolver is a ScopeResolver which uses the discovery API
+type discoveryScopeResolver struct {
+	discovery discovery.DiscoveryInterface
+	mutex     sync.Mutex
+	//cache of the namespaced flag by group version and kind
+	cache map[schema.GroupVersion]map[string]bool
+}
+
+//NewDiscoveryScopeResolver returns a ScopeResolver which uses the discovery API
+//to determine if a kind is namespaced. The discovery responses are cached by group version.
+//discovery: The discovery client, for example kubernetes.Interface.Discovery()
+func NewDiscoveryScopeResolver(discovery discovery.DiscoveryInterface) ScopeResolver {
+	return &discoveryScopeResolver{
+		discovery: discovery,
+		cache:     make(map[schema.GroupVersion]map[string]bool),
+	}
+}
+
+func (r *discoveryScopeResolver) IsNamespaced(gvk schema.GroupVersionKind) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	gv := gvk.GroupVersion()
+	kinds, ok := r.cache[gv]
+	if !ok {
+		klog.V(5).Infof("Discover resources for %s", gv.String())
+		resources, err := r.discovery.ServerResourcesForGroupVersion(gv.String())
+		if err != nil {
+			return false, err
+		}
+		kinds = make(map[string]bool)
+		for _, resource := range resources.APIResources {
+			kinds[resource.Kind] = resource.Namespaced
+		}
+		r.cache[gv] = kinds
+	}
+	namespaced, ok := kinds[gvk.Kind]
+	if !ok {
+		return false, &UnknownScopeError{GVK: gvk}
+	}
+	return namespaced, nil
+}
@@ -0,0 +1,92 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestScopeResolvers(t *testing.T) {
+	kubeClient := fakekubeclient.NewSimpleClientset()
+	kubeClient.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "example.com/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "namespacedcrs", Kind: "NamespacedCR", Namespaced: true},
+				{Name: "clustercrs", Kind: "ClusterCR", Namespaced: false},
+			},
+		},
+	}
+	discoveryResolver := NewDiscoveryScopeResolver(kubeClient.Discovery())
+	tests := []struct {
+		name           string
+		resolver       ScopeResolver
+		gvk            schema.GroupVersionKind
+		wantNamespaced bool
+		wantUnknown    bool
+		wantErr        bool
+	}{
+		{
+			name:           "default namespaced",
+			resolver:       DefaultScopeResolver,
+			gvk:            schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			wantNamespaced: true,
+		},
+		{
+			name:     "default cluster-scoped",
+			resolver: DefaultScopeResolver,
+			gvk:      schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+		},
+		{
+			name:        "default unknown",
+			resolver:    DefaultScopeResolver,
+			gvk:         schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "NamespacedCR"},
+			wantUnknown: true,
+			wantErr:     true,
+		},
+		{
+			name:           "discovery namespaced",
+			resolver:       discoveryResolver,
+			gvk:            schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "NamespacedCR"},
+			wantNamespaced: true,
+		},
+		{
+			name:     "discovery cluster-scoped",
+			resolver: discoveryResolver,
+			gvk:      schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "ClusterCR"},
+		},
+		{
+			name:        "discovery unknown kind",
+			resolver:    discoveryResolver,
+			gvk:         schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Other"},
+			wantUnknown: true,
+			wantErr:     true,
+		},
+		{
+			name:     "discovery unknown group",
+			resolver: discoveryResolver,
+			gvk:      schema.GroupVersionKind{Group: "other.com", Version: "v1", Kind: "Other"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.resolver.IsNamespaced(tt.gvk)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IsNamespaced() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if IsUnknownScopeError(err) != tt.wantUnknown {
+				t.Errorf("IsUnknownScopeError() = %v, want %v", IsUnknownScopeError(err), tt.wantUnknown)
+			}
+			if got != tt.wantNamespaced {
+				t.Errorf("IsNamespaced() = %v, want %v", got, tt.wantNamespaced)
+			}
+		})
+	}
+}
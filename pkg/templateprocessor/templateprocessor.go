@@ -10,13 +10,16 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/ghodss/yaml"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const copyright = `# Copyright Contributors to the Open Cluster Management project
@@ -50,6 +53,23 @@ type TemplateReader interface {
 	ToJSON(b []byte) ([]byte, error)
 }
 
+//Validator validates the rendered resources before they are returned or applied
+type Validator interface {
+	//Validate returns an error if the rendered resources are not valid
+	Validate(us []*unstructured.Unstructured) error
+}
+
+//Sources maps each rendered resource to the template it was rendered from
+type Sources map[*unstructured.Unstructured]string
+
+//SourceValidator is a Validator which also receives the templates the resources were rendered from,
+//the sources are only known when the resources are rendered by TemplateResourcesUnstructured.
+type SourceValidator interface {
+	Validator
+	//ValidateSources returns an error if the rendered resources are not valid
+	ValidateSources(us []*unstructured.Unstructured, sources Sources) error
+}
+
 //Options defines for the available options for the templateProcessor
 type Options struct {
 	KindsOrder      SortType
@@ -59,6 +79,43 @@ type Options struct {
 	CreateUpdateKindsOrder KindsOrder
 	DeleteKindsOrder       KindsOrder
 	MissingKeyType         MissingKeyType
+	//Labels added to every rendered resource and to the pod template of the workloads,
+	//the labels which are part of a workload selector are not added to its pod template.
+	CommonLabels map[string]string
+	//Annotations added to every rendered resource and to the pod template of the workloads.
+	CommonAnnotations map[string]string
+	//The namespace set on the namespaced rendered resources which don't have a namespace.
+	Namespace string
+	//If true, the Namespace replaces the namespace of the namespaced rendered resources.
+	OverrideNamespace bool
+	//Defines which kinds are namespaced, DefaultScopeResolver is used if not set.
+	//The scope of the custom resources defined by a CRD in the rendered resources is taken from the CRD.
+	ScopeResolver ScopeResolver
+	//Defines how the container images of the rendered resources are rewritten, no rewrite if nil.
+	ImageRewrite *ImageRewriteConfig
+	//Called for each rewritten image
+	OnImageRewrite func(rewrite ImageRewrite)
+	//The validators run on the rendered resources after the transformations
+	Validators []Validator
+	//The JSON schema, in json or yaml, the values are validated against before rendering,
+	//if not set the ValuesSchemaFileName of the templates directory or of its parents is used if any.
+	ValuesSchema []byte
+	//If true, the defaults of the values schema are set on the missing values,
+	//the values must be a map and are copied before.
+	ApplyValuesDefaults bool
+	//The client used by the lookup and lookupList template functions to read the existing objects,
+	//the functions return empty results if not set.
+	LookupClient client.Reader
+	//The capabilities of the cluster added to the map values as CapabilitiesValuesKey,
+	//and the default capabilities of the charts. Not added if nil.
+	Capabilities *Capabilities
+	//The number of templates rendered and decoded concurrently by the unstructured methods,
+	//the templates are rendered one after the other if lower than 2.
+	//The errors of all the templates are then returned in an aggregated error.
+	Concurrency int
+	//The directory of the partials shared by all the templates, the .tpl files of the directory
+	//and of its subdirectories are parsed with each template, before the _*.tpl files of the template directories.
+	PartialsPath string
 }
 
 //SortType ...
@@ -192,6 +249,9 @@ func NewTemplateProcessor(
 	if options.MissingKeyType == "" {
 		options.MissingKeyType = MissingKeyTypeZero
 	}
+	if options.ScopeResolver == nil {
+		options.ScopeResolver = DefaultScopeResolver
+	}
 	re, err := regexp.Compile(options.Delimiter)
 	if err != nil {
 		return nil, err
@@ -225,9 +285,17 @@ func (tp *TemplateProcessor) TemplateResources(
 	templateNames []string,
 	values interface{},
 ) ([][]byte, error) {
+	values, err := tp.prepareValues(commonDir(templateNames), values)
+	if err != nil {
+		return nil, err
+	}
+	p, err := tp.newPartials()
+	if err != nil {
+		return nil, err
+	}
 	results := make([][]byte, 0)
 	for _, templateName := range templateNames {
-		result, err := tp.TemplateResource(templateName, values)
+		result, err := tp.templateResource(p, templateName, values)
 		if err != nil {
 			return nil, err
 		}
@@ -242,26 +310,61 @@ func (tp *TemplateProcessor) TemplateResources(
 func (tp *TemplateProcessor) TemplateResource(
 	templateName string,
 	values interface{},
+) ([]byte, error) {
+	values, err := tp.prepareValues(filepath.Dir(templateName), values)
+	if err != nil {
+		return nil, err
+	}
+	p, err := tp.newPartials()
+	if err != nil {
+		return nil, err
+	}
+	return tp.templateResource(p, templateName, values)
+}
+
+func (tp *TemplateProcessor) templateResource(
+	p *partials,
+	templateName string,
+	values interface{},
 ) ([]byte, error) {
 	klog.V(5).Infof("templateName: %s", templateName)
-	if filepath.Base(templateName) == "_helpers.tpl" {
+	tmpl, err := tp.parseTemplate(p, templateName)
+	if err != nil || tmpl == nil {
+		return nil, err
+	}
+	templated, err := executeTemplate(tmpl, values)
+	if err != nil {
+		return nil, tp.newTemplateError(templateName, err)
+	}
+	return templated, nil
+}
+
+//parseTemplate parses a template with the partials available to it,
+//it returns a nil template for the files which are not templates
+func (tp *TemplateProcessor) parseTemplate(p *partials, templateName string) (*template.Template, error) {
+	if tp.isPartial(templateName) || filepath.Base(templateName) == ValuesSchemaFileName {
 		return nil, nil
 	}
-	h, _ := tp.reader.Asset(filepath.Join(filepath.Dir(templateName), "_helpers.tpl"))
 	b, err := tp.reader.Asset(templateName)
 	if err != nil {
 		return nil, err
 	}
 	klog.V(5).Infof("\nb--->\n%s\n---", string(b))
-	t := append(h, b[:]...)
-	klog.V(5).Infof("\nh+b--->\n%s\n---", string(t))
 	tmpl := tp.getTemplate(templateName)
-	templated, err := tp.TemplateBytes(tmpl, t, values)
-	if err != nil && len(h) > 0 {
-		n := countRune(string(h), '\n')
-		err = fmt.Errorf("%s first line is line #%d as a _helpers.tpl file is present", err, n)
+	nodes, vars, err := p.parse(tp, tmpl, templateName)
+	if err != nil {
+		return nil, tp.newTemplateError(templateName, err)
 	}
-	return templated, err
+	tmpl, err = parseWithVariables(tmpl, string(b), vars)
+	if err != nil {
+		return nil, tp.newTemplateError(templateName, err)
+	}
+	//The text of the partials outside of their define blocks is rendered before the template,
+	//its nodes keep the location of the partial
+	if tmpl.Tree != nil {
+		tmpl.Tree.Root.Nodes = append(nodes, tmpl.Tree.Root.Nodes...)
+	}
+	return tmpl, nil
 }
 
 func (tp *TemplateProcessor) getTemplate(templateName string) *template.Template {
@@ -269,7 +372,8 @@ func (tp *TemplateProcessor) getTemplate(templateName string) *template.Template
 		Option(string(tp.options.MissingKeyType)).
 		Funcs(ApplierFuncMap())
 	tmpl = tmpl.Funcs(TemplateFuncMap(tmpl)).
-		Funcs(sprig.TxtFuncMap())
+		Funcs(sprig.TxtFuncMap()).
+		Funcs(tp.lookupFuncMap())
 	return tmpl
 }
 
@@ -289,13 +393,17 @@ func (tp *TemplateProcessor) TemplateBytes(
 	b []byte,
 	values interface{},
 ) ([]byte, error) {
-	var buf bytes.Buffer
 	tmpl, err := tmpl.Parse(string(b))
 	if err != nil {
 		return nil, err
 	}
+	return executeTemplate(tmpl, values)
+}
 
-	err = tmpl.Execute(&buf, values)
+//executeTemplate renders a parsed template, nil is returned if the result is empty
+func executeTemplate(tmpl *template.Template, values interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, values)
 	if err != nil {
 		return nil, err
 	}
@@ -331,6 +439,25 @@ func (tp *TemplateProcessor) TemplateResourcesInPathYaml(
 	return yamls, nil
 }
 
+// TemplateResourcesInPathYamlList returns all assets in a path packed in a single v1/List yaml.
+// The resources are sorted following the order defined in variable kindsOrder
+func (tp *TemplateProcessor) TemplateResourcesInPathYamlList(
+	path string,
+	excluded []string,
+	recursive bool,
+	values interface{},
+) ([]byte, error) {
+	us, err := tp.TemplateResourcesInPathUnstructured(path, excluded, recursive, values)
+	if err != nil {
+		return nil, err
+	}
+	y, err := ToYAMLListUnstructured(us)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(copyright), y...), nil
+}
+
 //ToYAMLsUnstructured converts []*unstructured.Unstructured to [][]byte yaml format
 func ToYAMLsUnstructured(us []*unstructured.Unstructured) ([][]byte, error) {
 	results := make([][]byte, len(us))
@@ -377,7 +504,7 @@ func (tp *TemplateProcessor) AssetNamesInPath(
 	}
 	klog.V(5).Infof("names: %v", names)
 	for _, name := range names {
-		if isExcluded(name, excluded) {
+		if isExcluded(name, excluded) || filepath.Base(name) == ValuesSchemaFileName {
 			continue
 		}
 		klog.V(5).Infof("filepath.Dir(%s)=%s", name, filepath.Dir(name))
@@ -442,7 +569,15 @@ func (tp *TemplateProcessor) TemplateResourcesInPathUnstructured(
 		return nil, err
 	}
 	klog.V(5).Infof("templateNames: %v", templateNames)
-	us, err = tp.TemplateResourcesUnstructured(templateNames, values)
+	dir := path
+	if _, err := tp.reader.Asset(path); err == nil {
+		dir = filepath.Dir(path)
+	}
+	values, err = tp.prepareValues(dir, values)
+	if err != nil {
+		return nil, err
+	}
+	us, err = tp.templateResourcesUnstructured(templateNames, values)
 	if err != nil {
 		return nil, err
 	}
@@ -454,11 +589,50 @@ func (tp *TemplateProcessor) TemplateResourcesInPathUnstructured(
 func (tp *TemplateProcessor) TemplateResourcesUnstructured(
 	templateNames []string,
 	values interface{}) (us []*unstructured.Unstructured, err error) {
-	templatedAssets, err := tp.TemplateResources(templateNames, values)
+	values, err = tp.prepareValues(commonDir(templateNames), values)
+	if err != nil {
+		return nil, err
+	}
+	return tp.templateResourcesUnstructured(templateNames, values)
+}
+
+func (tp *TemplateProcessor) templateResourcesUnstructured(
+	templateNames []string,
+	values interface{}) (us []*unstructured.Unstructured, err error) {
+	p, err := tp.newPartials()
 	if err != nil {
 		return nil, err
 	}
-	us, err = tp.BytesArrayToUnstructured(templatedAssets)
+	return tp.renderUnstructured(templateNames, func(templateName string) ([]byte, error) {
+		return tp.templateResource(p, templateName, values)
+	})
+}
+
+//TemplateResourcesUnstructuredInOrder returns all assets in a []unstructured.Unstructured
+//like TemplateResourcesUnstructured but the resources are not sorted and returned
+//in the same template provided order
+func (tp *TemplateProcessor) TemplateResourcesUnstructuredInOrder(
+	templateNames []string,
+	values interface{}) (us []*unstructured.Unstructured, err error) {
+	values, err = tp.prepareValues(commonDir(templateNames), values)
+	if err != nil {
+		return nil, err
+	}
+	p, err := tp.newPartials()
+	if err != nil {
+		return nil, err
+	}
+	return tp.renderUnsortedUnstructured(templateNames, func(templateName string) ([]byte, error) {
+		return tp.templateResource(p, templateName, values)
+	})
+}
+
+//renderUnstructured decodes the templates rendered by render, post-renders and sorts the resources
+func (tp *TemplateProcessor) renderUnstructured(
+	templateNames []string,
+	render func(templateName string) ([]byte, error),
+) ([]*unstructured.Unstructured, error) {
+	us, err := tp.renderUnsortedUnstructured(templateNames, render)
 	if err != nil {
 		return nil, err
 	}
@@ -469,7 +643,119 @@ func (tp *TemplateProcessor) TemplateResourcesUnstructured(
 	return us, nil
 }
 
+//renderUnsortedUnstructured decodes the templates rendered by render and post-renders the resources
+func (tp *TemplateProcessor) renderUnsortedUnstructured(
+	templateNames []string,
+	render func(templateName string) ([]byte, error),
+) ([]*unstructured.Unstructured, error) {
+	results, err := tp.renderTemplates(templateNames, render)
+	if err != nil {
+		return nil, err
+	}
+	us := make([]*unstructured.Unstructured, 0)
+	sources := make(Sources)
+	for i, items := range results {
+		for _, u := range items {
+			sources[u] = templateNames[i]
+		}
+		us = append(us, items...)
+	}
+	err = tp.postRender(us, sources)
+	if err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+//renderTemplates renders and decodes each template, the results are in the order of the templateNames.
+//With Options.Concurrency the templates are rendered by a pool of workers and the errors are aggregated.
+func (tp *TemplateProcessor) renderTemplates(
+	templateNames []string,
+	render func(templateName string) ([]byte, error),
+) ([][]*unstructured.Unstructured, error) {
+	results := make([][]*unstructured.Unstructured, len(templateNames))
+	renderDecode := func(i int) (err error) {
+		templatedAsset, err := render(templateNames[i])
+		if err != nil || templatedAsset == nil {
+			return err
+		}
+		results[i], err = tp.decodeRendered(templateNames[i], templatedAsset)
+		return err
+	}
+	workers := tp.options.Concurrency
+	if workers > len(templateNames) {
+		workers = len(templateNames)
+	}
+	if workers < 2 {
+		for i := range templateNames {
+			if err := renderDecode(i); err != nil {
+				return nil, err
+			}
+		}
+		return results, nil
+	}
+	errs := make([]error, len(templateNames))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = renderDecode(i)
+			}
+		}()
+	}
+	for i := range templateNames {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	err := utilerrors.Reduce(utilerrors.NewAggregate(errs))
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+//PostRender applies on the rendered resources the transformations defined in the options
+//and then runs the validators,
+//it is called by TemplateResourcesUnstructured and must be called on resources decoded
+//with BytesArrayToUnstructured or BytesToUnstructured if the transformations are needed.
+//The transformations are applied in place on the items of the kubernetes lists.
+func (tp *TemplateProcessor) PostRender(us []*unstructured.Unstructured) error {
+	return tp.postRender(us, nil)
+}
+
+func (tp *TemplateProcessor) postRender(us []*unstructured.Unstructured, sources Sources) error {
+	items := make([]*unstructured.Unstructured, 0, len(us))
+	for _, u := range us {
+		children, err := ExpandList(u)
+		if err != nil {
+			return err
+		}
+		items = append(items, children...)
+	}
+	err := tp.injectMetadata(items)
+	if err != nil {
+		return err
+	}
+	tp.rewriteImages(items)
+	for _, v := range tp.options.Validators {
+		if sv, ok := v.(SourceValidator); ok {
+			err = sv.ValidateSources(items, sources)
+		} else {
+			err = v.Validate(items)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //BytesArrayToUnstructured transform a [][]byte to an []*unstructured.Unstructured using the TemplateProcessor reader
+//The kubernetes lists (ie: v1/List, SecretList...) are expanded into their items.
 func (tp *TemplateProcessor) BytesArrayToUnstructured(assets [][]byte) (us []*unstructured.Unstructured, err error) {
 	us = make([]*unstructured.Unstructured, 0)
 	for _, b := range assets {
@@ -481,7 +767,11 @@ func (tp *TemplateProcessor) BytesArrayToUnstructured(assets [][]byte) (us []*un
 				return nil, err
 			}
 			if u.Object != nil {
-				us = append(us, u)
+				items, err := ExpandList(u)
+				if err != nil {
+					return nil, err
+				}
+				us = append(us, items...)
 			}
 		}
 	}
@@ -3,10 +3,13 @@
 package templateprocessor
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 var assetsB = []byte(`---
@@ -502,6 +505,94 @@ func TestTemplateProcessor_helpertpl(t *testing.T) {
 	}
 }
 
+func TestTemplateProcessor_helpertplFile(t *testing.T) {
+	tpr := NewYamlFileReader("../../test/unit/resources/templates/withhelpers/test.yaml")
+	tp, err := NewTemplateProcessor(tpr, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]interface{}{
+		"Values": map[string]string{
+			"name": "TestTemplateProcessor_helpertplFile",
+		},
+	}
+	us, err := tp.TemplateResourcesInPathUnstructured("test.yaml", nil, false, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 1 || us[0].GetName() != "Test" {
+		t.Errorf("Expecting a single resource named 'Test' got: %v", us)
+	}
+	b, err := tp.TemplateResource("test.yaml", values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(string(b)), "name: Test") {
+		t.Errorf("Expecting the name 'Test' got: %s", string(b))
+	}
+}
+
+func TestTemplateProcessor_helpertplTopLevelText(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(map[string]string{
+		"_helpers.tpl": `{{- $name := printf "%s-app" .name -}}
+{{- define "name" -}}helper{{- end -}}`,
+		"app/_labels.tpl": `{{- $team := printf "%s-team" $name -}}`,
+		"app/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ $name }}
+data:
+  helper: {{ include "name" . }}
+  team: {{ $team }}`,
+		"app/failing.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ $name }}
+data:
+  value: {{ fail "failed" }}`,
+	}), &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tp.TemplateResource("app/cm.yaml", map[string]interface{}{"name": "my"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//The text of the partials outside of their define blocks is rendered before the template,
+	//the variables it declares are available to the template
+	want := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-app
+data:
+  helper: helper
+  team: my-app-team`
+	if string(b) != want {
+		t.Errorf("Expecting\n%s\ngot\n%s", want, string(b))
+	}
+	//The compiled templates render the same text
+	bundle, err := tp.CompileInPath("app/cm.yaml", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := bundle.TemplateResources(map[string]interface{}{"name": "my"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compiled) != 1 || string(compiled[0]) != want {
+		t.Errorf("Expecting the compiled template to render\n%s\ngot\n%q", want, compiled)
+	}
+	//The errors are located in the template
+	_, err = tp.TemplateResource("app/failing.yaml", map[string]interface{}{"name": "my"})
+	renderErr, ok := err.(*RenderError)
+	if !ok {
+		t.Fatalf("Expecting a RenderError, got %v", err)
+	}
+	if renderErr.File != "app/failing.yaml" || renderErr.Line != 6 {
+		t.Errorf("Expecting the error at app/failing.yaml:6, got %s:%d", renderErr.File, renderErr.Line)
+	}
+}
+
 func TestTemplateProcessor_BytesToUnstructured(t *testing.T) {
 	var asset = []byte(``)
 	tpr := NewYamlStringReader(string(asset), KubernetesYamlsDelimiter)
@@ -656,3 +747,60 @@ metadata:
 		})
 	}
 }
+
+func TestTemplateProcessor_Concurrency(t *testing.T) {
+	assets := make(map[string]string)
+	templateNames := make([]string, 0)
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("concurrency/cm-%02d.yaml", i)
+		assets[name] = fmt.Sprintf(`apiVersion: v1
+kind: {{ if eq (mod %[1]d 3) 0 }}Secret{{ else }}ConfigMap{{ end }}
+metadata:
+  name: {{ .name }}-%[1]d
+  namespace: default
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{ .name }}-%[1]d
+  namespace: default`, i)
+		templateNames = append(templateNames, name)
+	}
+	assets["concurrency/fail-1.yaml"] = `{{ if .fail }}{{ fail "first" }}{{ end }}`
+	assets["concurrency/fail-2.yaml"] = `{{ if .fail }}{{ fail "second" }}{{ end }}`
+	templateNames = append(templateNames, "concurrency/fail-1.yaml", "concurrency/fail-2.yaml")
+	serial, err := NewTemplateProcessor(NewTestReader(assets), nil)
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	concurrent, err := NewTemplateProcessor(NewTestReader(assets), &Options{Concurrency: 8})
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	values := map[string]interface{}{"name": "app"}
+	want, err := serial.TemplateResourcesUnstructured(templateNames, values)
+	if err != nil {
+		t.Fatalf("Unable to render %s", err.Error())
+	}
+	got, err := concurrent.TemplateResourcesUnstructured(templateNames, values)
+	if err != nil {
+		t.Fatalf("Unable to render concurrently %s", err.Error())
+	}
+	if len(got) != 100 || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the resources rendered one after the other, got %v", got)
+	}
+	_, err = concurrent.TemplateResourcesUnstructured(templateNames, map[string]interface{}{"name": "app", "fail": true})
+	agg, ok := err.(utilerrors.Aggregate)
+	if !ok || len(agg.Errors()) != 2 {
+		t.Fatalf("Expected the 2 errors aggregated, got %v", err)
+	}
+	for i, templateName := range []string{"concurrency/fail-1.yaml", "concurrency/fail-2.yaml"} {
+		if !IsRenderError(agg.Errors()[i]) || agg.Errors()[i].(*RenderError).Template != templateName {
+			t.Errorf("Expected a RenderError for %s, got %v", templateName, agg.Errors()[i])
+		}
+	}
+	_, err = concurrent.TemplateResourcesUnstructured(templateNames[:51], map[string]interface{}{"name": "app", "fail": true})
+	if !IsRenderError(err) {
+		t.Errorf("Expected a single error not aggregated, got %v", err)
+	}
+}
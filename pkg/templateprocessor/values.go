@@ -0,0 +1,182 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/stolostron/library-go/pkg/internal/jsonschema"
+	"k8s.io/klog"
+)
+
+//ValuesSchemaFileName is the name of the JSON schema of the values shipped with the templates,
+//it is searched in the directory of the templates and its parents.
+const ValuesSchemaFileName = "values.schema.json"
+
+//ValuesViolation is a value which doesn't match the values schema
+type ValuesViolation struct {
+	//The JSON path of the value, for example $.image.tag
+	Path    string
+	Message string
+}
+
+func (v ValuesViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+//ValuesError is returned when the values don't match the values schema
+type ValuesError struct {
+	Violations []ValuesViolation
+}
+
+func (e *ValuesError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return fmt.Sprintf("invalid values:\n%s", strings.Join(violations, "\n"))
+}
+
+//IsValuesError returns true if the error is a ValuesError
+func IsValuesError(err error) bool {
+	_, ok := err.(*ValuesError)
+	return ok
+}
+
+//prepareValues validates the values against the values schema of the templates of dir,
+//applies the defaults of the schema if Options.ApplyValuesDefaults is set
+//and adds the Options.Capabilities to the values if set
+func (tp *TemplateProcessor) prepareValues(dir string, values interface{}) (interface{}, error) {
+	b, source := tp.options.ValuesSchema, "options"
+	if b == nil {
+		b, source = tp.findValuesSchema(dir)
+	}
+	if b != nil {
+		var err error
+		values, err = tp.applyValuesSchema(b, source, values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tp.injectCapabilities(values), nil
+}
+
+//applyValuesSchema applies the defaults of the schema if Options.ApplyValuesDefaults is set
+//and validates the values against the schema
+func (tp *TemplateProcessor) applyValuesSchema(b []byte, source string, values interface{}) (interface{}, error) {
+	klog.V(5).Infof("Validate the values with the schema from %s", source)
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid values schema %s: %s", source, err)
+	}
+	var schema interface{}
+	err = json.Unmarshal(j, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid values schema %s: %s", source, err)
+	}
+	if tp.options.ApplyValuesDefaults {
+		if m, ok := toStringMap(values); ok {
+			m = deepCopyValues(m).(map[string]interface{})
+			jsonschema.ApplyDefaults(m, schema, schema)
+			values = m
+		} else if values != nil {
+			klog.V(2).Infof("The defaults of the values schema are only applied on map values, not on %T", values)
+		}
+	}
+	generic, err := toGenericValues(values)
+	if err != nil {
+		return nil, err
+	}
+	v := &jsonschema.Validator{Root: schema}
+	violations := v.Validate(generic, schema, "$")
+	if len(violations) != 0 {
+		e := &ValuesError{Violations: make([]ValuesViolation, len(violations))}
+		for i, violation := range violations {
+			e.Violations[i] = ValuesViolation{Path: violation.Path, Message: violation.Message}
+		}
+		return nil, e
+	}
+	return values, nil
+}
+
+//findValuesSchema returns the first ValuesSchemaFileName found in dir or its parents
+func (tp *TemplateProcessor) findValuesSchema(dir string) ([]byte, string) {
+	dir = filepath.Clean(dir)
+	for {
+		name := filepath.Join(dir, ValuesSchemaFileName)
+		if b, err := tp.reader.Asset(name); err == nil {
+			return b, name
+		}
+		if dir == "." || dir == string(filepath.Separator) || filepath.Dir(dir) == dir {
+			return nil, ""
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+//commonDir returns the deepest directory containing all the templates
+func commonDir(templateNames []string) string {
+	if len(templateNames) == 0 {
+		return "."
+	}
+	dir := filepath.Dir(templateNames[0])
+	for _, name := range templateNames[1:] {
+		for dir != "." && dir != string(filepath.Separator) &&
+			!strings.HasPrefix(filepath.Dir(name)+string(filepath.Separator), dir+string(filepath.Separator)) {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
+
+//toStringMap returns the values as a map[string]interface{} if they are a map of this kind
+func toStringMap(values interface{}) (map[string]interface{}, bool) {
+	if m, ok := values.(map[string]interface{}); ok {
+		return m, true
+	}
+	t := reflect.TypeOf(map[string]interface{}{})
+	v := reflect.ValueOf(values)
+	if !v.IsValid() || !v.Type().ConvertibleTo(t) {
+		return nil, false
+	}
+	return v.Convert(t).Interface().(map[string]interface{}), true
+}
+
+//toGenericValues converts the values in their JSON representation
+func toGenericValues(values interface{}) (interface{}, error) {
+	if values == nil {
+		return map[string]interface{}{}, nil
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to validate the values: %s", err)
+	}
+	var generic interface{}
+	err = json.Unmarshal(b, &generic)
+	return generic, err
+}
+
+//deepCopyValues copies the maps and slices of the values, the other values are shared
+func deepCopyValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = deepCopyValues(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = deepCopyValues(e)
+		}
+		return l
+	default:
+		return value
+	}
+}
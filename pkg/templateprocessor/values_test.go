@@ -0,0 +1,178 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package templateprocessor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var valuesAssets = map[string]string{
+	"values/values.schema.json": `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["name"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string", "pattern": "^[a-z][a-z0-9-]*$"},
+    "replicas": {"type": "integer", "minimum": 1, "default": 1},
+    "image": {"$ref": "#/definitions/image"},
+    "ports": {"type": "array", "items": {"type": "integer"}, "maxItems": 2},
+    "pullPolicy": {"enum": ["Always", "IfNotPresent"]}
+  },
+  "definitions": {
+    "image": {
+      "type": "object",
+      "properties": {
+        "repository": {"type": "string", "default": "quay.io/app"},
+        "tag": {"type": ["string", "null"], "default": "latest"}
+      }
+    }
+  }
+}`,
+	"values/configmap.yaml": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name }}
+  namespace: default
+data:
+  replicas: "{{ .replicas }}"
+  image: "{{ .image.repository }}:{{ .image.tag }}"`,
+}
+
+func TestTemplateProcessor_ValuesSchema(t *testing.T) {
+	tests := []struct {
+		name           string
+		options        *Options
+		values         interface{}
+		wantData       map[string]interface{}
+		wantViolations []ValuesViolation
+	}{
+		{
+			name:   "valid",
+			values: map[string]interface{}{"name": "app", "replicas": 2, "image": map[string]interface{}{"repository": "r", "tag": "1.0"}},
+			wantData: map[string]interface{}{
+				"replicas": "2",
+				"image":    "r:1.0",
+			},
+		},
+		{
+			name:    "defaults",
+			options: &Options{ApplyValuesDefaults: true},
+			values:  map[string]interface{}{"name": "app", "image": map[string]interface{}{"tag": "1.0"}},
+			wantData: map[string]interface{}{
+				"replicas": "1",
+				"image":    "quay.io/app:1.0",
+			},
+		},
+		{
+			name:    "defaults of a missing object",
+			options: &Options{ApplyValuesDefaults: true},
+			values:  map[string]interface{}{"name": "app"},
+			wantData: map[string]interface{}{
+				"replicas": "1",
+				"image":    "quay.io/app:latest",
+			},
+		},
+		{
+			name: "violations",
+			values: map[string]interface{}{
+				"name":       "App",
+				"replicas":   1.5,
+				"image":      map[string]interface{}{"tag": 1},
+				"ports":      []interface{}{80, "443", 8080},
+				"pullPolicy": "Never",
+				"replica":    2,
+			},
+			wantViolations: []ValuesViolation{
+				{Path: "$.image.tag", Message: "expected a string or null, got a number"},
+				{Path: "$.name", Message: "must match the pattern ^[a-z][a-z0-9-]*$"},
+				{Path: "$.ports", Message: "must have at most 2 items"},
+				{Path: "$.ports[1]", Message: "expected an integer, got a string"},
+				{Path: "$.pullPolicy", Message: "unsupported value Never, must be one of [Always IfNotPresent]"},
+				{Path: "$.replica", Message: "unknown field"},
+				{Path: "$.replicas", Message: "expected an integer, got a number"},
+			},
+		},
+		{
+			name:   "missing required",
+			values: nil,
+			wantViolations: []ValuesViolation{
+				{Path: "$.name", Message: "required field is missing"},
+			},
+		},
+		{
+			name:    "schema from the options",
+			options: &Options{ValuesSchema: []byte("type: object\nrequired:\n- version\n")},
+			values:  map[string]interface{}{"name": "app"},
+			wantViolations: []ValuesViolation{
+				{Path: "$.version", Message: "required field is missing"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := NewTemplateProcessor(NewTestReader(valuesAssets), tt.options)
+			if err != nil {
+				t.Fatalf("Unable to create the template processor %s", err.Error())
+			}
+			us, err := tp.TemplateResourcesInPathUnstructured("values", nil, false, tt.values)
+			if tt.wantViolations != nil {
+				if !IsValuesError(err) {
+					t.Fatalf("Expected a ValuesError, got %v", err)
+				}
+				if !reflect.DeepEqual(err.(*ValuesError).Violations, tt.wantViolations) {
+					t.Errorf("Expected violations:\n%v\ngot:\n%v", tt.wantViolations, err.(*ValuesError).Violations)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unable to render %s", err.Error())
+			}
+			if len(us) != 1 {
+				t.Fatalf("Expected 1 resource, got %d", len(us))
+			}
+			if !reflect.DeepEqual(us[0].Object["data"], tt.wantData) {
+				t.Errorf("Expected data %v, got %v", tt.wantData, us[0].Object["data"])
+			}
+		})
+	}
+}
+
+func TestTemplateProcessor_ValuesSchema_DoesNotModifyValues(t *testing.T) {
+	tp, err := NewTemplateProcessor(NewTestReader(valuesAssets), &Options{ApplyValuesDefaults: true})
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	values := map[string]interface{}{"name": "app", "image": map[string]interface{}{}}
+	_, err = tp.TemplateResources([]string{"values/configmap.yaml"}, values)
+	if err != nil {
+		t.Fatalf("Unable to render %s", err.Error())
+	}
+	want := map[string]interface{}{"name": "app", "image": map[string]interface{}{}}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("Expected the values unchanged %v, got %v", want, values)
+	}
+}
+
+func Test_commonDir(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{names: nil, want: "."},
+		{names: []string{"a/b/x.yaml"}, want: "a/b"},
+		{names: []string{"a/b/x.yaml", "a/c/y.yaml"}, want: "a"},
+		{names: []string{"a/b/x.yaml", "ab/y.yaml"}, want: "."},
+		{names: []string{"a/b/x.yaml", "a/b/c/y.yaml"}, want: "a/b"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.names, ","), func(t *testing.T) {
+			if got := commonDir(tt.names); got != tt.want {
+				t.Errorf("commonDir() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
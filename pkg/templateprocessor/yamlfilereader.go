@@ -3,6 +3,8 @@
 package templateprocessor
 
 import (
+	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -17,7 +19,7 @@ type YamlFileReader struct {
 	fileName string
 }
 
-var _ TemplateReader = &YamlFileReader{
+var _ VersionedReader = &YamlFileReader{
 	path:     "",
 	fileName: "",
 }
@@ -47,15 +49,36 @@ func (r *YamlFileReader) AssetNames() ([]string, error) {
 			return nil
 		})
 	} else {
-		helpersFile := filepath.Join(filepath.Base(r.path), "_helpers.tpl")
-		if _, err := os.Stat(helpersFile); err == nil {
-			keys = append(keys, "_helpers.tpl")
+		//The partials of the directory are available to the file
+		var files []os.FileInfo
+		files, err = ioutil.ReadDir(r.path)
+		for _, f := range files {
+			if !f.IsDir() && IsPartial(f.Name()) && f.Name() != r.fileName {
+				keys = append(keys, f.Name())
+			}
 		}
 		keys = append(keys, r.fileName)
 	}
 	return keys, err
 }
 
+//AssetsVersion returns a hash of the names, sizes and modification times of the assets
+func (r *YamlFileReader) AssetsVersion() (string, error) {
+	names, err := r.AssetNames()
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	for _, name := range names {
+		fi, err := os.Stat(filepath.Join(r.path, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s:%d:%d\n", name, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return fmt.Sprintf("%x", h.Sum64()), nil
+}
+
 //ToJSON converts to JSON
 func (*YamlFileReader) ToJSON(
 	b []byte,
@@ -3,6 +3,9 @@
 package templateprocessor
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -90,3 +93,50 @@ func TestYamlFileReader_AssetNames(t *testing.T) {
 		})
 	}
 }
+
+func TestYamlFileReader_AssetsVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yamlfilereader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "cm.yaml"), []byte("kind: ConfigMap"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewYamlFileReader(dir)
+	v1, err := r.AssetsVersion()
+	if err != nil {
+		t.Fatalf("YamlFileReader.AssetsVersion() error = %v", err)
+	}
+	v2, err := r.AssetsVersion()
+	if err != nil {
+		t.Fatalf("YamlFileReader.AssetsVersion() error = %v", err)
+	}
+	if v1 != v2 {
+		t.Errorf("Expected the same version for unchanged assets, got %s and %s", v1, v2)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "cm.yaml"), []byte("kind: ConfigMap\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v3, err := r.AssetsVersion()
+	if err != nil {
+		t.Fatalf("YamlFileReader.AssetsVersion() error = %v", err)
+	}
+	if v3 == v1 {
+		t.Errorf("Expected a new version for changed assets, got %s", v3)
+	}
+}
+
+func TestYamlFileReader_AssetNamesFile(t *testing.T) {
+	r := NewYamlFileReader("../../test/unit/resources/templates/withhelpers/test.yaml")
+	got, err := r.AssetNames()
+	if err != nil {
+		t.Fatalf("YamlFileReader.AssetNames() error = %v", err)
+	}
+	want := []string{"_helpers.tpl", "test.yaml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("YamlFileReader.AssetNames() = %v, want %v", got, want)
+	}
+}
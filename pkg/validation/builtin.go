@@ -0,0 +1,32 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package validation
+
+import (
+	_ "embed"
+	"sync"
+)
+
+//go:generate go run gen_builtin_openapi.go
+
+//builtInOpenAPISpec is the OpenAPI v2 spec of the built-in kinds of the client-go scheme
+//
+//go:embed builtin_openapi.json
+var builtInOpenAPISpec []byte
+
+var (
+	builtInOnce sync.Once
+	builtInSpec *openAPISpec
+)
+
+//builtInSchemas returns the schemas of the built-in kinds, parsed once
+func builtInSchemas() *openAPISpec {
+	builtInOnce.Do(func() {
+		spec, err := parseOpenAPISpec(builtInOpenAPISpec)
+		if err != nil {
+			panic("invalid built-in OpenAPI spec: " + err.Error())
+		}
+		builtInSpec = spec
+	})
+	return builtInSpec
+}
@@ -0,0 +1,257 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//go:build ignore
+// +build ignore
+
+//gen_builtin_openapi generates the OpenAPI v2 definitions of the built-in kinds of the client-go scheme,
+//as the kube-openapi generator does: a field is required if it is neither omitempty nor marked +optional.
+//Run it with go generate ./pkg/validation
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const output = "builtin_openapi.json"
+
+type gvk struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+type schemaProps struct {
+	Ref                  string                  `json:"$ref,omitempty"`
+	Type                 string                  `json:"type,omitempty"`
+	Format               string                  `json:"format,omitempty"`
+	Properties           map[string]*schemaProps `json:"properties,omitempty"`
+	AdditionalProperties *schemaProps            `json:"additionalProperties,omitempty"`
+	Items                *schemaProps            `json:"items,omitempty"`
+	Required             []string                `json:"required,omitempty"`
+	GroupVersionKinds    []gvk                   `json:"x-kubernetes-group-version-kind,omitempty"`
+}
+
+//openAPISchemaType is implemented by the types with a custom json form, Quantity, Time, IntOrString...
+type openAPISchemaType interface {
+	OpenAPISchemaType() []string
+	OpenAPISchemaFormat() string
+}
+
+type generator struct {
+	definitions map[string]*schemaProps
+	//The +optional fields by package, type and field
+	optional map[string]map[string]bool
+}
+
+func main() {
+	g := &generator{
+		definitions: make(map[string]*schemaProps),
+		optional:    make(map[string]map[string]bool),
+	}
+	for gv, types := range builtInKinds() {
+		for kind, t := range types {
+			name := g.ref(t)
+			d := g.definitions[name]
+			d.GroupVersionKinds = append(d.GroupVersionKinds, gvk{Group: gv.Group, Version: gv.Version, Kind: kind})
+		}
+	}
+	for _, d := range g.definitions {
+		sort.Slice(d.GroupVersionKinds, func(i, j int) bool {
+			return fmt.Sprint(d.GroupVersionKinds[i]) < fmt.Sprint(d.GroupVersionKinds[j])
+		})
+	}
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"swagger":     "2.0",
+		"definitions": g.definitions,
+	}, "", " ")
+	if err != nil {
+		fail(err)
+	}
+	err = ioutil.WriteFile(output, append(b, '\n'), 0600)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Generated %d definitions in %s\n", len(g.definitions), output)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+type groupVersion struct {
+	Group   string
+	Version string
+}
+
+//builtInKinds returns the kinds of the scheme having an ObjectMeta, the lists and options are excluded
+func builtInKinds() map[groupVersion]map[string]reflect.Type {
+	kinds := make(map[groupVersion]map[string]reflect.Type)
+	for k, t := range scheme.Scheme.AllKnownTypes() {
+		if k.Version == runtime.APIVersionInternal || strings.HasSuffix(k.Kind, "List") {
+			continue
+		}
+		if f, ok := t.FieldByName("ObjectMeta"); !ok || !f.Anonymous {
+			continue
+		}
+		gv := groupVersion{Group: k.Group, Version: k.Version}
+		if kinds[gv] == nil {
+			kinds[gv] = make(map[string]reflect.Type)
+		}
+		kinds[gv][k.Kind] = t
+	}
+	return kinds
+}
+
+//definitionName returns the name of the definition of a type as in the kubernetes OpenAPI spec,
+//for example io.k8s.api.apps.v1.Deployment
+func definitionName(t reflect.Type) string {
+	parts := strings.Split(t.PkgPath(), "/")
+	domain := strings.Split(parts[0], ".")
+	for i, j := 0, len(domain)-1; i < j; i, j = i+1, j-1 {
+		domain[i], domain[j] = domain[j], domain[i]
+	}
+	return strings.Join(append(append(domain, parts[1:]...), t.Name()), ".")
+}
+
+//ref adds the definition of a struct and returns its name
+func (g *generator) ref(t reflect.Type) string {
+	name := definitionName(t)
+	if _, ok := g.definitions[name]; ok {
+		return name
+	}
+	d := &schemaProps{Type: "object", Properties: make(map[string]*schemaProps)}
+	g.definitions[name] = d
+	g.addFields(d, t)
+	sort.Strings(d.Required)
+	return name
+}
+
+//addFields adds the properties of the fields of a struct, the inlined structs included
+func (g *generator) addFields(d *schemaProps, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && (name == "" || strings.Contains(tag, ",inline")) {
+			g.addFields(d, f.Type)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		d.Properties[name] = g.schema(f.Type)
+		if !strings.Contains(tag, ",omitempty") && !g.isOptional(t, f.Name) {
+			d.Required = append(d.Required, name)
+		}
+	}
+}
+
+//schema returns the schema of a type, a $ref for the structs
+func (g *generator) schema(t reflect.Type) *schemaProps {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if custom, ok := reflect.New(t).Elem().Interface().(openAPISchemaType); ok {
+		s := &schemaProps{Type: custom.OpenAPISchemaType()[0], Format: custom.OpenAPISchemaFormat()}
+		if t.Name() == "Quantity" {
+			s.Format = "quantity"
+		}
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if t.Name() == "RawExtension" {
+			return &schemaProps{Type: "object"}
+		}
+		return &schemaProps{Ref: "#/definitions/" + g.ref(t)}
+	case reflect.Map:
+		return &schemaProps{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &schemaProps{Type: "string", Format: "byte"}
+		}
+		return &schemaProps{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.String:
+		return &schemaProps{Type: "string"}
+	case reflect.Bool:
+		return &schemaProps{Type: "boolean"}
+	case reflect.Int32, reflect.Uint32, reflect.Int, reflect.Int16, reflect.Uint16, reflect.Int8, reflect.Uint8:
+		return &schemaProps{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &schemaProps{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &schemaProps{Type: "number", Format: "double"}
+	case reflect.Interface:
+		return &schemaProps{Type: "object"}
+	default:
+		fail(fmt.Errorf("unsupported type %s", t))
+		return nil
+	}
+}
+
+//isOptional returns true if the field of a struct has the +optional comment tag
+func (g *generator) isOptional(t reflect.Type, field string) bool {
+	optional, ok := g.optional[t.PkgPath()]
+	if !ok {
+		optional = parseOptional(t.PkgPath())
+		g.optional[t.PkgPath()] = optional
+	}
+	return optional[t.Name()+"."+field]
+}
+
+//parseOptional returns the fields of the structs of a package marked +optional
+func parseOptional(pkgPath string) map[string]bool {
+	pkg, err := build.Import(pkgPath, "", build.FindOnly)
+	if err != nil {
+		fail(err)
+	}
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, pkg.Dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		fail(err)
+	}
+	optional := make(map[string]bool)
+	for _, p := range pkgs {
+		for _, f := range p.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				spec, ok := n.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+				st, ok := spec.Type.(*ast.StructType)
+				if !ok {
+					return true
+				}
+				for _, field := range st.Fields.List {
+					if field.Doc == nil || !strings.Contains(field.Doc.Text(), "+optional") {
+						continue
+					}
+					for _, name := range field.Names {
+						optional[spec.Name.Name+"."+name.Name] = true
+					}
+				}
+				return true
+			})
+		}
+	}
+	return optional
+}
@@ -0,0 +1,322 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//Package validation validates rendered resources without a cluster
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/stolostron/library-go/pkg/internal/jsonschema"
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog"
+)
+
+//SchemaFinding is a violation of its schema by a rendered resource
+type SchemaFinding struct {
+	Kind      string
+	Namespace string
+	Name      string
+	//The template the resource was rendered from, empty if unknown
+	Source string
+	//The path of the invalid field, for example spec.template.spec.containers[0].name
+	Path    string
+	Message string
+}
+
+func (f SchemaFinding) String() string {
+	s := fmt.Sprintf("%s %s/%s", f.Kind, f.Namespace, f.Name)
+	if f.Source != "" {
+		s = fmt.Sprintf("%s (%s)", s, f.Source)
+	}
+	if f.Path != "" {
+		return fmt.Sprintf("%s: %s: %s", s, f.Path, f.Message)
+	}
+	return fmt.Sprintf("%s: %s", s, f.Message)
+}
+
+//SchemaError is returned by the SchemaValidator when resources don't match their schema
+type SchemaError struct {
+	Findings []SchemaFinding
+}
+
+func (e *SchemaError) Error() string {
+	findings := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		findings[i] = f.String()
+	}
+	return fmt.Sprintf("schema validation failed:\n%s", strings.Join(findings, "\n"))
+}
+
+//IsSchemaError returns true if the error is a SchemaError
+func IsSchemaError(err error) bool {
+	_, ok := err.(*SchemaError)
+	return ok
+}
+
+//openAPISpec is an OpenAPI v2 or v3 document, the schemas are in their generic form
+type openAPISpec struct {
+	Definitions map[string]interface{} `json:"definitions,omitempty"`
+	Components  struct {
+		Schemas map[string]interface{} `json:"schemas,omitempty"`
+	} `json:"components,omitempty"`
+}
+
+//SchemaValidator validates the rendered resources against the OpenAPI schemas of their kind:
+//- the embedded schemas of the built-in kinds of the client-go scheme
+//- the schemas of the OpenAPI v2 or v3 documents loaded with LoadOpenAPISpec,
+//for example the output of `kubectl get --raw /openapi/v2`, they replace the embedded ones
+//- the openAPIV3Schema of the CRDs loaded with LoadCRDs or AddCRD and of the CRDs found in the resources
+//The kinds without schema are not validated.
+type SchemaValidator struct {
+	//The schemas by name, used to resolve the $ref
+	definitions map[string]interface{}
+	//The schemas by kind
+	kinds map[schema.GroupVersionKind]interface{}
+}
+
+var _ templateprocessor.SourceValidator = &SchemaValidator{}
+
+//NewSchemaValidator creates a SchemaValidator with the schemas of the built-in kinds,
+//only the built-in kinds and the CRDs of the rendered resources are validated
+func NewSchemaValidator() *SchemaValidator {
+	v := &SchemaValidator{
+		definitions: make(map[string]interface{}),
+		kinds:       make(map[schema.GroupVersionKind]interface{}),
+	}
+	v.addSpec(builtInSchemas())
+	return v
+}
+
+//LoadOpenAPISpec loads the schemas of an OpenAPI v2 or v3 json or yaml document
+func (v *SchemaValidator) LoadOpenAPISpec(path string) error {
+	b, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	spec, err := parseOpenAPISpec(b)
+	if err != nil {
+		return fmt.Errorf("Unable to read the OpenAPI spec %s: %s", path, err)
+	}
+	v.addSpec(spec)
+	klog.V(2).Infof("Loaded %d schemas from %s", len(spec.schemas()), path)
+	return nil
+}
+
+//parseOpenAPISpec parses an OpenAPI v2 or v3 json or yaml document
+func parseOpenAPISpec(b []byte) (*openAPISpec, error) {
+	b, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	spec := &openAPISpec{}
+	err = json.Unmarshal(b, spec)
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+//schemas returns the definitions of a v2 spec or the components schemas of a v3 spec
+func (spec *openAPISpec) schemas() map[string]interface{} {
+	if len(spec.Definitions) != 0 {
+		return spec.Definitions
+	}
+	return spec.Components.Schemas
+}
+
+//addSpec adds the schemas of a spec, they replace the schemas having the same name or kind
+func (v *SchemaValidator) addSpec(spec *openAPISpec) {
+	for name, s := range spec.schemas() {
+		v.definitions[name] = s
+		for _, gvk := range groupVersionKinds(s) {
+			v.kinds[gvk] = s
+		}
+	}
+}
+
+//groupVersionKinds returns the kinds of the x-kubernetes-group-version-kind extension of a schema
+func groupVersionKinds(s interface{}) []schema.GroupVersionKind {
+	m, _ := s.(map[string]interface{})
+	extension, _ := m["x-kubernetes-group-version-kind"].([]interface{})
+	gvks := make([]schema.GroupVersionKind, 0, len(extension))
+	for _, e := range extension {
+		gvk, _ := e.(map[string]interface{})
+		group, _ := gvk["group"].(string)
+		version, _ := gvk["version"].(string)
+		kind, _ := gvk["kind"].(string)
+		gvks = append(gvks, schema.GroupVersionKind{Group: group, Version: version, Kind: kind})
+	}
+	return gvks
+}
+
+//LoadCRDs loads the schemas of the CRDs found in the yaml files of a directory or in a yaml file
+func (v *SchemaValidator) LoadCRDs(path string) error {
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || (filepath.Ext(p) != ".yaml" && filepath.Ext(p) != ".yml" && filepath.Ext(p) != ".json") {
+			return nil
+		}
+		b, err := ioutil.ReadFile(filepath.Clean(p))
+		if err != nil {
+			return err
+		}
+		for _, doc := range templateprocessor.ConvertStringToArrayOfBytes(string(b), templateprocessor.KubernetesYamlsDelimiter) {
+			if len(bytes.TrimSpace(doc)) == 0 {
+				continue
+			}
+			j, err := yaml.YAMLToJSON(doc)
+			if err != nil {
+				return fmt.Errorf("Unable to read %s: %s", p, err)
+			}
+			u := &unstructured.Unstructured{}
+			err = u.UnmarshalJSON(j)
+			if err != nil {
+				return fmt.Errorf("Unable to read %s: %s", p, err)
+			}
+			if u.GetKind() == "CustomResourceDefinition" {
+				err = v.AddCRD(u)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+//AddCRD adds the openAPIV3Schema of each version of a v1 or v1beta1 CustomResourceDefinition
+func (v *SchemaValidator) AddCRD(crd *unstructured.Unstructured) error {
+	for gvk, s := range crdSchemas(crd) {
+		m, ok := s.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Invalid openAPIV3Schema in CRD %s: expected an object, got %T", crd.GetName(), s)
+		}
+		v.kinds[gvk] = withObjectMeta(runtime.DeepCopyJSON(m))
+	}
+	return nil
+}
+
+//crdSchemas returns the openAPIV3Schema of each version of a CRD
+func crdSchemas(crd *unstructured.Unstructured) map[schema.GroupVersionKind]interface{} {
+	schemas := make(map[schema.GroupVersionKind]interface{})
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	//v1beta1 global schema
+	global, _, _ := unstructured.NestedFieldNoCopy(crd.Object, "spec", "validation", "openAPIV3Schema")
+	if version, _, _ := unstructured.NestedString(crd.Object, "spec", "version"); version != "" && global != nil {
+		schemas[schema.GroupVersionKind{Group: group, Version: version, Kind: kind}] = global
+	}
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, ver := range versions {
+		m, ok := ver.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := m["name"].(string)
+		s, _, _ := unstructured.NestedFieldNoCopy(m, "schema", "openAPIV3Schema")
+		if s == nil {
+			s = global
+		}
+		if s != nil {
+			schemas[schema.GroupVersionKind{Group: group, Version: name, Kind: kind}] = s
+		}
+	}
+	return schemas
+}
+
+//withObjectMeta allows the apiVersion, kind and metadata at the root of a CRD schema
+func withObjectMeta(s map[string]interface{}) map[string]interface{} {
+	properties, ok := s["properties"].(map[string]interface{})
+	if !ok {
+		return s
+	}
+	for _, field := range []string{"apiVersion", "kind", "metadata"} {
+		if _, ok := properties[field]; !ok {
+			properties[field] = map[string]interface{}{"x-kubernetes-preserve-unknown-fields": true}
+		}
+	}
+	return s
+}
+
+//Validate returns a SchemaError if resources don't match their schema
+func (v *SchemaValidator) Validate(us []*unstructured.Unstructured) error {
+	return v.ValidateSources(us, nil)
+}
+
+//ValidateSources returns a SchemaError if resources don't match their schema,
+//the findings name the source templates
+func (v *SchemaValidator) ValidateSources(us []*unstructured.Unstructured, sources templateprocessor.Sources) error {
+	findings := v.Findings(us, sources)
+	if len(findings) != 0 {
+		return &SchemaError{Findings: findings}
+	}
+	return nil
+}
+
+//Findings returns the violations of their schema by the resources,
+//the schemas of the CRDs found in the resources are used
+func (v *SchemaValidator) Findings(
+	us []*unstructured.Unstructured,
+	sources templateprocessor.Sources,
+) []SchemaFinding {
+	kinds := make(map[schema.GroupVersionKind]interface{})
+	for gvk, s := range v.kinds {
+		kinds[gvk] = s
+	}
+	bundle := &SchemaValidator{definitions: v.definitions, kinds: kinds}
+	findings := make([]SchemaFinding, 0)
+	for _, u := range us {
+		if u.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		if err := bundle.AddCRD(u); err != nil {
+			findings = append(findings, newSchemaFinding(u, sources, "", err.Error()))
+		}
+	}
+	//The $ref of the OpenAPI v2 and v3 documents
+	validator := &jsonschema.Validator{
+		Root: map[string]interface{}{
+			"definitions": bundle.definitions,
+			"components":  map[string]interface{}{"schemas": bundle.definitions},
+		},
+		Structural: true,
+	}
+	for _, u := range us {
+		s, ok := bundle.kinds[u.GroupVersionKind()]
+		if !ok {
+			klog.V(5).Infof("No schema for %s, not validated", u.GroupVersionKind())
+			continue
+		}
+		for _, violation := range validator.Validate(u.Object, s, "") {
+			findings = append(findings, newSchemaFinding(u, sources, violation.Path, violation.Message))
+		}
+	}
+	return findings
+}
+
+func newSchemaFinding(
+	u *unstructured.Unstructured,
+	sources templateprocessor.Sources,
+	path, message string,
+) SchemaFinding {
+	return SchemaFinding{
+		Kind:      u.GetKind(),
+		Namespace: u.GetNamespace(),
+		Name:      u.GetName(),
+		Source:    sources[u],
+		Path:      path,
+		Message:   message,
+	}
+}
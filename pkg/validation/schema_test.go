@@ -0,0 +1,379 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package validation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/stolostron/library-go/pkg/templateprocessor"
+)
+
+const specFile = `
+swagger: "2.0"
+definitions:
+  io.k8s.api.apps.v1.Deployment:
+    type: object
+    x-kubernetes-group-version-kind:
+    - group: apps
+      version: v1
+      kind: Deployment
+    properties:
+      apiVersion:
+        type: string
+      kind:
+        type: string
+      metadata:
+        $ref: "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+      spec:
+        $ref: "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"
+  io.k8s.api.apps.v1.DeploymentSpec:
+    type: object
+    required:
+    - selector
+    properties:
+      replicas:
+        type: integer
+      selector:
+        type: object
+        additionalProperties: true
+      strategy:
+        type: object
+        properties:
+          type:
+            type: string
+            enum:
+            - Recreate
+            - RollingUpdate
+  io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta:
+    type: object
+    properties:
+      name:
+        type: string
+      namespace:
+        type: string
+      labels:
+        type: object
+        additionalProperties:
+          type: string
+`
+
+const crd = `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required:
+            - size
+            properties:
+              size:
+                x-kubernetes-int-or-string: true
+              color:
+                type: string
+              tags:
+                type: array
+                items:
+                  type: string
+              extra:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+`
+
+var assets = map[string]string{
+	"deployment": `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+  labels:
+    app: app
+spec:
+  replica: 2
+  selector:
+    matchLabels:
+      app: app
+  strategy:
+    type: Rolling`,
+	"crd": crd,
+	"widget": `
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+  namespace: default
+spec:
+  size: 10Gi
+  tags:
+  - a
+  - b: c
+  - true
+  extra:
+    any: field`,
+	"widget-invalid": `
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: invalid
+  namespace: default
+spec:
+  colour: blue`,
+	"service": `
+apiVersion: v1
+kind: Service
+metadata:
+  name: service
+  namespace: default
+spec:
+  selector:
+    app: app
+  ports:
+  - port: 80
+    target: 8080`,
+	"pod": `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  namespace: default
+spec:
+  containers:
+  - image: 1
+    resources:
+      requests:
+        cpu: 1
+        memory: 1Zz
+  - name: valid
+    image: nginx
+    resources:
+      limits:
+        cpu: 500m
+        memory: 1Gi`,
+	"configmap": `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: configmap
+  namespace: default
+data:
+  size: "1"`,
+	"unknown": `
+apiVersion: example.com/v1
+kind: Unknown
+metadata:
+  name: unknown
+spec:
+  any: field`,
+}
+
+func TestSchemaValidator_Validate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "validation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	specPath := filepath.Join(dir, "openapi.yaml")
+	err = ioutil.WriteFile(specPath, []byte(specFile), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crdsDir := filepath.Join(dir, "crds")
+	err = os.Mkdir(crdsDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(crdsDir, "widget.yaml"), []byte(crd), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withSpec := NewSchemaValidator()
+	err = withSpec.LoadOpenAPISpec(specPath)
+	if err != nil {
+		t.Fatalf("Unable to load the spec %s", err.Error())
+	}
+	withCRDs := NewSchemaValidator()
+	err = withCRDs.LoadCRDs(crdsDir)
+	if err != nil {
+		t.Fatalf("Unable to load the CRDs %s", err.Error())
+	}
+
+	tests := []struct {
+		name         string
+		validator    *SchemaValidator
+		templates    []string
+		wantFindings []SchemaFinding
+	}{
+		{
+			name:      "openapi spec",
+			validator: withSpec,
+			templates: []string{"deployment", "unknown"},
+			wantFindings: []SchemaFinding{
+				{
+					Kind:      "Deployment",
+					Namespace: "default",
+					Name:      "app",
+					Source:    "deployment",
+					Path:      "spec.replica",
+					Message:   "unknown field",
+				},
+				{
+					Kind:      "Deployment",
+					Namespace: "default",
+					Name:      "app",
+					Source:    "deployment",
+					Path:      "spec.strategy.type",
+					Message:   "unsupported value Rolling, must be one of [Recreate RollingUpdate]",
+				},
+			},
+		},
+		{
+			name:      "crd in the bundle",
+			validator: NewSchemaValidator(),
+			templates: []string{"crd", "widget", "widget-invalid"},
+			wantFindings: []SchemaFinding{
+				{
+					Kind:      "Widget",
+					Namespace: "default",
+					Name:      "widget",
+					Source:    "widget",
+					Path:      "spec.tags[1]",
+					Message:   "expected a string, got an object",
+				},
+				{
+					Kind:      "Widget",
+					Namespace: "default",
+					Name:      "widget",
+					Source:    "widget",
+					Path:      "spec.tags[2]",
+					Message:   "expected a string, got a boolean",
+				},
+				{
+					Kind:      "Widget",
+					Namespace: "default",
+					Name:      "invalid",
+					Source:    "widget-invalid",
+					Path:      "spec.size",
+					Message:   "required field is missing",
+				},
+				{
+					Kind:      "Widget",
+					Namespace: "default",
+					Name:      "invalid",
+					Source:    "widget-invalid",
+					Path:      "spec.colour",
+					Message:   "unknown field",
+				},
+			},
+		},
+		{
+			name:      "crds directory",
+			validator: withCRDs,
+			templates: []string{"widget-invalid"},
+			wantFindings: []SchemaFinding{
+				{
+					Kind:      "Widget",
+					Namespace: "default",
+					Name:      "invalid",
+					Source:    "widget-invalid",
+					Path:      "spec.size",
+					Message:   "required field is missing",
+				},
+				{
+					Kind:      "Widget",
+					Namespace: "default",
+					Name:      "invalid",
+					Source:    "widget-invalid",
+					Path:      "spec.colour",
+					Message:   "unknown field",
+				},
+			},
+		},
+		{
+			name:      "built-in kinds",
+			validator: NewSchemaValidator(),
+			templates: []string{"service", "pod"},
+			wantFindings: []SchemaFinding{
+				{
+					Kind:      "Service",
+					Namespace: "default",
+					Name:      "service",
+					Source:    "service",
+					Path:      "spec.ports[0].target",
+					Message:   "unknown field",
+				},
+				{
+					Kind:      "Pod",
+					Namespace: "default",
+					Name:      "pod",
+					Source:    "pod",
+					Path:      "spec.containers[0].name",
+					Message:   "required field is missing",
+				},
+				{
+					Kind:      "Pod",
+					Namespace: "default",
+					Name:      "pod",
+					Source:    "pod",
+					Path:      "spec.containers[0].image",
+					Message:   "expected a string, got a number",
+				},
+				{
+					Kind:      "Pod",
+					Namespace: "default",
+					Name:      "pod",
+					Source:    "pod",
+					Path:      "spec.containers[0].resources.requests.memory",
+					Message:   `invalid quantity "1Zz"`,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp, err := templateprocessor.NewTemplateProcessor(templateprocessor.NewTestReader(assets),
+				&templateprocessor.Options{Validators: []templateprocessor.Validator{tt.validator}})
+			if err != nil {
+				t.Fatalf("Unable to create the template processor %s", err.Error())
+			}
+			_, err = tp.TemplateResourcesUnstructured(tt.templates, nil)
+			if !IsSchemaError(err) {
+				t.Fatalf("Expected a SchemaError, got %v", err)
+			}
+			if !reflect.DeepEqual(err.(*SchemaError).Findings, tt.wantFindings) {
+				t.Errorf("Expected findings:\n%v\ngot:\n%v", tt.wantFindings, err.(*SchemaError).Findings)
+			}
+		})
+	}
+}
+
+func TestSchemaValidator_Validate_Valid(t *testing.T) {
+	tp, err := templateprocessor.NewTemplateProcessor(templateprocessor.NewTestReader(assets),
+		&templateprocessor.Options{Validators: []templateprocessor.Validator{NewSchemaValidator()}})
+	if err != nil {
+		t.Fatalf("Unable to create the template processor %s", err.Error())
+	}
+	_, err = tp.TemplateResourcesUnstructured([]string{"crd", "unknown", "configmap"}, nil)
+	if err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+}
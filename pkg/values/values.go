@@ -0,0 +1,510 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//Package values loads the values of the templates from layered sources
+package values
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/klog"
+)
+
+//Values are the values of the templates
+type Values map[string]interface{}
+
+//String returns the values in yaml
+func (v Values) String() string {
+	b, err := v.YAML()
+	if err != nil {
+		return fmt.Sprintf("%v", map[string]interface{}(v))
+	}
+	return string(b)
+}
+
+//YAML returns the values in yaml
+func (v Values) YAML() ([]byte, error) {
+	return yaml.Marshal(map[string]interface{}(v))
+}
+
+//OverrideType defines how the value of an Override is read
+type OverrideType string
+
+const (
+	//OverrideSet the value is converted to a bool, an integer or null if possible, a string otherwise
+	OverrideSet OverrideType = "set"
+	//OverrideSetString the value is a string
+	OverrideSetString OverrideType = "set-string"
+	//OverrideSetFile the value is the path of a file which content is the string value
+	OverrideSetFile OverrideType = "set-file"
+)
+
+//Override sets some values, the Expression is a comma separated list of path=value,
+//for example a.b[0].c=value,d=value. The characters , . = [ can be escaped with a \.
+//A value {v1,v2} is a list.
+type Override struct {
+	Type       OverrideType
+	Expression string
+}
+
+//StdinFile is the file name to read the values from stdin
+const StdinFile = "-"
+
+//Options defines the sources of the values, they are merged in this order,
+//a later source overriding the values of an earlier one:
+//the Files in order, then the environment variables of the EnvPrefixes in order
+//and then the Overrides in order.
+type Options struct {
+	//The yaml or json values files, StdinFile to read stdin
+	Files []string
+	//The prefixes of the environment variables setting values, for example with the prefix APP_,
+	//APP_IMAGE__TAG=1.0 sets image.tag, the segments are separated by __.
+	//A segment matches an existing key ignoring the case and the underscores, for example
+	//IMAGE_PULL_POLICY matches imagePullPolicy, else the key is the segment in camel case.
+	//The values are converted as the OverrideSet values.
+	EnvPrefixes []string
+	//The overrides, applied in order
+	Overrides []Override
+	//Used to read stdin, os.Stdin if not set
+	Stdin io.Reader
+	//Used to read the environment variables, os.Environ if not set
+	Environ func() []string
+}
+
+//AddFlags registers the flags -values, -values-env, -set, -set-string and -set-file
+//which can be repeated and fill the options, the overrides are kept in the order of the command line.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.Var(&stringsFlag{values: &o.Files}, "values",
+		"A yaml or json values file, '-' for stdin, can be repeated, the later files override the former")
+	fs.Var(&stringsFlag{values: &o.EnvPrefixes}, "values-env",
+		"A prefix of the environment variables setting values, for example APP_ for APP_IMAGE__TAG=1.0, can be repeated")
+	fs.Var(&overrideFlag{options: o, overrideType: OverrideSet}, "set",
+		"Set values, for example a.b[0].c=value,d=value, can be repeated")
+	fs.Var(&overrideFlag{options: o, overrideType: OverrideSetString}, "set-string",
+		"Set string values, for example a.b=value, can be repeated")
+	fs.Var(&overrideFlag{options: o, overrideType: OverrideSetFile}, "set-file",
+		"Set values from the content of files, for example a.b=path, can be repeated")
+}
+
+type stringsFlag struct {
+	values *[]string
+}
+
+func (f *stringsFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f.values = append(*f.values, value)
+	return nil
+}
+
+type overrideFlag struct {
+	options      *Options
+	overrideType OverrideType
+}
+
+func (f *overrideFlag) String() string {
+	return ""
+}
+
+func (f *overrideFlag) Set(value string) error {
+	f.options.Overrides = append(f.options.Overrides, Override{Type: f.overrideType, Expression: value})
+	return nil
+}
+
+//Load reads and merges the sources of the values
+func Load(o *Options) (Values, error) {
+	if o == nil {
+		o = &Options{}
+	}
+	values := make(map[string]interface{})
+	for _, file := range o.Files {
+		fileValues, err := ReadFile(file, o.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		values = Merge(values, fileValues)
+	}
+	environ := o.Environ
+	if environ == nil {
+		environ = os.Environ
+	}
+	env := environ()
+	sort.Strings(env)
+	for _, prefix := range o.EnvPrefixes {
+		for _, e := range env {
+			parts := strings.SplitN(e, "=", 2)
+			if len(parts) != 2 || !strings.HasPrefix(parts[0], prefix) || parts[0] == prefix {
+				continue
+			}
+			klog.V(5).Infof("Set the values from the environment variable %s", parts[0])
+			err := setEnv(values, strings.TrimPrefix(parts[0], prefix), parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid environment variable %s: %s", parts[0], err)
+			}
+		}
+	}
+	for _, override := range o.Overrides {
+		err := Set(values, override)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+//ReadFile reads a yaml or json values file, StdinFile reads stdin
+func ReadFile(path string, stdin io.Reader) (map[string]interface{}, error) {
+	var b []byte
+	var err error
+	if path == StdinFile {
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		b, err = ioutil.ReadAll(stdin)
+	} else {
+		b, err = ioutil.ReadFile(filepath.Clean(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	err = yaml.Unmarshal(b, &values)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the values file %s: %s", path, err)
+	}
+	return values, nil
+}
+
+//Merge merges deeply src into dst and returns dst, the maps are merged and
+//the other values of src replace the ones of dst, a null value of src removes the key from dst.
+func Merge(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = make(map[string]interface{})
+	}
+	for k, v := range src {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			dst[k] = Merge(dstMap, srcMap)
+			continue
+		}
+		if srcIsMap {
+			dst[k] = Merge(nil, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+//Set applies an override on the values
+func Set(values map[string]interface{}, override Override) error {
+	for _, assignment := range splitUnescaped(override.Expression, ',', true) {
+		parts := splitUnescaped(assignment, '=', false)
+		if len(parts) < 2 {
+			return fmt.Errorf("Invalid --%s %s, expected path=value", override.Type, assignment)
+		}
+		path, err := parsePath(parts[0])
+		if err != nil {
+			return fmt.Errorf("Invalid --%s %s: %s", override.Type, assignment, err)
+		}
+		raw := strings.Join(parts[1:], "=")
+		var value interface{}
+		switch override.Type {
+		case OverrideSetString:
+			value = unescape(raw)
+		case OverrideSetFile:
+			b, err := ioutil.ReadFile(filepath.Clean(unescape(raw)))
+			if err != nil {
+				return fmt.Errorf("Invalid --%s %s: %s", override.Type, assignment, err)
+			}
+			value = string(b)
+		case OverrideSet, "":
+			value = parseValue(raw)
+		default:
+			return fmt.Errorf("Unknown override type %s", override.Type)
+		}
+		err = setPath(values, path, value)
+		if err != nil {
+			return fmt.Errorf("Invalid --%s %s: %s", override.Type, assignment, err)
+		}
+	}
+	return nil
+}
+
+//splitUnescaped splits s on the sep which are not escaped,
+//if braces is true the sep between { and } are ignored
+func splitUnescaped(s string, sep rune, braces bool) []string {
+	parts := make([]string, 0)
+	var current strings.Builder
+	escaped := false
+	depth := 0
+	for _, c := range s {
+		switch {
+		case escaped:
+			current.WriteRune('\\')
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case braces && c == '{':
+			depth++
+			current.WriteRune(c)
+		case braces && c == '}' && depth > 0:
+			depth--
+			current.WriteRune(c)
+		case c == sep && depth == 0:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	parts = append(parts, current.String())
+	return parts
+}
+
+//unescape removes the \ escaping a character
+func unescape(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range s {
+		if c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+//pathElement is a key of a map or an index of a list
+type pathElement struct {
+	key   string
+	index int
+	list  bool
+}
+
+//parsePath parses a path like a.b[0].c
+func parsePath(s string) ([]pathElement, error) {
+	path := make([]pathElement, 0)
+	for _, segment := range splitUnescaped(s, '.', false) {
+		key := segment
+		indexes := ""
+		if i := indexUnescaped(segment, '['); i >= 0 {
+			key, indexes = segment[:i], segment[i:]
+		}
+		key = unescape(key)
+		if key == "" {
+			return nil, fmt.Errorf("empty key in %s", s)
+		}
+		path = append(path, pathElement{key: key})
+		for indexes != "" {
+			end := strings.IndexRune(indexes, ']')
+			if !strings.HasPrefix(indexes, "[") || end < 0 {
+				return nil, fmt.Errorf("invalid index in %s", s)
+			}
+			index, err := strconv.Atoi(indexes[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index %s in %s", indexes[1:end], s)
+			}
+			path = append(path, pathElement{index: index, list: true})
+			indexes = indexes[end+1:]
+		}
+	}
+	return path, nil
+}
+
+func indexUnescaped(s string, r rune) int {
+	escaped := false
+	for i, c := range s {
+		if escaped {
+			escaped = false
+			continue
+		}
+		if c == '\\' {
+			escaped = true
+			continue
+		}
+		if c == r {
+			return i
+		}
+	}
+	return -1
+}
+
+//parseValue converts a value to a bool, an integer, null or a list if possible, a string otherwise
+func parseValue(s string) interface{} {
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		list := make([]interface{}, 0)
+		inner := s[1 : len(s)-1]
+		if inner == "" {
+			return list
+		}
+		for _, item := range splitUnescaped(inner, ',', true) {
+			list = append(list, parseValue(item))
+		}
+		return list
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	//Keep the leading zeros, for example a zip code
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil && (s == "0" || !strings.HasPrefix(strings.TrimPrefix(s, "-"), "0")) {
+		return i
+	}
+	return unescape(s)
+}
+
+//setPath sets the value at the path, creating the missing maps and lists,
+//a null value removes the key
+func setPath(values map[string]interface{}, path []pathElement, value interface{}) error {
+	var current interface{} = values
+	//set replaces the current container in its parent
+	set := func(interface{}) {}
+	for i, e := range path {
+		last := i == len(path)-1
+		if e.list {
+			list, ok := current.([]interface{})
+			if !ok {
+				if current != nil {
+					return fmt.Errorf("%s is not a list", formatPath(path[:i]))
+				}
+				list = make([]interface{}, 0)
+			}
+			for len(list) <= e.index {
+				list = append(list, nil)
+			}
+			set(list)
+			if last {
+				list[e.index] = value
+				return nil
+			}
+			index := e.index
+			set = func(v interface{}) { list[index] = v }
+			current = list[index]
+			continue
+		}
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			if current != nil {
+				return fmt.Errorf("%s is not a map", formatPath(path[:i]))
+			}
+			m = make(map[string]interface{})
+			set(m)
+		}
+		if last {
+			if value == nil {
+				delete(m, e.key)
+			} else {
+				m[e.key] = value
+			}
+			return nil
+		}
+		key := e.key
+		set = func(v interface{}) { m[key] = v }
+		current = m[key]
+	}
+	return nil
+}
+
+func formatPath(path []pathElement) string {
+	var b strings.Builder
+	for i, e := range path {
+		if e.list {
+			fmt.Fprintf(&b, "[%d]", e.index)
+			continue
+		}
+		if i > 0 {
+			b.WriteRune('.')
+		}
+		b.WriteString(e.key)
+	}
+	return b.String()
+}
+
+//setEnv sets the value of an environment variable, the name being the path without the prefix
+func setEnv(values map[string]interface{}, name, value string) error {
+	path := make([]pathElement, 0)
+	var current interface{} = values
+	for _, segment := range strings.Split(name, "__") {
+		if segment == "" {
+			return fmt.Errorf("empty segment")
+		}
+		key := ""
+		if m, ok := current.(map[string]interface{}); ok {
+			key = matchKey(m, segment)
+			current = m[key]
+		} else {
+			current = nil
+		}
+		if key == "" {
+			key = camelCase(segment)
+		}
+		path = append(path, pathElement{key: key})
+	}
+	return setPath(values, path, parseValue(value))
+}
+
+//matchKey returns the key of the map matching the segment ignoring the case and the underscores
+func matchKey(m map[string]interface{}, segment string) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, "_", ""))
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if normalize(k) == normalize(segment) {
+			return k
+		}
+	}
+	return ""
+}
+
+//camelCase converts IMAGE_PULL_POLICY to imagePullPolicy
+func camelCase(s string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range strings.ToLower(s) {
+		if c == '_' {
+			upper = b.Len() > 0
+			continue
+		}
+		if upper {
+			c = unicode.ToUpper(c)
+			upper = false
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,197 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package values
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := write("base.yaml", `
+name: app
+image:
+  repository: quay.io/app
+  tag: "1.0"
+  imagePullPolicy: Always
+ports:
+- 80
+- 443
+debug: true
+`)
+	prod := write("prod.yaml", `
+image:
+  tag: "2.0"
+debug: null
+`)
+	cert := write("cert.pem", "CERT")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o := &Options{
+		Stdin: strings.NewReader("replicas: 3\n"),
+		Environ: func() []string {
+			return []string{
+				"APP_IMAGE__IMAGE_PULL_POLICY=IfNotPresent",
+				"APP_LOG_LEVEL=2",
+				"OTHER_NAME=other",
+			}
+		},
+	}
+	o.AddFlags(fs)
+	err = fs.Parse([]string{
+		"-values", base,
+		"-values", prod,
+		"-values", "-",
+		"-values-env", "APP_",
+		"-set", "ports[1]=8443,labels.team=a\\.b,args={--v,2}",
+		"-set-string", "image.tag=3.0",
+		"-set-file", "tls.cert=" + cert,
+		"-set", "replicas=5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(o)
+	if err != nil {
+		t.Fatalf("Unable to load the values %s", err.Error())
+	}
+	want := Values{
+		"name": "app",
+		"image": map[string]interface{}{
+			"repository":      "quay.io/app",
+			"tag":             "3.0",
+			"imagePullPolicy": "IfNotPresent",
+		},
+		"ports":    []interface{}{float64(80), int64(8443)},
+		"replicas": int64(5),
+		"logLevel": int64(2),
+		"labels":   map[string]interface{}{"team": "a.b"},
+		"args":     []interface{}{"--v", int64(2)},
+		"tls":      map[string]interface{}{"cert": "CERT"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected\n%v\ngot\n%v", want, got)
+	}
+	if !strings.Contains(got.String(), "imagePullPolicy: IfNotPresent") {
+		t.Errorf("Expected the values in yaml, got %s", got.String())
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]interface{}
+		override Override
+		want     map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "nested list of maps",
+			values:   map[string]interface{}{},
+			override: Override{Type: OverrideSet, Expression: "a.b[1].c=value"},
+			want: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": []interface{}{nil, map[string]interface{}{"c": "value"}},
+				},
+			},
+		},
+		{
+			name:     "update an existing list item",
+			values:   map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": "x", "c": "y"}}},
+			override: Override{Type: OverrideSet, Expression: "a[0].b=z"},
+			want:     map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": "z", "c": "y"}}},
+		},
+		{
+			name:     "typed values",
+			values:   map[string]interface{}{},
+			override: Override{Type: OverrideSet, Expression: "a=true,b=-12,c=012,d=1.5,e=x=y"},
+			want: map[string]interface{}{
+				"a": true,
+				"b": int64(-12),
+				"c": "012",
+				"d": "1.5",
+				"e": "x=y",
+			},
+		},
+		{
+			name:     "strings",
+			values:   map[string]interface{}{},
+			override: Override{Type: OverrideSetString, Expression: "a=true,b\\.c=1\\,2"},
+			want:     map[string]interface{}{"a": "true", "b.c": "1,2"},
+		},
+		{
+			name:     "null removes the key",
+			values:   map[string]interface{}{"a": map[string]interface{}{"b": 1, "c": 2}},
+			override: Override{Type: OverrideSet, Expression: "a.b=null"},
+			want:     map[string]interface{}{"a": map[string]interface{}{"c": 2}},
+		},
+		{
+			name:     "not a map",
+			values:   map[string]interface{}{"a": "string"},
+			override: Override{Type: OverrideSet, Expression: "a.b=1"},
+			wantErr:  true,
+		},
+		{
+			name:     "missing value",
+			values:   map[string]interface{}{},
+			override: Override{Type: OverrideSet, Expression: "a"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid index",
+			values:   map[string]interface{}{},
+			override: Override{Type: OverrideSet, Expression: "a[x]=1"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Set(tt.values, tt.override)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.values, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, tt.values)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dst := map[string]interface{}{
+		"a": map[string]interface{}{"b": 1, "c": 2},
+		"d": []interface{}{1, 2},
+		"e": "keep",
+	}
+	src := map[string]interface{}{
+		"a": map[string]interface{}{"b": 3, "f": map[string]interface{}{"g": 4}},
+		"d": []interface{}{5},
+		"e": nil,
+	}
+	want := map[string]interface{}{
+		"a": map[string]interface{}{"b": 3, "c": 2, "f": map[string]interface{}{"g": 4}},
+		"d": []interface{}{5},
+	}
+	got := Merge(dst, src)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}